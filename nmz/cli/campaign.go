@@ -0,0 +1,308 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	mcli "github.com/mitchellh/cli"
+	"github.com/osrg/namazu/nmz/historystorage"
+	"github.com/osrg/namazu/nmz/util/config"
+)
+
+type campaignFlags struct {
+	Runs               int
+	Time               time.Duration
+	StopOnFirstFailure bool
+	Parallel           int
+}
+
+var (
+	campaignFlagset = flag.NewFlagSet("campaign", flag.ExitOnError)
+	_campaignFlags  = campaignFlags{}
+)
+
+func init() {
+	campaignFlagset.IntVar(&_campaignFlags.Runs, "runs", 0, "number of runs (0: unlimited)")
+	campaignFlagset.DurationVar(&_campaignFlags.Time, "time", 0, "time budget; no run is started after this (0: unlimited)")
+	campaignFlagset.BoolVar(&_campaignFlags.StopOnFirstFailure, "stop-on-first-failure", false, "stop starting runs after the first failure")
+	campaignFlagset.IntVar(&_campaignFlags.Parallel, "parallel", 1, "number of parallel workers")
+}
+
+type campaign struct {
+	storagePath string
+	storage     historystorage.HistoryStorage
+	runs        int
+	deadline    time.Time // zero if unlimited
+	stopOnFirst bool
+
+	mu       sync.Mutex
+	started  int
+	stopped  string // reason of the stop ("" if not stopped)
+	firstID  int    // the first run ID of this campaign
+	seen     map[int]bool
+	nrPassed int
+	failures []int
+	// errors of "nmz run" processes (not failures of the validation)
+	nrErrors int
+}
+
+func newCampaign(storagePath string, runs int, budget time.Duration, stopOnFirst bool) (*campaign, error) {
+	storage, err := historystorage.LoadStorage(storagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load history storage %s: %s", storagePath, err)
+	}
+	storage.Init()
+	c := &campaign{
+		storagePath: storagePath,
+		storage:     storage,
+		runs:        runs,
+		stopOnFirst: stopOnFirst,
+		firstID:     storage.NrStoredHistories(),
+		seen:        make(map[int]bool),
+	}
+	if budget > 0 {
+		c.deadline = time.Now().Add(budget)
+	}
+	return c, nil
+}
+
+// returns true if a new run can be started
+func (this *campaign) next() bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	switch {
+	case this.stopped != "":
+	case this.runs > 0 && this.started >= this.runs:
+		this.stopped = fmt.Sprintf("%d runs done", this.runs)
+	case !this.deadline.IsZero() && time.Now().After(this.deadline):
+		this.stopped = "time budget exhausted"
+	default:
+		this.started++
+		return true
+	}
+	return false
+}
+
+// collects the results of the runs finished since the last call
+func (this *campaign) collect() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	// reload the number of the runs updated by "nmz run" processes
+	this.storage.Init()
+	for i := this.firstID; i < this.storage.NrStoredHistories(); i++ {
+		if this.seen[i] {
+			continue
+		}
+		successful, err := this.storage.IsSuccessful(i)
+		if err != nil {
+			// in progress
+			continue
+		}
+		this.seen[i] = true
+		if successful {
+			this.nrPassed++
+			continue
+		}
+		this.failures = append(this.failures, i)
+		if this.stopOnFirst && this.stopped == "" {
+			this.stopped = fmt.Sprintf("failure found (%08x)", i)
+		}
+	}
+}
+
+// distance between the ports of the adjacent workers.
+// larger than the distance between restPort and pbPort, so that a REST port of a worker
+// never equals a PB port of another one (e.g. 10080+2k and 10081+2k for the adjacent ports)
+func workerPortStride(restPort, pbPort int) int {
+	if restPort <= 0 || pbPort <= 0 {
+		return 1
+	}
+	if restPort > pbPort {
+		return restPort - pbPort + 1
+	}
+	return pbPort - restPort + 1
+}
+
+// port for the worker k (0 and negative values are kept as is)
+func workerPort(base, k, stride int) int {
+	if base <= 0 {
+		return base
+	}
+	return base + k*stride
+}
+
+// writes each line with the prefix
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+	// shared among the workers
+	mu  *sync.Mutex
+	buf bytes.Buffer
+}
+
+func (this *prefixWriter) Write(p []byte) (int, error) {
+	this.buf.Write(p)
+	for {
+		i := bytes.IndexByte(this.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := this.buf.Next(i + 1)
+		this.mu.Lock()
+		_, err := fmt.Fprintf(this.w, "%s%s", this.prefix, line)
+		this.mu.Unlock()
+		if err != nil {
+			return len(p), err
+		}
+	}
+}
+
+func (this *campaign) worker(k int, cfg config.Config, outMu *sync.Mutex) {
+	args := []string{"run"}
+	// every worker has its own ports, so that the runs do not conflict
+	restPort, pbPort := cfg.GetInt("restPort"), cfg.GetInt("pbPort")
+	stride := workerPortStride(restPort, pbPort)
+	if cfg.IsSet("restPort") {
+		args = append(args, "-rest-port", strconv.Itoa(workerPort(restPort, k, stride)))
+	}
+	if cfg.IsSet("pbPort") {
+		args = append(args, "-pb-port", strconv.Itoa(workerPort(pbPort, k, stride)))
+	}
+	args = append(args, this.storagePath)
+	out := &prefixWriter{prefix: fmt.Sprintf("[worker %d] ", k), w: os.Stdout, mu: outMu}
+	for this.next() {
+		cmd := exec.Command(os.Args[0], args...)
+		cmd.Stdout = out
+		cmd.Stderr = out
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(out, "nmz run failed: %s\n", err)
+			this.mu.Lock()
+			this.nrErrors++
+			this.mu.Unlock()
+		}
+		this.collect()
+	}
+}
+
+func (this *campaign) printSummary(w io.Writer, elapsed time.Duration, parallel int) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	fmt.Fprintf(w, "campaign finished: %d runs in %s (%d workers)\n", this.started, elapsed, parallel)
+	if this.stopped != "" {
+		fmt.Fprintf(w, "  stopped:   %s\n", this.stopped)
+	}
+	fmt.Fprintf(w, "  passed:    %d\n", this.nrPassed)
+	fmt.Fprintf(w, "  failed:    %d\n", len(this.failures))
+	for _, id := range this.failures {
+		fmt.Fprintf(w, "    %08x\n", id)
+	}
+	if this.nrErrors > 0 {
+		fmt.Fprintf(w, "  errors of nmz run: %d\n", this.nrErrors)
+	}
+}
+
+func runCampaign(args []string) int {
+	if err := campaignFlagset.Parse(args); err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+	if campaignFlagset.NArg() != 1 {
+		fmt.Printf("specify <storage dir path>\n")
+		return 1
+	}
+	if _campaignFlags.Runs <= 0 && _campaignFlags.Time <= 0 && !_campaignFlags.StopOnFirstFailure {
+		fmt.Printf("specify -runs, -time or -stop-on-first-failure\n")
+		return 1
+	}
+	if _campaignFlags.Parallel < 1 {
+		fmt.Printf("bad -parallel: %d\n", _campaignFlags.Parallel)
+		return 1
+	}
+	storagePath := campaignFlagset.Arg(0)
+	confPath := path.Join(storagePath, historystorage.StorageTOMLConfigPath)
+	cfg, err := config.NewFromFile(confPath)
+	if err != nil {
+		fmt.Printf("failed to parse config file %s: %s\n", confPath, err)
+		return 1
+	}
+	c, err := newCampaign(storagePath, _campaignFlags.Runs, _campaignFlags.Time, _campaignFlags.StopOnFirstFailure)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+
+	startTime := time.Now()
+	var wg sync.WaitGroup
+	outMu := &sync.Mutex{}
+	for k := 0; k < _campaignFlags.Parallel; k++ {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			c.worker(k, cfg, outMu)
+		}(k)
+	}
+	wg.Wait()
+	c.collect()
+	c.printSummary(os.Stdout, time.Since(startTime), _campaignFlags.Parallel)
+	return 0
+}
+
+type campaignCmd struct {
+}
+
+func (cmd campaignCmd) Help() string {
+	s := `
+The campaign command runs an experiment repeatedly with the workspace (initialized by the init command),
+and prints the summary at the end.
+
+Typical usage:
+     $ nmz init --force config.toml materials /tmp/x
+     $ nmz campaign -runs 100 -parallel 4 -stop-on-first-failure /tmp/x
+
+Options:
+  -runs N:                 number of runs (0: unlimited)
+  -time 8h:                time budget; no run is started after this (0: unlimited)
+  -stop-on-first-failure:  stop starting runs after the first failure
+  -parallel K:             number of parallel workers
+
+Worker k (0 <= k < K) uses "restPort"+k*S and "pbPort"+k*S (unless the port is 0 or negative),
+where S is |"restPort"-"pbPort"|+1 (e.g. 10080+2k and 10081+2k), so the run scripts should use NMZ_ORCHESTRATOR_URL, NMZ_REST_PORT and NMZ_PB_PORT
+instead of hard-coded ports.
+`
+	return s
+}
+
+func (cmd campaignCmd) Run(args []string) int {
+	return runCampaign(args)
+}
+
+func (cmd campaignCmd) Synopsis() string {
+	return "[Expert] Run an experiment repeatedly (in parallel) with the initialized workspace"
+}
+
+func campaignCommandFactory() (mcli.Command, error) {
+	return campaignCmd{}, nil
+}
@@ -0,0 +1,96 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	testutil "github.com/osrg/namazu/nmz/util/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func recordTestRun(t *testing.T, dir string, successful bool) {
+	n := testutil.NewNaiveRun(t, dir, nil)
+	assert.NoError(t, n.RecordResult(successful, time.Second, nil))
+}
+
+func TestCampaign(t *testing.T) {
+	dir := testutil.NewNaiveStorage(t, "test-campaign")
+	defer os.RemoveAll(dir)
+	// a run before the campaign
+	recordTestRun(t, dir, false)
+
+	c, err := newCampaign(dir, 3, 0, true)
+	assert.NoError(t, err)
+	assert.True(t, c.next())
+	recordTestRun(t, dir, true)
+	c.collect()
+	assert.True(t, c.next())
+	recordTestRun(t, dir, false)
+	c.collect()
+	assert.False(t, c.next())
+	assert.Equal(t, 1, c.nrPassed)
+	assert.Equal(t, []int{2}, c.failures)
+	assert.Equal(t, "failure found (00000002)", c.stopped)
+
+	var buf bytes.Buffer
+	c.printSummary(&buf, time.Minute, 1)
+	assert.Contains(t, buf.String(), "campaign finished: 2 runs in 1m0s (1 workers)")
+}
+
+func TestCampaignBudget(t *testing.T) {
+	c := &campaign{runs: 2, seen: make(map[int]bool)}
+	assert.True(t, c.next())
+	assert.True(t, c.next())
+	assert.False(t, c.next())
+	assert.Equal(t, "2 runs done", c.stopped)
+
+	c = &campaign{deadline: time.Now().Add(-time.Second), seen: make(map[int]bool)}
+	assert.False(t, c.next())
+	assert.Equal(t, "time budget exhausted", c.stopped)
+}
+
+func TestWorkerPort(t *testing.T) {
+	assert.Equal(t, 10082, workerPort(10080, 2, 1))
+	assert.Equal(t, 0, workerPort(0, 2, 2))
+	assert.Equal(t, -1, workerPort(-1, 2, 2))
+
+	// the adjacent ports
+	stride := workerPortStride(10080, 10081)
+	assert.Equal(t, 2, stride)
+	ports := make(map[int]bool)
+	for k := 0; k < 4; k++ {
+		for _, base := range []int{10080, 10081} {
+			port := workerPort(base, k, stride)
+			assert.False(t, ports[port], "port %d is used twice", port)
+			ports[port] = true
+		}
+	}
+	assert.Equal(t, 3, workerPortStride(10083, 10081))
+	assert.Equal(t, 1, workerPortStride(10080, 0))
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := &prefixWriter{prefix: "[worker 0] ", w: &buf, mu: &sync.Mutex{}}
+	w.Write([]byte("foo\nba"))
+	w.Write([]byte("r\n"))
+	assert.Equal(t, "[worker 0] foo\n[worker 0] bar\n", buf.String())
+}
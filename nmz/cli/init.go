@@ -209,12 +209,15 @@ func _init(args []string) int {
 		return 1
 	}
 
-	storage, err := historystorage.New(cfg.GetString("storageType"), storagePath)
+	storage, err := historystorage.New(cfg.GetString("storageType"), storagePath, cfg)
 	if err != nil {
 		fmt.Printf("%s\n", err)
 		return 1
 	}
-	storage.CreateStorage()
+	if err = storage.CreateStorage(); err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
 
 	if cfg.GetString("init") != "" {
 		initScriptPath := path.Join(materialsDir, cfg.GetString("init"))
@@ -71,6 +71,17 @@ Ethernet inspector (ethernet)
     Action signals: EventAcceptanceAction, PacketFaultAction
 
 
+Log inspector (log)
+    Tails log files and a syslog socket, and sends the lines that match the rules (name=regexp).
+    The capturing groups of the regexp are set as the options of the event (named groups by name, others as "group1", ..).
+    The events are not deferred, so that the explore policy can react to the milestones of the testee.
+
+    Typical usage: nmz inspectors log -file /var/log/zk.log -syslog udp://:10514 -rule 'leader=LEADING - LEADER ELECTION TOOK - (?P<took>\d+)'
+
+    Event signals: LogEvent
+    Action signals: (none)
+
+
 NOTE: this binary does NOT include the following inspectors:
     Java Inspector:     (included in misc/inspector/java)
     C Inspector:        (included in misc/inspector/c, NOT MAINTAINED)
@@ -87,6 +98,7 @@ func (cmd inspectorsCmd) Run(args []string) int {
 		"proc":     inspectors.ProcCommandFactory,
 		"fs":       inspectors.FsCommandFactory,
 		"ethernet": inspectors.EtherCommandFactory,
+		"log":      inspectors.LogCommandFactory,
 	}
 	c.HelpFunc = func(commands map[string]mcli.CommandFactory) string {
 		s := (mcli.BasicHelpFunc("nmz inspectors"))(commands)
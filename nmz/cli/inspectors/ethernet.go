@@ -83,6 +83,7 @@ func (cmd etherCmd) Run(args []string) int {
 		return 1
 	}
 	log.Infof("Autopilot-mode: %t", autopilot)
+	conditionalStartMetricsServer(_etherFlags.commonFlags)
 
 	var etherInspector inspector.EthernetInspector
 	if useHookSwitch {
@@ -80,6 +80,7 @@ func (cmd fsCmd) Run(args []string) int {
 		return 1
 	}
 	log.Infof("Autopilot-mode: %t", autopilot)
+	conditionalStartMetricsServer(_fsFlags.commonFlags)
 
 	if logutil.Debug {
 		// log level: 0..2
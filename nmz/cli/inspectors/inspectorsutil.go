@@ -18,8 +18,11 @@ package inspectors
 import (
 	"flag"
 	"fmt"
+	"net/http"
 
+	log "github.com/cihub/seelog"
 	"github.com/osrg/namazu/nmz/util/config"
+	"github.com/osrg/namazu/nmz/util/metrics"
 	ocutil "github.com/osrg/namazu/nmz/util/orchestrator"
 )
 
@@ -27,6 +30,7 @@ type commonFlags struct {
 	AutopilotConfig string
 	OrchestratorURL string
 	EntityID        string
+	MetricsAddr     string
 }
 
 func initCommon(f *flag.FlagSet, _f *commonFlags, defaultEntityID string) {
@@ -38,6 +42,9 @@ func initCommon(f *flag.FlagSet, _f *commonFlags, defaultEntityID string) {
 
 	d = fmt.Sprintf("Path to \"config.toml\" for the internal autopilot orchestrator. Valid only if \"orchestrator_url\" is set to \"%s\".", ocutil.LocalOrchestratorURL)
 	f.StringVar(&_f.AutopilotConfig, "autopilot", "", d)
+
+	d = "Address for serving Prometheus metrics on \"/metrics\" (e.g. \":10081\"). Disabled if empty."
+	f.StringVar(&_f.MetricsAddr, "metrics-addr", "", d)
 }
 
 func conditionalStartAutopilotOrchestrator(_f commonFlags) (bool, error) {
@@ -65,3 +72,17 @@ func conditionalStartAutopilotOrchestrator(_f commonFlags) (bool, error) {
 		return true, nil
 	}
 }
+
+func conditionalStartMetricsServer(_f commonFlags) {
+	if _f.MetricsAddr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	log.Infof("Serving metrics on %s", _f.MetricsAddr)
+	go func() {
+		if err := http.ListenAndServe(_f.MetricsAddr, mux); err != nil {
+			log.Errorf("metrics server stopped: %s", err)
+		}
+	}()
+}
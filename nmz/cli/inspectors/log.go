@@ -0,0 +1,129 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inspectors
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/mitchellh/cli"
+
+	inspector "github.com/osrg/namazu/nmz/inspector/logline"
+)
+
+// `-file path` (can be specified multiple times)
+type filesFlag []string
+
+func (f *filesFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *filesFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+// `-rule name=regexp` (can be specified multiple times)
+type rulesFlag []inspector.Rule
+
+func (f *rulesFlag) String() string {
+	s := make([]string, 0, len(*f))
+	for _, rule := range *f {
+		s = append(s, fmt.Sprintf("%s=%s", rule.Name, rule.Regexp))
+	}
+	return strings.Join(s, ",")
+}
+
+func (f *rulesFlag) Set(s string) error {
+	rule, err := inspector.ParseRule(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, rule)
+	return nil
+}
+
+type logFlags struct {
+	commonFlags
+	Files         filesFlag
+	SyslogAddr    string
+	Rules         rulesFlag
+	FromBeginning bool
+	PollInterval  time.Duration
+}
+
+var (
+	logFlagset = flag.NewFlagSet("log", flag.ExitOnError)
+	_logFlags  = logFlags{}
+)
+
+func init() {
+	initCommon(logFlagset, &_logFlags.commonFlags, "_namazu_log_inspector")
+	logFlagset.Var(&_logFlags.Files, "file", "Log file to tail (can be specified multiple times)")
+	logFlagset.StringVar(&_logFlags.SyslogAddr, "syslog", "", "Syslog socket to listen on (e.g. udp://:10514, unixgram:///tmp/nmz-syslog.sock)")
+	logFlagset.Var(&_logFlags.Rules, "rule", "Rule name=regexp for the lines to be sent as LogEvent (can be specified multiple times). The capturing groups are set as the options.")
+	logFlagset.BoolVar(&_logFlags.FromBeginning, "from-beginning", false, "Inspect also the lines already in the files")
+	logFlagset.DurationVar(&_logFlags.PollInterval, "poll-interval", 100*time.Millisecond, "Polling interval for the files")
+}
+
+type logCmd struct {
+}
+
+func LogCommandFactory() (cli.Command, error) {
+	return logCmd{}, nil
+}
+
+func (cmd logCmd) Help() string {
+	return "Please run `nmz --help inspectors` instead"
+}
+
+func (cmd logCmd) Synopsis() string {
+	return "Start log inspector"
+}
+
+func (cmd logCmd) Run(args []string) int {
+	if err := logFlagset.Parse(args); err != nil {
+		log.Critical(err)
+		return 1
+	}
+
+	logInspector, err := inspector.NewLogInspector(_logFlags.OrchestratorURL, _logFlags.EntityID,
+		_logFlags.Rules, _logFlags.Files, _logFlags.SyslogAddr)
+	if err != nil {
+		log.Critical(err)
+		return 1
+	}
+	logInspector.FromBeginning = _logFlags.FromBeginning
+	logInspector.PollInterval = _logFlags.PollInterval
+
+	autopilot, err := conditionalStartAutopilotOrchestrator(_logFlags.commonFlags)
+	if err != nil {
+		log.Critical(err)
+		return 1
+	}
+	log.Infof("Autopilot-mode: %t", autopilot)
+	conditionalStartMetricsServer(_logFlags.commonFlags)
+
+	if err := logInspector.Serve(); err != nil {
+		panic(log.Critical(err))
+	}
+
+	// NOTREACHED
+	return 0
+}
@@ -138,6 +138,7 @@ func (cmd procCmd) Run(args []string) int {
 		return 1
 	}
 	log.Infof("Autopilot-mode: %t", autopilot)
+	conditionalStartMetricsServer(_procFlags.commonFlags)
 
 	procInspector := &inspector.ProcInspector{
 		OrchestratorURL: _procFlags.OrchestratorURL,
@@ -0,0 +1,219 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/cihub/seelog"
+	"github.com/osrg/namazu/nmz/explorepolicy/manual"
+	"github.com/osrg/namazu/nmz/explorepolicy/replayable"
+	"github.com/osrg/namazu/nmz/orchestrator"
+	nmzsignal "github.com/osrg/namazu/nmz/signal"
+	"github.com/osrg/namazu/nmz/util/config"
+	. "github.com/osrg/namazu/nmz/util/trace"
+)
+
+const interactiveHelp = `Commands:
+  l          list pending events
+  r <i>      release the i-th pending event
+  f <i>      inject a fault for the i-th pending event
+  s [n]      release n pending events at random (default: 1)
+  h          show this help
+  q          quit (and save the trace)
+`
+
+// terminal UI for the "manual" policy
+type interactiveUI struct {
+	policy *manual.Manual
+	in     *bufio.Scanner
+	out    io.Writer
+}
+
+func newInteractiveUI(policy *manual.Manual, in io.Reader, out io.Writer) *interactiveUI {
+	return &interactiveUI{
+		policy: policy,
+		in:     bufio.NewScanner(in),
+		out:    out,
+	}
+}
+
+// values longer than this are truncated in the list
+const maxOptionValueLen = 48
+
+func formatOption(event nmzsignal.Event) string {
+	opt, ok := event.JSONMap()["option"].(map[string]interface{})
+	if !ok || len(opt) == 0 {
+		return ""
+	}
+	var keys []string
+	for k := range opt {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var kvs []string
+	for _, k := range keys {
+		v := fmt.Sprintf("%v", opt[k])
+		if len(v) > maxOptionValueLen {
+			v = v[:maxOptionValueLen] + "..."
+		}
+		kvs = append(kvs, fmt.Sprintf("%s=%s", k, v))
+	}
+	return strings.Join(kvs, " ")
+}
+
+func (ui *interactiveUI) list() []nmzsignal.Event {
+	events := ui.policy.PendingEvents()
+	if len(events) == 0 {
+		fmt.Fprintf(ui.out, "no pending events\n")
+	}
+	for i, event := range events {
+		fmt.Fprintf(ui.out, "[%d] %s %s {%s}\n",
+			i, event.EntityID(), event.JSONMap()["class"], formatOption(event))
+	}
+	return events
+}
+
+// parses the index argument of "r" and "f"
+func (ui *interactiveUI) chooseEvent(fields []string) (nmzsignal.Event, error) {
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("specify the index of the event")
+	}
+	i, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	events := ui.policy.PendingEvents()
+	if i < 0 || i >= len(events) {
+		return nil, fmt.Errorf("bad index %d (%d pending events)", i, len(events))
+	}
+	return events[i], nil
+}
+
+func (ui *interactiveUI) printAction(action nmzsignal.Action) {
+	fmt.Fprintf(ui.out, "%s for %s\n", action.JSONMap()["class"], action.EntityID())
+}
+
+// returns false if the operator wants to quit
+func (ui *interactiveUI) handleCommand(line string) (bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true, nil
+	}
+	switch fields[0] {
+	case "l":
+		ui.list()
+	case "r", "f":
+		event, err := ui.chooseEvent(fields)
+		if err != nil {
+			return true, err
+		}
+		var action nmzsignal.Action
+		if fields[0] == "r" {
+			action, err = ui.policy.Release(event.ID())
+		} else {
+			action, err = ui.policy.Fault(event.ID())
+		}
+		if err != nil {
+			return true, err
+		}
+		ui.printAction(action)
+	case "s":
+		n := 1
+		if len(fields) == 2 {
+			var err error
+			if n, err = strconv.Atoi(fields[1]); err != nil {
+				return true, err
+			}
+		}
+		actions, err := ui.policy.StepRandom(n)
+		for _, action := range actions {
+			ui.printAction(action)
+		}
+		if err != nil {
+			return true, err
+		}
+	case "h":
+		fmt.Fprint(ui.out, interactiveHelp)
+	case "q":
+		return false, nil
+	default:
+		return true, fmt.Errorf("unknown command %q (type \"h\" for help)", fields[0])
+	}
+	return true, nil
+}
+
+// runs until the operator quits or the input is closed
+func (ui *interactiveUI) run() {
+	fmt.Fprint(ui.out, interactiveHelp)
+	for {
+		fmt.Fprintf(ui.out, "nmz> ")
+		if !ui.in.Scan() {
+			return
+		}
+		cont, err := ui.handleCommand(ui.in.Text())
+		if err != nil {
+			fmt.Fprintf(ui.out, "error: %s\n", err)
+		}
+		if !cont {
+			return
+		}
+	}
+}
+
+func saveTrace(trace *SingleTrace, tracePath string) error {
+	return SaveTraceFile(tracePath, trace, TraceFormatJSONL)
+}
+
+func runInteractiveOrchestrator(cfg config.Config, tracePath string) int {
+	cfg.Set("explorePolicy", manual.Name)
+	policy := manual.New()
+	if err := policy.LoadConfig(cfg); err != nil {
+		log.Criticalf("%s", err)
+		return 1
+	}
+	orchestrator := orchestrator.NewOrchestrator(cfg, policy, true)
+	orchestrator.Start()
+	log.Infof("Started Orchestrator (interactive)")
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	done := make(chan struct{})
+	go func() {
+		newInteractiveUI(policy, os.Stdin, os.Stdout).run()
+		close(done)
+	}()
+	select {
+	case <-c:
+	case <-done:
+	}
+
+	trace := orchestrator.Shutdown()
+	if err := saveTrace(trace, tracePath); err != nil {
+		log.Criticalf("failed to save trace: %s", err)
+		return 1
+	}
+	log.Infof("Saved the trace (%d actions) to %s (can be replayed with explorePolicy=%q and explorePolicyParam.trace)",
+		len(trace.ActionSequence), tracePath, replayable.Name)
+	return 0
+}
@@ -40,6 +40,7 @@ func CLIMain(args []string) int {
 	c.Commands = map[string]mcli.CommandFactory{
 		"init":         initCommandFactory,
 		"run":          runCommandFactory,
+		"campaign":     campaignCommandFactory,
 		"orchestrator": orchestratorCommandFactory,
 		"inspectors":   inspectorsCommandFactory,
 		"tools":        toolsCommandFactory,
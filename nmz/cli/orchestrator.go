@@ -16,6 +16,7 @@
 package cli
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
@@ -29,6 +30,21 @@ import (
 // defaultRESTPort is used only if no config is specified.
 const defaultRESTPort = 10080
 
+type orchestratorFlags struct {
+	Interactive bool
+	TracePath   string
+}
+
+var (
+	orchestratorFlagset = flag.NewFlagSet("orchestrator", flag.ExitOnError)
+	_orchestratorFlags  = orchestratorFlags{}
+)
+
+func init() {
+	orchestratorFlagset.BoolVar(&_orchestratorFlags.Interactive, "interactive", false, "determine actions by hand (uses the \"manual\" policy)")
+	orchestratorFlagset.StringVar(&_orchestratorFlags.TracePath, "trace-path", "nmz-interactive.trace", "path of trace data file written in the interactive mode")
+}
+
 type orchestratorCmd struct {
 }
 
@@ -39,6 +55,15 @@ Basically you should use "nmz init" and "nmz orchestrator",
 but "nmz orchestrator" is sometimes useful for interactive operation.
 
 If no config was specified, %d is used as a default REST port.
+
+Options:
+  -interactive: hold every deferred event and let you choose which one to
+                release next (or to inject a fault for) on the terminal.
+                The "manual" exploration policy is used regardless of the config.
+  -trace-path:  path of the trace data file written at exit in the interactive mode
+                (default: nmz-interactive.trace). The file can be read by
+                "nmz tools dump-trace", and replayed by the "replayable" policy
+                with explorePolicyParam.trace.
 `, defaultRESTPort)
 	return s
 }
@@ -46,6 +71,11 @@ If no config was specified, %d is used as a default REST port.
 func (cmd orchestratorCmd) Run(args []string) int {
 	var cfg config.Config
 	var err error
+	if err = orchestratorFlagset.Parse(args); err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+	args = orchestratorFlagset.Args()
 	switch len(args) {
 	case 0:
 		cfg = config.New()
@@ -61,6 +91,10 @@ func (cmd orchestratorCmd) Run(args []string) int {
 		return 1
 	}
 
+	if _orchestratorFlags.Interactive {
+		return runInteractiveOrchestrator(cfg, _orchestratorFlags.TracePath)
+	}
+
 	orchestrator, err := ocutil.NewAutopilotOrchestrator(cfg)
 	if err != nil {
 		log.Criticalf("%s", err)
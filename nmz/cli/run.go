@@ -16,7 +16,15 @@
 package cli
 
 import (
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
 	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -28,11 +36,55 @@ import (
 	"github.com/osrg/namazu/nmz/explorepolicy"
 	"github.com/osrg/namazu/nmz/historystorage"
 	"github.com/osrg/namazu/nmz/orchestrator"
+	"github.com/osrg/namazu/nmz/util/artifact"
 	"github.com/osrg/namazu/nmz/util/cmd"
 	"github.com/osrg/namazu/nmz/util/config"
 	logutil "github.com/osrg/namazu/nmz/util/log"
+	restutil "github.com/osrg/namazu/nmz/util/rest"
+	"github.com/osrg/namazu/nmz/util/signature"
+	. "github.com/osrg/namazu/nmz/util/trace"
 )
 
+type runFlags struct {
+	ExplorePolicy string
+	RESTPort      int
+	PBPort        int
+	Labels        labelsFlag
+}
+
+// `-label key=value` (can be specified multiple times)
+type labelsFlag map[string]string
+
+func (f labelsFlag) String() string {
+	return fmt.Sprintf("%v", map[string]string(f))
+}
+
+func (f labelsFlag) Set(s string) error {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("bad label %s (should be key=value)", s)
+	}
+	f[kv[0]] = kv[1]
+	return nil
+}
+
+var (
+	runFlagset = flag.NewFlagSet("run", flag.ExitOnError)
+	_runFlags  = runFlags{Labels: labelsFlag{}}
+)
+
+func init() {
+	runFlagset.StringVar(&_runFlags.ExplorePolicy, "explore-policy", "", "override \"explorePolicy\" in the config (e.g. \"dumb\" for a baseline)")
+	runFlagset.IntVar(&_runFlags.RESTPort, "rest-port", -1, "override \"restPort\" in the config")
+	runFlagset.IntVar(&_runFlags.PBPort, "pb-port", -1, "override \"pbPort\" in the config")
+	runFlagset.Var(_runFlags.Labels, "label", "add a label (key=value) to the result (can be specified multiple times)")
+}
+
+// name of the OTLP-JSON file in the working dir (see "exportOTLPTrace" in the config)
+const otlpTraceFileName = "trace.otlp.json"
+
+const pcapngFileName = "packets.pcapng"
+
 func setRlimit() error {
 	var rLimit syscall.Rlimit
 	err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rLimit)
@@ -59,6 +111,7 @@ type runner struct {
 	runCmd           *exec.Cmd
 	validateCmd      *exec.Cmd
 	cleanCmd         *exec.Cmd
+	signature        *signature.Extractor
 }
 
 // depends on this.storageDirPath
@@ -69,13 +122,25 @@ func (this *runner) initConfig() error {
 	if err != nil {
 		return fmt.Errorf("failed to parse config file %s: %s", confPath, err)
 	}
+	if _runFlags.ExplorePolicy != "" {
+		this.config.Set("explorePolicy", _runFlags.ExplorePolicy)
+	}
+	// only explicitly given flags override the config
+	runFlagset.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "rest-port":
+			this.config.Set("restPort", _runFlags.RESTPort)
+		case "pb-port":
+			this.config.Set("pbPort", _runFlags.PBPort)
+		}
+	})
 	return nil
 }
 
 // depends on initConfig()
 func (this *runner) initStorage() error {
 	var err error
-	this.storage, err = historystorage.New(this.config.GetString("storageType"), this.storageDirPath)
+	this.storage, err = historystorage.New(this.config.GetString("storageType"), this.storageDirPath, this.config)
 	if err != nil {
 		return err
 	}
@@ -95,6 +160,14 @@ func (this *runner) initGlobalLogger() error {
 func (this *runner) initGlobalCmdFactory() error {
 	cmd.DefaultFactory.SetWorkingDir(this.workingDirPath)
 	cmd.DefaultFactory.SetMaterialsDir(this.materialsDirPath)
+	// the ports can differ among parallel runs (see "nmz campaign")
+	if restPort := this.config.GetInt("restPort"); restPort > 0 {
+		cmd.DefaultFactory.SetEnv("NMZ_REST_PORT", strconv.Itoa(restPort))
+		cmd.DefaultFactory.SetEnv("NMZ_ORCHESTRATOR_URL", fmt.Sprintf("http://localhost:%d%s", restPort, restutil.APIRoot))
+	}
+	if pbPort := this.config.GetInt("pbPort"); pbPort > 0 {
+		cmd.DefaultFactory.SetEnv("NMZ_PB_PORT", strconv.Itoa(pbPort))
+	}
 	return nil
 }
 
@@ -119,6 +192,20 @@ func (this *runner) initCmd() error {
 	return nil
 }
 
+// depends on initConfig()
+func (this *runner) initSignature() error {
+	this.signature = signature.NewExtractor()
+	this.signature.NrFrames = this.config.GetInt("failureSignatureFrames")
+	if s := this.config.GetString("failureSignatureRegexp"); s != "" {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return fmt.Errorf("bad failureSignatureRegexp: %s", err)
+		}
+		this.signature.Regexp = re
+	}
+	return nil
+}
+
 // depends on initConfig(), initStorage()
 func (this *runner) initPolicy() error {
 	var err error
@@ -155,12 +242,244 @@ func newRunner(storageDirPath string) (*runner, error) {
 	if err = r.initCmd(); err != nil {
 		return nil, err
 	}
+	if err = r.initSignature(); err != nil {
+		return nil, err
+	}
 	if err = r.initPolicy(); err != nil {
 		return nil, err
 	}
 	return r, nil
 }
 
+func (this *runner) exportOTLPTrace(trace *SingleTrace) error {
+	f, err := os.Create(path.Join(this.workingDirPath, otlpTraceFileName))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return trace.WriteOTLPJSON(f)
+}
+
+// writes the inspected packets to <working dir>/packets.pcapng.
+// nothing is written if the trace contains no packet.
+func (this *runner) exportPcapng(trace *SingleTrace) error {
+	if trace.NrPackets() == 0 {
+		return nil
+	}
+	f, err := os.Create(path.Join(this.workingDirPath, pcapngFileName))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return trace.WritePcapng(f)
+}
+
+// dir for the artifacts in the working dir (see "artifacts" in the config)
+const artifactsDirName = "artifacts"
+
+func teeWriter(orig io.Writer, tail *cmd.TailBuffer) io.Writer {
+	if orig == nil {
+		return tail
+	}
+	return io.MultiWriter(orig, tail)
+}
+
+// captures the output of the command into <working dir>/<name>.{stdout,stderr} if captureOutput is set,
+// and into tail if tail is non-nil.
+// the returned function must be called after the command exited.
+func (this *runner) captureOutput(x *exec.Cmd, name string, tail *cmd.TailBuffer) func() {
+	stdoutPath, stderrPath := "", ""
+	if this.config.GetBool("captureOutput") {
+		stdoutPath = path.Join(this.workingDirPath, name+".stdout")
+		stderrPath = path.Join(this.workingDirPath, name+".stderr")
+	} else if tail == nil {
+		return func() {}
+	}
+	if tail != nil {
+		x.Stdout = teeWriter(x.Stdout, tail)
+		x.Stderr = teeWriter(x.Stderr, tail)
+	}
+	capture, err := cmd.CaptureOutput(x, stdoutPath, stderrPath)
+	if err != nil {
+		// this is not a critical error
+		log.Warnf("failed to capture the output of %s script: %s", name, err)
+		return func() {}
+	}
+	return capture.Close
+}
+
+func (this *runner) collectArtifacts() error {
+	cfg := &artifact.Config{
+		Patterns:     this.config.GetStringSlice("artifacts"),
+		BaseDir:      this.storageDirPath,
+		MaxFileSize:  int64(this.config.GetInt("artifactMaxFileSize")),
+		MaxTotalSize: int64(this.config.GetInt("artifactMaxTotalSize")),
+		Compress:     this.config.GetBool("artifactCompress"),
+	}
+	if len(cfg.Patterns) == 0 {
+		return nil
+	}
+	entries, err := artifact.Collect(cfg, path.Join(this.workingDirPath, artifactsDirName))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Skipped != "" {
+			log.Warnf("Skipped artifact %s: %s", entry.Path, entry.Skipped)
+		} else if entry.Truncated {
+			log.Infof("Collected artifact %s (truncated to the last %d bytes)", entry.Path, entry.Collected)
+		} else {
+			log.Debugf("Collected artifact %s", entry.Path)
+		}
+	}
+	return nil
+}
+
+// size of Result.OutputTail
+const outputTailSize = 4096
+
+// only the last part of a large log file is used for extracting the failure signature
+const maxSignatureFileSize = 1 << 20
+
+// reads the last maxSignatureFileSize bytes of the file
+func readSignatureFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if fi.Size() > maxSignatureFileSize {
+		if _, err = f.Seek(fi.Size()-maxSignatureFileSize, io.SeekStart); err != nil {
+			return "", err
+		}
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(f, maxSignatureFileSize))
+	return string(b), err
+}
+
+// returns the output of the script (name: "run" or "validate") for extracting the failure signature.
+// the files written by captureOutput are used if available, as the stack trace can be longer than tail.
+func (this *runner) scriptOutputs(name string, tail *cmd.TailBuffer) []string {
+	texts := make([]string, 0, 2)
+	if this.config.GetBool("captureOutput") {
+		// exceptions and panics are usually written to stderr
+		for _, ext := range []string{".stderr", ".stdout"} {
+			text, err := readSignatureFile(path.Join(this.workingDirPath, name+ext))
+			if err != nil {
+				log.Warnf("failed to read the output of %s script: %s", name, err)
+				continue
+			}
+			texts = append(texts, text)
+		}
+	}
+	if len(texts) == 0 && tail != nil {
+		texts = append(texts, tail.String())
+	}
+	return texts
+}
+
+// extracts the failure signature from the outputs (e.g. of the validate script and the run script) and failureSignatureFiles
+func (this *runner) extractSignature(outputs ...string) string {
+	texts := append([]string{}, outputs...)
+	for _, pattern := range this.config.GetStringSlice("failureSignatureFiles") {
+		// resolved against the storage dir, as "artifacts" are
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(this.storageDirPath, pattern)
+		}
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			log.Warnf("bad pattern in failureSignatureFiles %s: %s", pattern, err)
+			continue
+		}
+		for _, p := range paths {
+			text, err := readSignatureFile(p)
+			if err != nil {
+				log.Warnf("failed to read %s: %s", p, err)
+				continue
+			}
+			texts = append(texts, text)
+		}
+	}
+	for _, text := range texts {
+		if s := this.signature.Extract(text); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// returns the exit code if err is an exit error of a command (128+n for signal n)
+func exitCode(err error) (int, bool) {
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return 0, false
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok {
+		return 0, false
+	}
+	if status.Signaled() {
+		return 128 + int(status.Signal()), true
+	}
+	return status.ExitStatus(), true
+}
+
+// dumps the stacks of the hung process group
+func (this *runner) dumpStacks(pgid int) {
+	if dumpPath := this.config.GetString("hangDump"); dumpPath != "" {
+		dumpCmd := cmd.DefaultFactory.CreateCmd(path.Join(this.materialsDirPath, dumpPath))
+		dumpCmd.Env = append(dumpCmd.Env, fmt.Sprintf("NMZ_HANG_PGID=%d", pgid))
+		if err := runCommand(dumpCmd); err != nil {
+			log.Warnf("failed to execute hang dump script: %s", err)
+		}
+	} else {
+		log.Infof("Sending SIGQUIT to the process group %d", pgid)
+		if err := syscall.Kill(-pgid, syscall.SIGQUIT); err != nil {
+			log.Warnf("failed to send SIGQUIT: %s", err)
+		}
+	}
+	time.Sleep(this.config.GetDuration("hangDumpWait"))
+}
+
+// runs the run script in a new process group.
+// if runTimeout expires, dumps the stacks, kills the process group, and returns hang=true.
+func (this *runner) runWithTimeout(x *exec.Cmd) (hang bool, err error) {
+	timeout := this.config.GetDuration("runTimeout")
+	if timeout <= 0 {
+		return false, runCommand(x)
+	}
+	x.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	log.Infof("Starting %s %s (timeout: %s)", x.Path, x.Args, timeout)
+	if err = x.Start(); err != nil {
+		return false, err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- x.Wait()
+	}()
+	select {
+	case err = <-done:
+		log.Infof("Finished %s %s", x.Path, x.Args)
+		return false, err
+	case <-time.After(timeout):
+	}
+
+	// the pgid equals to the pid, as Setpgid is set
+	pgid := x.Process.Pid
+	log.Warnf("%s %s did not finish within %s, regarding as hang", x.Path, x.Args, timeout)
+	this.dumpStacks(pgid)
+	log.Infof("Killing the process group %d", pgid)
+	if err = syscall.Kill(-pgid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+		log.Warnf("failed to kill the process group %d: %s", pgid, err)
+	}
+	<-done
+	return true, nil
+}
+
 func runCommand(x *exec.Cmd) error {
 	log.Infof("Starting %s %s", x.Path, x.Args)
 	err := x.Run()
@@ -170,6 +489,11 @@ func runCommand(x *exec.Cmd) error {
 
 func run(args []string) int {
 	// Parse args
+	if err := runFlagset.Parse(args); err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+	args = runFlagset.Args()
 	if len(args) != 1 {
 		fmt.Printf("specify <storage dir path>\n")
 		return 1 // panic() looks ugly for such an expected error
@@ -195,51 +519,122 @@ func run(args []string) int {
 	log.Infof("Started Orchestrator")
 
 	// Run
+	result := &historystorage.Result{
+		Successful:       true,
+		Outcome:          historystorage.OutcomePass,
+		ValidateExitCode: -1,
+		Labels:           _runFlags.Labels,
+	}
 	startTime := time.Now()
-	err = runCommand(runner.runCmd)
+	runTail := cmd.NewTailBuffer(outputTailSize)
+	doneCapture := runner.captureOutput(runner.runCmd, "run", runTail)
+	hang, err := runner.runWithTimeout(runner.runCmd)
 	if err != nil {
-		log.Criticalf("failed to execute run script: %s\n", err)
-		return 1
+		result.Successful = false
+		if _, ok := exitCode(err); ok {
+			log.Warnf("run script crashed: %s", err)
+			result.Outcome = historystorage.OutcomeRunCrash
+		} else {
+			log.Criticalf("failed to execute run script: %s", err)
+			result.Outcome = historystorage.OutcomeInfraError
+		}
 	}
 
 	// Stop orchestrator
 	log.Infof("Shutting down Orchestrator")
 	trace := orchestrator.Shutdown()
 	endTime := time.Now()
-	requiredTime := endTime.Sub(startTime)
+	// this can take a while if background processes hold the output
+	doneCapture()
+	// replaced with the output of the validate script if validated
+	result.OutputTail = runTail.String()
+	result.RequiredTime = endTime.Sub(startTime)
 	log.Infof("Shut down Orchestrator (got %d actions, took %s)",
-		len(trace.ActionSequence), requiredTime)
+		len(trace.ActionSequence), result.RequiredTime)
 
 	// Validate
-	successful := true
-	if runner.validateCmd != nil {
-		if err = runCommand(runner.validateCmd); err != nil {
-			log.Infof("Validation failed: %s", err)
-			// TODO: detailed check of error
-			// e.g. handle a case like permission denied, noent, etc
-			successful = false
+	var validateTail *cmd.TailBuffer
+	if hang {
+		// the testee has been killed, so validation makes no sense
+		result.Successful = false
+		result.Outcome = historystorage.OutcomeHang
+	} else if !result.Successful {
+		log.Infof("Skipping validation (%s)", result.Outcome)
+	} else if runner.validateCmd != nil {
+		validateTail = cmd.NewTailBuffer(outputTailSize)
+		doneCapture = runner.captureOutput(runner.validateCmd, "validate", validateTail)
+		err = runCommand(runner.validateCmd)
+		doneCapture()
+		result.OutputTail = validateTail.String()
+		if err != nil {
+			result.Successful = false
+			if code, ok := exitCode(err); ok {
+				log.Infof("Validation failed: %s", err)
+				result.Outcome = historystorage.OutcomeValidationFailure
+				result.ValidateExitCode = code
+			} else {
+				log.Criticalf("failed to execute validate script: %s", err)
+				result.Outcome = historystorage.OutcomeInfraError
+			}
 		} else {
 			log.Infof("Validation succeeded")
+			result.ValidateExitCode = 0
 		}
 	} else {
 		log.Warn("No validation script provided")
 	}
 
+	if !result.Successful {
+		var outputs []string
+		if validateTail != nil {
+			outputs = runner.scriptOutputs("validate", validateTail)
+		}
+		outputs = append(outputs, runner.scriptOutputs("run", runTail)...)
+		result.Signature = runner.extractSignature(outputs...)
+		log.Infof("Failure signature: %q", result.Signature)
+	}
+
 	// Record
 	runner.storage.RecordNewTrace(trace)
-	runner.storage.RecordResult(successful, requiredTime)
+	if err = historystorage.RecordResult(runner.storage, result); err != nil {
+		log.Criticalf("failed to record the result: %s", err)
+	}
 	runner.storage.Close()
+	if result.Successful && runner.config.GetBool("artifactsOnFailureOnly") {
+		log.Debugf("Skipping artifacts")
+	} else if err = runner.collectArtifacts(); err != nil {
+		// this is not a critical error
+		log.Warnf("failed to collect artifacts: %s", err)
+	}
+	if runner.config.GetBool("exportOTLPTrace") {
+		if err = runner.exportOTLPTrace(trace); err != nil {
+			// this is not a critical error
+			log.Warnf("failed to export OTLP trace: %s", err)
+		}
+	}
+	if runner.config.GetBool("exportPcapng") {
+		if err = runner.exportPcapng(trace); err != nil {
+			// this is not a critical error
+			log.Warnf("failed to export pcapng: %s", err)
+		}
+	}
 
 	// Clean
-	if successful || !runner.config.GetBool("notCleanIfValidationFail") {
+	if result.Successful || !runner.config.GetBool("notCleanIfValidationFail") {
 		if runner.cleanCmd != nil {
-			if err = runCommand(runner.cleanCmd); err != nil {
+			doneCapture = runner.captureOutput(runner.cleanCmd, "clean", nil)
+			err = runCommand(runner.cleanCmd)
+			doneCapture()
+			if err != nil {
 				log.Criticalf("failed to execute clean script: %s", err)
 				return 1
 			}
 		}
 	}
 
+	if result.Outcome == historystorage.OutcomeInfraError {
+		return 1
+	}
 	return 0
 }
 
@@ -256,6 +651,24 @@ Typical usage:
      $ for f in $(seq 1 100);do nmz run /tmp/x; done
      $ nmz tools summary /tmp/x
 
+Options:
+  -explore-policy: override "explorePolicy" in the config (e.g. "dumb" for a baseline)
+  -rest-port, -pb-port: override "restPort" and "pbPort" in the config
+  -label key=value: add a label to the result (can be specified multiple times)
+
+The run, validate and clean scripts can use these environment variables:
+  NMZ_WORKING_DIR, NMZ_MATERIALS_DIR,
+  NMZ_REST_PORT, NMZ_PB_PORT, NMZ_ORCHESTRATOR_URL (if the port is configured)
+
+If "runTimeout" is set in the config, a run script that does not finish in time is
+regarded as a hang. Stack dumps are collected by sending SIGQUIT to the process group
+(or by running the "hangDump" script with NMZ_HANG_PGID), and then the process group
+is killed. The run is recorded as a failure with the "hang" outcome.
+
+The outcome of a run is one of: pass, validation_failure, run_crash, hang, infra_error.
+It is recorded in result.json with the exit code of the validate script, the tail
+of its output (or of the output of the run script if not validated), and the labels. Tools can filter runs with -outcome.
+
 You have to prepare config.toml and the materials directory before running the init command.
 Please also refer to the examples included in the github repository: https://github.com/osrg/namazu/tree/master/example
 
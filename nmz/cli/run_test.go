@@ -0,0 +1,104 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/osrg/namazu/nmz/util/cmd"
+	"github.com/osrg/namazu/nmz/util/config"
+	"github.com/osrg/namazu/nmz/util/signature"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunWithTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-run")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dumped := path.Join(dir, "dumped")
+
+	r := &runner{config: config.New()}
+	r.config.Set("runTimeout", 100*time.Millisecond)
+	r.config.Set("hangDumpWait", 100*time.Millisecond)
+
+	hang, err := r.runWithTimeout(exec.Command("sh", "-c", "true"))
+	assert.NoError(t, err)
+	assert.False(t, hang)
+
+	// the child process ignores SIGQUIT, so it has to be killed
+	script := "trap 'echo dumped > " + dumped + "' QUIT; sh -c 'trap \"\" QUIT; sleep 60' & wait; wait"
+	start := time.Now()
+	hang, err = r.runWithTimeout(exec.Command("sh", "-c", script))
+	assert.NoError(t, err)
+	assert.True(t, hang)
+	assert.True(t, time.Since(start) < 30*time.Second)
+	_, err = os.Stat(dumped)
+	assert.NoError(t, err, "SIGQUIT should be sent")
+}
+
+func TestCaptureOutputTail(t *testing.T) {
+	r := &runner{config: config.New()}
+	r.config.Set("captureOutput", false)
+
+	// the background process holds the output, but the tail is available after the grace period
+	c := exec.Command("sh", "-c", "echo panic: boom >&2; (sleep 60 > /dev/null &); exit 2")
+	tail := cmd.NewTailBuffer(outputTailSize)
+	doneCapture := r.captureOutput(c, "run", tail)
+	err := c.Run()
+	doneCapture()
+	_, ok := exitCode(err)
+	assert.True(t, ok)
+	assert.Equal(t, "panic: boom\n", tail.String())
+}
+
+func TestExtractSignatureFromCapturedOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-run")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	workingDir := path.Join(dir, "00000000")
+	assert.NoError(t, os.Mkdir(workingDir, 0755))
+	r := &runner{config: config.New(), storageDirPath: dir, workingDirPath: workingDir, signature: signature.NewExtractor()}
+
+	// the header of the exception is not in the tail of the deep stack trace
+	var b strings.Builder
+	b.WriteString("Exception in thread \"main\" java.lang.IllegalStateException: leader not found\n")
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&b, "\tat org.example.Cluster.f%d(Cluster.java:%d)\n", i, i)
+	}
+	output := b.String()
+	tail := cmd.NewTailBuffer(outputTailSize)
+	tail.Write([]byte(output))
+	assert.Equal(t, "", r.extractSignature(r.scriptOutputs("run", tail)...))
+
+	r.config.Set("captureOutput", true)
+	assert.NoError(t, ioutil.WriteFile(path.Join(workingDir, "run.stdout"), nil, 0644))
+	assert.NoError(t, ioutil.WriteFile(path.Join(workingDir, "run.stderr"), []byte(output), 0644))
+	assert.Equal(t, "java.lang.IllegalStateException at org.example.Cluster.f0, org.example.Cluster.f1, org.example.Cluster.f2",
+		r.extractSignature(r.scriptOutputs("run", tail)...))
+
+	// failureSignatureFiles are relative to the storage dir
+	assert.NoError(t, os.MkdirAll(path.Join(dir, "materials", "logs"), 0755))
+	assert.NoError(t, ioutil.WriteFile(path.Join(dir, "materials", "logs", "zk.log"), []byte("panic: boom\n"), 0644))
+	r.config.Set("failureSignatureFiles", []string{"materials/logs/*.log"})
+	assert.Equal(t, "panic: boom", r.extractSignature())
+}
@@ -34,9 +34,17 @@ func (cmd toolsCmd) Run(args []string) int {
 	c := mcli.NewCLI("nmz tools", coreutil.NamazuVersion)
 	c.Args = args
 	c.Commands = map[string]mcli.CommandFactory{
-		"visualize":  tools.VisualizeCommandFactory,
-		"dump-trace": tools.DumpTraceCommandFactory,
-		"summary":    tools.SummaryCommandFactory,
+		"visualize":       tools.VisualizeCommandFactory,
+		"dump-trace":      tools.DumpTraceCommandFactory,
+		"summary":         tools.SummaryCommandFactory,
+		"serve":           tools.ServeCommandFactory,
+		"export-otlp":     tools.ExportOTLPCommandFactory,
+		"diff":            tools.DiffCommandFactory,
+		"analyze":         tools.AnalyzeCommandFactory,
+		"reproducibility": tools.ReproducibilityCommandFactory,
+		"gc":              tools.GCCommandFactory,
+		"convert-trace":   tools.ConvertTraceCommandFactory,
+		"import-trace":    tools.ImportTraceCommandFactory,
 	}
 
 	exitStatus, err := c.Run()
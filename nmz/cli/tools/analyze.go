@@ -0,0 +1,339 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/osrg/namazu/nmz/historystorage"
+	. "github.com/osrg/namazu/nmz/signal"
+	signalutil "github.com/osrg/namazu/nmz/util/signal"
+	. "github.com/osrg/namazu/nmz/util/trace"
+)
+
+type analyzeFlags struct {
+	Top        int
+	MinSupport int
+	Window     int
+	NoHint     bool
+	Outcomes   outcomeFilter
+}
+
+var (
+	analyzeFlagset = flag.NewFlagSet("analyze", flag.ExitOnError)
+	_analyzeFlags  = analyzeFlags{Outcomes: outcomeFilter{}}
+)
+
+func init() {
+	analyzeFlagset.IntVar(&_analyzeFlags.Top, "top", 20, "number of features to show")
+	analyzeFlagset.IntVar(&_analyzeFlags.MinSupport, "min-support", 2, "minimum number of failing runs in which the feature is true")
+	analyzeFlagset.IntVar(&_analyzeFlags.Window, "window", 4, "ordering pairs are made between an event and the next N distinct events")
+	analyzeFlagset.BoolVar(&_analyzeFlags.NoHint, "no-hint", false, "identify events without ReplayHint() (only class and entity)")
+	analyzeFlagset.Var(_analyzeFlags.Outcomes, "outcome",
+		"count only the failing runs with these outcomes as failures (comma-separated: validation_failure, run_crash, hang, infra_error). passing runs are always used")
+}
+
+// upper bounds of the delay buckets
+var delayBuckets = []time.Duration{time.Millisecond, 10 * time.Millisecond, 100 * time.Millisecond, time.Second}
+
+func delayBucket(d time.Duration) string {
+	lo := time.Duration(0)
+	for _, hi := range delayBuckets {
+		if d < hi {
+			return fmt.Sprintf("[%s,%s)", lo, hi)
+		}
+		lo = hi
+	}
+	return fmt.Sprintf("[%s,inf)", lo)
+}
+
+func eventKey(event Event, noHint bool) string {
+	key := fmt.Sprintf("%s[%s]", signalutil.EventClass(event), event.EntityID())
+	if hint := event.ReplayHint(); hint != "" && !noHint {
+		if len(hint) > 48 {
+			hint = hint[:45] + "..."
+		}
+		key += fmt.Sprintf("{%s}", hint)
+	}
+	return key
+}
+
+// A site is where a feature (predicate) is evaluated, in the style of statistical debugging (Liblit et al., PLDI 2005).
+// The site is "observed" in a run if the events of the site appear in the run.
+type featureSite struct {
+	// event keys (b is empty for a single event)
+	a, b string
+}
+
+func (this featureSite) observed(keys map[string]bool) bool {
+	return keys[this.a] && (this.b == "" || keys[this.b])
+}
+
+// features of a run, and the set of event keys appeared in the run
+type runFeatures struct {
+	features map[string]featureSite
+	keys     map[string]bool
+}
+
+func (this *runFeatures) add(feature string, site featureSite) {
+	this.features[feature] = site
+}
+
+// extracts the features:
+//   - "fault <action> on <event>"
+//   - "fault on <event X> before <event Z>"
+//   - "<event A> before <event B>" (B is one of the next `window` distinct events after A)
+//   - "<event> delay in [lo,hi)"
+func extractFeatures(trace *SingleTrace, window int, noHint bool) *runFeatures {
+	rf := &runFeatures{
+		features: make(map[string]featureSite),
+		keys:     make(map[string]bool),
+	}
+	// distinct event keys in the order of their first appearance
+	keys := make([]string, 0)
+	faults := make([]string, 0)
+	for _, action := range trace.ActionSequence {
+		event := action.Event()
+		if event == nil {
+			continue
+		}
+		key := eventKey(event, noHint)
+		if !rf.keys[key] {
+			rf.keys[key] = true
+			keys = append(keys, key)
+			for _, fault := range faults {
+				rf.add(fmt.Sprintf("fault on %s before %s", fault, key), featureSite{fault, key})
+			}
+		}
+		if signalutil.IsFaultAction(action) {
+			rf.add(fmt.Sprintf("fault %s on %s", signalutil.ActionClass(action), key), featureSite{a: key})
+			faults = append(faults, key)
+		}
+		if !event.ArrivedTime().IsZero() {
+			delay := action.TriggeredTime().Sub(event.ArrivedTime())
+			rf.add(fmt.Sprintf("%s delay in %s", key, delayBucket(delay)), featureSite{a: key})
+		}
+	}
+	for i, a := range keys {
+		for j := i + 1; j < len(keys) && j <= i+window; j++ {
+			rf.add(fmt.Sprintf("%s before %s", a, keys[j]), featureSite{a, keys[j]})
+		}
+	}
+	return rf
+}
+
+type featureScore struct {
+	feature string
+	site    featureSite
+	// number of failing/successful runs where the feature is true
+	f, s int
+	// number of failing/successful runs where the site is observed
+	fObs, sObs int
+
+	// F(P) / (S(P) + F(P))
+	failure float64
+	// F(P observed) / (S(P observed) + F(P observed))
+	context float64
+	// Failure(P) - Context(P)
+	increase float64
+	// harmonic mean of Increase(P) and log(F(P)) / log(NumF)
+	importance float64
+}
+
+func (this *featureScore) compute(nrFailures int) {
+	this.failure = float64(this.f) / float64(this.f+this.s)
+	if this.fObs+this.sObs > 0 {
+		this.context = float64(this.fObs) / float64(this.fObs+this.sObs)
+	}
+	this.increase = this.failure - this.context
+	sensitivity := 0.0
+	if nrFailures > 1 {
+		sensitivity = math.Log(float64(this.f)) / math.Log(float64(nrFailures))
+	} else if nrFailures == 1 {
+		sensitivity = float64(this.f)
+	}
+	if this.increase > 0 && sensitivity > 0 {
+		this.importance = 2 / (1/this.increase + 1/sensitivity)
+	}
+}
+
+type featureScoresByImportance []*featureScore
+
+func (s featureScoresByImportance) Len() int      { return len(s) }
+func (s featureScoresByImportance) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s featureScoresByImportance) Less(i, j int) bool {
+	if s[i].importance != s[j].importance {
+		return s[i].importance > s[j].importance
+	}
+	if s[i].increase != s[j].increase {
+		return s[i].increase > s[j].increase
+	}
+	return s[i].feature < s[j].feature
+}
+
+type analysis struct {
+	nrFailures, nrSuccesses int
+	// sorted by the importance
+	scores []*featureScore
+}
+
+// ranks the features by how strongly they predict failures
+func analyzeRuns(runs []*runFeatures, successful []bool, minSupport int) *analysis {
+	result := &analysis{}
+	scores := make(map[string]*featureScore)
+	for i, rf := range runs {
+		if successful[i] {
+			result.nrSuccesses++
+		} else {
+			result.nrFailures++
+		}
+		for feature, site := range rf.features {
+			score, ok := scores[feature]
+			if !ok {
+				score = &featureScore{feature: feature, site: site}
+				scores[feature] = score
+			}
+			if successful[i] {
+				score.s++
+			} else {
+				score.f++
+			}
+		}
+	}
+
+	// count observed sites
+	type siteCount struct{ f, s int }
+	sites := make(map[featureSite]*siteCount)
+	for _, score := range scores {
+		sites[score.site] = &siteCount{}
+	}
+	for site, count := range sites {
+		for i, rf := range runs {
+			if !site.observed(rf.keys) {
+				continue
+			}
+			if successful[i] {
+				count.s++
+			} else {
+				count.f++
+			}
+		}
+	}
+
+	for _, score := range scores {
+		if score.f < minSupport {
+			continue
+		}
+		score.fObs, score.sObs = sites[score.site].f, sites[score.site].s
+		score.compute(result.nrFailures)
+		result.scores = append(result.scores, score)
+	}
+	sort.Sort(featureScoresByImportance(result.scores))
+	return result
+}
+
+func printAnalysis(w io.Writer, result *analysis, top int) {
+	fmt.Fprintf(w, "%d runs (%d failures, %d successes), %d features\n",
+		result.nrFailures+result.nrSuccesses, result.nrFailures, result.nrSuccesses, len(result.scores))
+	fmt.Fprintf(w, "%-10s %-8s %-10s %-8s %-8s %s\n", "importance", "increase", "confidence", "support", "in-pass", "feature")
+	for i, score := range result.scores {
+		if i >= top {
+			break
+		}
+		// confidence: Failure(P), support: F(P)
+		fmt.Fprintf(w, "%-10.3f %-8.3f %-10.3f %-8d %-8d %s\n",
+			score.importance, score.increase, score.failure, score.f, score.s, score.feature)
+	}
+}
+
+func analyze(w io.Writer, storage historystorage.HistoryStorage) error {
+	nrStored := storage.NrStoredHistories()
+	runs := make([]*runFeatures, 0, nrStored)
+	successful := make([]bool, 0, nrStored)
+	for i := 0; i < nrStored; i++ {
+		result, err := historystorage.LoadResult(storage, i)
+		if isMissingRun(err) {
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(w, "failed to open history %08x, %s\n", i, err)
+			continue
+		}
+		// passing runs are the baseline regardless of the filter
+		if !result.Successful && !_analyzeFlags.Outcomes.matchResult(result) {
+			continue
+		}
+		trace, err := storage.GetStoredHistory(i)
+		if isMissingRun(err) {
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(w, "failed to open history %08x, %s\n", i, err)
+			continue
+		}
+		runs = append(runs, extractFeatures(trace, _analyzeFlags.Window, _analyzeFlags.NoHint))
+		successful = append(successful, result.Successful)
+	}
+	result := analyzeRuns(runs, successful, _analyzeFlags.MinSupport)
+	if result.nrFailures == 0 {
+		return fmt.Errorf("no failing run found")
+	}
+	printAnalysis(w, result, _analyzeFlags.Top)
+	return nil
+}
+
+type analyzeCmd struct {
+}
+
+func AnalyzeCommandFactory() (cli.Command, error) {
+	return analyzeCmd{}, nil
+}
+
+func (cmd analyzeCmd) Synopsis() string {
+	return "analyze subcommand"
+}
+
+func (cmd analyzeCmd) Help() string {
+	return "Please run `nmz --help tools` instead"
+}
+
+func (cmd analyzeCmd) Run(args []string) int {
+	analyzeFlagset.Parse(args)
+
+	if analyzeFlagset.NArg() != 1 {
+		fmt.Printf("need history storage path\n")
+		return 1
+	}
+	storage, err := historystorage.LoadStorage(analyzeFlagset.Arg(0))
+	if err != nil {
+		fmt.Printf("failed to load history storage %s: %s\n", analyzeFlagset.Arg(0), err)
+		return 1
+	}
+	storage.Init()
+
+	if err := analyze(os.Stdout, storage); err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+	return 0
+}
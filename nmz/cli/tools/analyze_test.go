@@ -0,0 +1,109 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/osrg/namazu/nmz/historystorage"
+	. "github.com/osrg/namazu/nmz/signal"
+	testutil "github.com/osrg/namazu/nmz/util/test"
+	. "github.com/osrg/namazu/nmz/util/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzeRuns(t *testing.T) {
+	runs := make([]*runFeatures, 0)
+	successful := make([]bool, 0)
+	for i := 0; i < 20; i++ {
+		// every 4th run faults "z" and fails
+		fault := i%4 == 0
+		trace := &SingleTrace{
+			ActionSequence: []Action{
+				newTestHintedAction(t, "x", 0, false),
+				newTestHintedAction(t, "z", 0, fault),
+				newTestHintedAction(t, "y", 0, false),
+			},
+		}
+		runs = append(runs, extractFeatures(trace, 4, false))
+		successful = append(successful, !fault)
+	}
+	result := analyzeRuns(runs, successful, 2)
+	assert.Equal(t, 5, result.nrFailures)
+	assert.Equal(t, 15, result.nrSuccesses)
+	top := result.scores[0]
+	assert.True(t, strings.HasPrefix(top.feature, "fault "), top.feature)
+	assert.Equal(t, 5, top.f)
+	assert.Equal(t, 0, top.s)
+	assert.Equal(t, 1.0, top.failure)
+	assert.InDelta(t, 0.75, top.increase, 1e-9)
+	for _, score := range result.scores {
+		if score.feature == `PacketEvent[_namazu_ethernet_inspector]{x} before PacketEvent[_namazu_ethernet_inspector]{y}` {
+			// always true, so it does not predict failures
+			assert.Equal(t, 0.0, score.increase)
+			assert.Equal(t, 0.0, score.importance)
+		}
+	}
+
+	var buf bytes.Buffer
+	printAnalysis(&buf, result, 3)
+	t.Logf("%s", buf.String())
+	assert.Contains(t, buf.String(), "20 runs (5 failures, 15 successes)")
+}
+
+func TestAnalyzeWithOutcome(t *testing.T) {
+	dir := testutil.NewNaiveStorage(t, "test-analyze")
+	defer os.RemoveAll(dir)
+	for i := 0; i < 8; i++ {
+		// every 4th run faults "z" and hangs, and the others fail validation without the fault
+		result := &historystorage.Result{Successful: true, Outcome: historystorage.OutcomePass, ValidateExitCode: 0}
+		switch i % 4 {
+		case 0:
+			result = &historystorage.Result{Outcome: historystorage.OutcomeHang, ValidateExitCode: -1}
+		case 2:
+			result = &historystorage.Result{Outcome: historystorage.OutcomeValidationFailure, ValidateExitCode: 1}
+		}
+		n := testutil.NewNaiveRun(t, dir, &SingleTrace{ActionSequence: []Action{
+			newTestHintedAction(t, "x", 0, false),
+			newTestHintedAction(t, "z", 0, i%4 == 0),
+		}})
+		assert.NoError(t, historystorage.RecordResult(n, result))
+	}
+
+	storage, err := historystorage.LoadStorage(dir)
+	assert.NoError(t, err)
+	storage.Init()
+	defer func() { _analyzeFlags.Outcomes = outcomeFilter{} }()
+	_analyzeFlags.Outcomes = outcomeFilter{}
+	assert.NoError(t, _analyzeFlags.Outcomes.Set("hang"))
+	var buf bytes.Buffer
+	assert.NoError(t, analyze(&buf, storage))
+	t.Logf("%s", buf.String())
+	// the validation failures are not counted, but the passing runs are
+	assert.Contains(t, buf.String(), "6 runs (2 failures, 4 successes)")
+	lines := strings.Split(buf.String(), "\n")
+	assert.Contains(t, lines[2], "fault ")
+}
+
+func TestDelayBucket(t *testing.T) {
+	assert.Equal(t, "[0s,1ms)", delayBucket(0))
+	assert.Equal(t, "[10ms,100ms)", delayBucket(42*time.Millisecond))
+	assert.Equal(t, "[1s,inf)", delayBucket(time.Hour))
+}
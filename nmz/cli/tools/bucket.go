@@ -0,0 +1,89 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/osrg/namazu/nmz/historystorage"
+)
+
+// number of the example run IDs shown for a bucket
+const nrBucketExamples = 5
+
+// failing runs with the same signature (probably the same bug)
+type bucket struct {
+	key      string
+	outcomes map[historystorage.Outcome]int
+	ids      []int
+}
+
+// groups the failing runs into buckets (sorted by the number of the runs)
+func bucketRuns(ids []int, results []*historystorage.Result) []*bucket {
+	m := make(map[string]*bucket)
+	buckets := make([]*bucket, 0)
+	for i, result := range results {
+		if result.Successful {
+			continue
+		}
+		key := result.Bucket()
+		b, ok := m[key]
+		if !ok {
+			b = &bucket{key: key, outcomes: make(map[historystorage.Outcome]int)}
+			m[key] = b
+			buckets = append(buckets, b)
+		}
+		b.outcomes[result.Outcome]++
+		b.ids = append(b.ids, ids[i])
+	}
+	sort.Stable(bucketsByNrRuns(buckets))
+	return buckets
+}
+
+type bucketsByNrRuns []*bucket
+
+func (s bucketsByNrRuns) Len() int           { return len(s) }
+func (s bucketsByNrRuns) Less(i, j int) bool { return len(s[i].ids) > len(s[j].ids) }
+func (s bucketsByNrRuns) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (b *bucket) outcomesString() string {
+	ss := make([]string, 0, len(b.outcomes))
+	for _, o := range historystorage.Outcomes {
+		if n := b.outcomes[o]; n > 0 {
+			ss = append(ss, fmt.Sprintf("%s=%d", o, n))
+		}
+	}
+	return strings.Join(ss, " ")
+}
+
+func printBuckets(w io.Writer, buckets []*bucket, nrFailures, nrRuns int) {
+	fmt.Fprintf(w, "%d failures in %d runs (%d buckets)\n", nrFailures, nrRuns, len(buckets))
+	for _, b := range buckets {
+		examples := make([]string, 0, nrBucketExamples)
+		for _, id := range b.ids {
+			if len(examples) >= nrBucketExamples {
+				examples = append(examples, "..")
+				break
+			}
+			examples = append(examples, fmt.Sprintf("%08x", id))
+		}
+		fmt.Fprintf(w, "%6d  %s\n", len(b.ids), b.key)
+		fmt.Fprintf(w, "        %s, e.g. %s\n", b.outcomesString(), strings.Join(examples, " "))
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/osrg/namazu/nmz/historystorage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketRuns(t *testing.T) {
+	npe := "java.lang.NullPointerException at org.example.Foo.bar"
+	results := []*historystorage.Result{
+		{Successful: true, Outcome: historystorage.OutcomePass},
+		{Outcome: historystorage.OutcomeValidationFailure, Signature: "AssertionError at check"},
+		{Outcome: historystorage.OutcomeValidationFailure, Signature: npe},
+		{Outcome: historystorage.OutcomeHang},
+		{Outcome: historystorage.OutcomeRunCrash, Signature: npe},
+	}
+	buckets := bucketRuns([]int{0, 1, 2, 3, 0x10}, results)
+	assert.Len(t, buckets, 3)
+	assert.Equal(t, npe, buckets[0].key)
+	assert.Equal(t, []int{2, 0x10}, buckets[0].ids)
+	assert.Equal(t, "validation_failure=1 run_crash=1", buckets[0].outcomesString())
+	assert.Equal(t, "AssertionError at check", buckets[1].key)
+	assert.Equal(t, "(hang without signature)", buckets[2].key)
+
+	var buf bytes.Buffer
+	printBuckets(&buf, buckets, 4, 5)
+	assert.Contains(t, buf.String(), "4 failures in 5 runs (3 buckets)\n")
+	assert.Contains(t, buf.String(), "     2  "+npe+"\n        validation_failure=1 run_crash=1, e.g. 00000002 00000010\n")
+}
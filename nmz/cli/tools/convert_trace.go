@@ -0,0 +1,139 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/mitchellh/cli"
+	. "github.com/osrg/namazu/nmz/util/trace"
+)
+
+type convertTraceFlags struct {
+	To      string
+	Storage string
+	DryRun  bool
+}
+
+var (
+	convertTraceFlagset = flag.NewFlagSet("convert-trace", flag.ExitOnError)
+	_convertTraceFlags  = convertTraceFlags{}
+)
+
+func init() {
+	convertTraceFlagset.StringVar(&_convertTraceFlags.To, "to", string(TraceFormatJSONL),
+		fmt.Sprintf("trace format to convert to (%s, %s)", TraceFormatJSONL, TraceFormatGob))
+	convertTraceFlagset.StringVar(&_convertTraceFlags.Storage, "storage", "",
+		"convert the traces of all the runs in the storage in place (instead of <input> <output>)")
+	convertTraceFlagset.BoolVar(&_convertTraceFlags.DryRun, "dry-run", false, "only print what would be done (with -storage)")
+}
+
+// returns the format of the input
+func convertTraceFile(in, out string, to TraceFormat) (TraceFormat, error) {
+	trace, from, err := LoadTraceFile(in)
+	if err != nil {
+		return "", fmt.Errorf("failed to load %s: %s", in, err)
+	}
+	if err = SaveTraceFile(out, trace, to); err != nil {
+		return from, fmt.Errorf("failed to save %s: %s", out, err)
+	}
+	return from, nil
+}
+
+// converts <storage>/<id>/history. the traces already in the format are skipped.
+func convertStorageTraces(w io.Writer, storagePath string, to TraceFormat, dryRun bool) error {
+	paths, err := filepath.Glob(filepath.Join(storagePath, "????????", "history"))
+	if err != nil {
+		return err
+	}
+	nrConverted, nrFailed := 0, 0
+	for _, p := range paths {
+		_, from, err := LoadTraceFile(p)
+		if err != nil {
+			fmt.Fprintf(w, "failed to load %s: %s\n", p, err)
+			nrFailed++
+			continue
+		}
+		if from == to {
+			continue
+		}
+		fmt.Fprintf(w, "converting %s (%s -> %s)\n", p, from, to)
+		if !dryRun {
+			if _, err = convertTraceFile(p, p, to); err != nil {
+				fmt.Fprintf(w, "%s\n", err)
+				nrFailed++
+				continue
+			}
+		}
+		nrConverted++
+	}
+	fmt.Fprintf(w, "%d traces converted, %d skipped\n", nrConverted, len(paths)-nrConverted-nrFailed)
+	if nrFailed > 0 {
+		return fmt.Errorf("failed to convert %d traces", nrFailed)
+	}
+	return nil
+}
+
+type convertTraceCmd struct {
+}
+
+func ConvertTraceCommandFactory() (cli.Command, error) {
+	return convertTraceCmd{}, nil
+}
+
+func (cmd convertTraceCmd) Synopsis() string {
+	return "convert-trace subcommand"
+}
+
+func (cmd convertTraceCmd) Help() string {
+	return "Please run `nmz --help tools` instead"
+}
+
+func (cmd convertTraceCmd) Run(args []string) int {
+	convertTraceFlagset.Parse(args)
+
+	to, err := ParseTraceFormat(_convertTraceFlags.To)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+
+	if _convertTraceFlags.Storage != "" {
+		if convertTraceFlagset.NArg() != 0 {
+			fmt.Printf("-storage cannot be used with <input> <output>\n")
+			return 1
+		}
+		if err = convertStorageTraces(os.Stdout, _convertTraceFlags.Storage, to, _convertTraceFlags.DryRun); err != nil {
+			fmt.Printf("%s\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if convertTraceFlagset.NArg() != 2 {
+		fmt.Printf("specify <input> <output> (or -storage <storage>)\n")
+		return 1
+	}
+	if _, err = convertTraceFile(convertTraceFlagset.Arg(0), convertTraceFlagset.Arg(1), to); err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,61 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	. "github.com/osrg/namazu/nmz/signal"
+	testutil "github.com/osrg/namazu/nmz/util/test"
+	. "github.com/osrg/namazu/nmz/util/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertStorageTraces(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-convert-trace")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	action, err := testutil.NewPacketEvent(t, "entity-0", 0).DefaultFaultAction()
+	assert.NoError(t, err)
+	trace := &SingleTrace{ActionSequence: []Action{action}}
+	for i, format := range []TraceFormat{TraceFormatGob, TraceFormatJSONL} {
+		runDir := path.Join(dir, fmt.Sprintf("%08x", i))
+		assert.NoError(t, os.Mkdir(runDir, 0777))
+		assert.NoError(t, SaveTraceFile(path.Join(runDir, "history"), trace, format))
+	}
+
+	var out bytes.Buffer
+	assert.NoError(t, convertStorageTraces(&out, dir, TraceFormatJSONL, true))
+	assert.Contains(t, out.String(), "1 traces converted, 1 skipped")
+	_, format, err := LoadTraceFile(path.Join(dir, "00000000", "history"))
+	assert.NoError(t, err)
+	assert.Equal(t, TraceFormatGob, format, "dry run")
+
+	out.Reset()
+	assert.NoError(t, convertStorageTraces(&out, dir, TraceFormatJSONL, false))
+	assert.Contains(t, out.String(), "1 traces converted, 1 skipped")
+	converted, format, err := LoadTraceFile(path.Join(dir, "00000000", "history"))
+	assert.NoError(t, err)
+	assert.Equal(t, TraceFormatJSONL, format)
+	assert.Equal(t, action.ID(), converted.ActionSequence[0].ID())
+	assert.Equal(t, action.Event().ID(), converted.ActionSequence[0].Event().ID())
+}
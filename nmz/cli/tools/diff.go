@@ -0,0 +1,422 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/osrg/namazu/nmz/historystorage"
+	"github.com/osrg/namazu/nmz/historystorage/naive"
+	. "github.com/osrg/namazu/nmz/signal"
+	signalutil "github.com/osrg/namazu/nmz/util/signal"
+	. "github.com/osrg/namazu/nmz/util/trace"
+)
+
+type diffFlags struct {
+	Auto            bool
+	TimingThreshold time.Duration
+	Outcomes        outcomeFilter
+}
+
+var (
+	diffFlagset = flag.NewFlagSet("diff", flag.ExitOnError)
+	_diffFlags  = diffFlags{Outcomes: outcomeFilter{}}
+)
+
+func init() {
+	diffFlagset.BoolVar(&_diffFlags.Auto, "auto", false, "compare every failing run against its nearest passing run")
+	diffFlagset.DurationVar(&_diffFlags.TimingThreshold, "timing-threshold", 100*time.Millisecond, "report timing differences larger than this")
+	diffFlagset.Var(_diffFlags.Outcomes, "outcome", "[auto] compare only the failing runs with these outcomes (comma-separated: validation_failure, run_crash, hang, infra_error)")
+}
+
+type diffKind int
+
+const (
+	// the event appears only in A
+	diffOnlyA diffKind = iota
+	// the event appears only in B
+	diffOnlyB
+	// the event appears in both, but in different order
+	diffReordered
+	// the event appears in both, but faulted only in one of them
+	diffFault
+	// the event appears in both, but the delay is different
+	diffTiming
+)
+
+type diffEntry struct {
+	kind diffKind
+	// index in A and B (-1 if not applicable)
+	a, b int
+	// action in A and B (nil if not applicable)
+	actionA, actionB Action
+}
+
+func actionDelay(action Action) time.Duration {
+	event := action.Event()
+	if event == nil || event.ArrivedTime().IsZero() {
+		return 0
+	}
+	return action.TriggeredTime().Sub(event.ArrivedTime())
+}
+
+func describeAction(action Action) string {
+	event := action.Event()
+	if event == nil {
+		return fmt.Sprintf("%s[%s]", signalutil.ActionClass(action), action.EntityID())
+	}
+	s := fmt.Sprintf("%s[%s]", signalutil.EventClass(event), event.EntityID())
+	if hint := event.ReplayHint(); hint != "" {
+		s += fmt.Sprintf(" hint=%q", hint)
+	}
+	if signalutil.IsFaultAction(action) {
+		s += fmt.Sprintf(" -> %s", signalutil.ActionClass(action))
+	}
+	return s
+}
+
+func (this diffEntry) String() string {
+	switch this.kind {
+	case diffOnlyA:
+		return fmt.Sprintf("only in A  #%d: %s", this.a, describeAction(this.actionA))
+	case diffOnlyB:
+		return fmt.Sprintf("only in B  #%d: %s", this.b, describeAction(this.actionB))
+	case diffReordered:
+		return fmt.Sprintf("reordered  #%d -> #%d: %s", this.a, this.b, describeAction(this.actionA))
+	case diffFault:
+		return fmt.Sprintf("fault      #%d, #%d: A: %s, B: %s", this.a, this.b,
+			signalutil.ActionClass(this.actionA), signalutil.ActionClass(this.actionB))
+	case diffTiming:
+		return fmt.Sprintf("timing     #%d, #%d: %s delayed %s in A, %s in B", this.a, this.b,
+			describeAction(this.actionA), actionDelay(this.actionA), actionDelay(this.actionB))
+	default:
+		return fmt.Sprintf("unknown diff %d", this.kind)
+	}
+}
+
+// returns the key of the event of the action (ignoring the UUID and the action class).
+// actions with the same key are regarded as the same event: the same replay hint on the same entity,
+// or the same content if no hint is set.
+func eventKeyOfAction(action Action) string {
+	event := action.Event()
+	if event == nil {
+		return "action " + naive.ActionSignature(action)
+	}
+	if hint := event.ReplayHint(); hint != "" {
+		return fmt.Sprintf("hint %s %q", event.EntityID(), hint)
+	}
+	return "event " + naive.EventSignature(event)
+}
+
+// returns the keys of the events of a and b as small integers, so that they can be compared cheaply
+func eventKeysOfTraces(a, b []Action) ([]int, []int) {
+	ids := make(map[string]int)
+	keys := func(actions []Action) []int {
+		ks := make([]int, len(actions))
+		for i, action := range actions {
+			k := eventKeyOfAction(action)
+			id, ok := ids[k]
+			if !ok {
+				id = len(ids)
+				ids[k] = id
+			}
+			ks[i] = id
+		}
+		return ks
+	}
+	return keys(a), keys(b)
+}
+
+// l[j] = LCS length of a and b[:j]
+func lcsPrefixLengths(a, b []int) []int32 {
+	prev, cur := make([]int32, len(b)+1), make([]int32, len(b)+1)
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else if prev[j+1] >= cur[j] {
+				cur[j+1] = prev[j+1]
+			} else {
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev
+}
+
+// l[j] = LCS length of a and b[j:]
+func lcsSuffixLengths(a, b []int) []int32 {
+	prev, cur := make([]int32, len(b)+1), make([]int32, len(b)+1)
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				cur[j] = prev[j+1] + 1
+			} else if prev[j] >= cur[j+1] {
+				cur[j] = prev[j]
+			} else {
+				cur[j] = cur[j+1]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev
+}
+
+// Hirschberg's algorithm: appends the LCS pairs of a and b (with the offsets) in O(len(a)*len(b)) time and O(len(b)) space
+func hirschberg(a, b []int, offA, offB int, pairs [][2]int) [][2]int {
+	if len(a) == 0 || len(b) == 0 {
+		return pairs
+	}
+	if len(a) == 1 {
+		for j := range b {
+			if b[j] == a[0] {
+				return append(pairs, [2]int{offA, offB + j})
+			}
+		}
+		return pairs
+	}
+	mid := len(a) / 2
+	l, r := lcsPrefixLengths(a[:mid], b), lcsSuffixLengths(a[mid:], b)
+	k, best := 0, int32(-1)
+	for j := 0; j <= len(b); j++ {
+		if l[j]+r[j] > best {
+			k, best = j, l[j]+r[j]
+		}
+	}
+	pairs = hirschberg(a[:mid], b[:k], offA, offB, pairs)
+	return hirschberg(a[mid:], b[k:], offA+mid, offB+k, pairs)
+}
+
+// aligns the keys a and b with LCS, and returns the matched pairs of indices.
+// the common prefix and suffix (usual for the runs of the same test) are matched without LCS.
+func alignTraces(a, b []int) [][2]int {
+	n, m := len(a), len(b)
+	pairs := make([][2]int, 0)
+	p := 0
+	for ; p < n && p < m && a[p] == b[p]; p++ {
+		pairs = append(pairs, [2]int{p, p})
+	}
+	s := 0
+	for s < n-p && s < m-p && a[n-1-s] == b[m-1-s] {
+		s++
+	}
+	pairs = hirschberg(a[p:n-s], b[p:m-s], p, p, pairs)
+	for ; s > 0; s-- {
+		pairs = append(pairs, [2]int{n - s, m - s})
+	}
+	return pairs
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+func diffTraces(a, b *SingleTrace, timingThreshold time.Duration) []diffEntry {
+	actsA, actsB := a.ActionSequence, b.ActionSequence
+	keysA, keysB := eventKeysOfTraces(actsA, actsB)
+	pairs := alignTraces(keysA, keysB)
+	matchedA := make(map[int]bool, len(pairs))
+	matchedB := make(map[int]bool, len(pairs))
+	entries := make([]diffEntry, 0)
+	for _, p := range pairs {
+		i, j := p[0], p[1]
+		matchedA[i] = true
+		matchedB[j] = true
+		actA, actB := actsA[i], actsB[j]
+		if signalutil.IsFaultAction(actA) != signalutil.IsFaultAction(actB) {
+			entries = append(entries, diffEntry{kind: diffFault, a: i, b: j, actionA: actA, actionB: actB})
+		}
+		if absDuration(actionDelay(actA)-actionDelay(actB)) > timingThreshold {
+			entries = append(entries, diffEntry{kind: diffTiming, a: i, b: j, actionA: actA, actionB: actB})
+		}
+	}
+
+	// unmatched events that appear in both traces are reordered ones.
+	// unmatchedB: key -> unmatched indices in B (in ascending order)
+	unmatchedB := make(map[int][]int)
+	for j := range actsB {
+		if !matchedB[j] {
+			unmatchedB[keysB[j]] = append(unmatchedB[keysB[j]], j)
+		}
+	}
+	reorderedB := make(map[int]bool)
+	for i, actA := range actsA {
+		if matchedA[i] {
+			continue
+		}
+		js := unmatchedB[keysA[i]]
+		if len(js) == 0 {
+			entries = append(entries, diffEntry{kind: diffOnlyA, a: i, b: -1, actionA: actA})
+			continue
+		}
+		j := js[0]
+		unmatchedB[keysA[i]] = js[1:]
+		reorderedB[j] = true
+		actB := actsB[j]
+		entries = append(entries, diffEntry{kind: diffReordered, a: i, b: j, actionA: actA, actionB: actB})
+		if signalutil.IsFaultAction(actA) != signalutil.IsFaultAction(actB) {
+			entries = append(entries, diffEntry{kind: diffFault, a: i, b: j, actionA: actA, actionB: actB})
+		}
+	}
+	for j, actB := range actsB {
+		if !matchedB[j] && !reorderedB[j] {
+			entries = append(entries, diffEntry{kind: diffOnlyB, a: -1, b: j, actionB: actB})
+		}
+	}
+	return entries
+}
+
+func printDiff(w io.Writer, entries []diffEntry) {
+	faultsOnlyA, faultsOnlyB := 0, 0
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\n", entry)
+		switch {
+		case entry.kind == diffOnlyA && signalutil.IsFaultAction(entry.actionA),
+			entry.kind == diffFault && signalutil.IsFaultAction(entry.actionA):
+			faultsOnlyA++
+		case entry.kind == diffOnlyB && signalutil.IsFaultAction(entry.actionB),
+			entry.kind == diffFault && signalutil.IsFaultAction(entry.actionB):
+			faultsOnlyB++
+		}
+	}
+	fmt.Fprintf(w, "%d differences (faults only in A: %d, faults only in B: %d)\n", len(entries), faultsOnlyA, faultsOnlyB)
+}
+
+func diffStoredRuns(w io.Writer, storage historystorage.HistoryStorage, idA, idB int) error {
+	a, err := storage.GetStoredHistory(idA)
+	if err != nil {
+		return fmt.Errorf("failed to open history %08x, %s", idA, err)
+	}
+	b, err := storage.GetStoredHistory(idB)
+	if err != nil {
+		return fmt.Errorf("failed to open history %08x, %s", idB, err)
+	}
+	fmt.Fprintf(w, "--- A: %08x (%d actions)\n", idA, len(a.ActionSequence))
+	fmt.Fprintf(w, "+++ B: %08x (%d actions)\n", idB, len(b.ActionSequence))
+	printDiff(w, diffTraces(a, b, _diffFlags.TimingThreshold))
+	return nil
+}
+
+// returns the passing run nearest to the run id (-1 if none)
+func nearestPassingRun(successful []bool, id int) int {
+	for d := 1; d < len(successful); d++ {
+		for _, j := range []int{id - d, id + d} {
+			if j >= 0 && j < len(successful) && successful[j] {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+func autoDiff(w io.Writer, storage historystorage.HistoryStorage) error {
+	nrStored := storage.NrStoredHistories()
+	successful := make([]bool, nrStored)
+	matched := make([]bool, nrStored)
+	for i := 0; i < nrStored; i++ {
+		result, err := historystorage.LoadResult(storage, i)
+		if isMissingRun(err) {
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(w, "failed to open history %08x, %s\n", i, err)
+			continue
+		}
+		successful[i] = result.Successful
+		matched[i] = _diffFlags.Outcomes.matchResult(result)
+	}
+	for i := 0; i < nrStored; i++ {
+		if successful[i] || !matched[i] {
+			continue
+		}
+		j := nearestPassingRun(successful, i)
+		if j < 0 {
+			return fmt.Errorf("no passing run found")
+		}
+		fmt.Fprintf(w, "=== %08x (failure) vs %08x (success)\n", i, j)
+		if err := diffStoredRuns(w, storage, i, j); err != nil {
+			fmt.Fprintf(w, "%s\n", err)
+		}
+	}
+	return nil
+}
+
+type diffCmd struct {
+}
+
+func DiffCommandFactory() (cli.Command, error) {
+	return diffCmd{}, nil
+}
+
+func (cmd diffCmd) Synopsis() string {
+	return "diff subcommand"
+}
+
+func (cmd diffCmd) Help() string {
+	return "Please run `nmz --help tools` instead"
+}
+
+func (cmd diffCmd) Run(args []string) int {
+	diffFlagset.Parse(args)
+
+	if diffFlagset.NArg() < 1 {
+		fmt.Printf("need history storage path\n")
+		return 1
+	}
+	storage, err := historystorage.LoadStorage(diffFlagset.Arg(0))
+	if err != nil {
+		fmt.Printf("failed to load history storage %s: %s\n", diffFlagset.Arg(0), err)
+		return 1
+	}
+	storage.Init()
+
+	if _diffFlags.Auto {
+		if err := autoDiff(os.Stdout, storage); err != nil {
+			fmt.Printf("%s\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if diffFlagset.NArg() != 3 {
+		fmt.Printf("need history storage path and two run IDs (or -auto)\n")
+		return 1
+	}
+	idA, err := parseRunID(diffFlagset.Arg(1))
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+	idB, err := parseRunID(diffFlagset.Arg(2))
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+	if err = diffStoredRuns(os.Stdout, storage, idA, idB); err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,123 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"time"
+
+	. "github.com/osrg/namazu/nmz/signal"
+	. "github.com/osrg/namazu/nmz/util/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestHintedAction(t *testing.T, hint string, delay time.Duration, fault bool) Action {
+	now := time.Now()
+	action := newTestPacketAction(t, "a", "b", now, now.Add(delay), fault)
+	action.Event().(interface {
+		SetReplayHint(string)
+	}).SetReplayHint(hint)
+	return action
+}
+
+func TestDiffTraces(t *testing.T) {
+	a := &SingleTrace{
+		ActionSequence: []Action{
+			newTestHintedAction(t, "x", 0, false),
+			newTestHintedAction(t, "y", 0, false),
+			newTestHintedAction(t, "z", 0, true),
+			newTestHintedAction(t, "w", 0, false),
+		},
+	}
+	b := &SingleTrace{
+		ActionSequence: []Action{
+			newTestHintedAction(t, "y", 0, false),
+			newTestHintedAction(t, "x", 0, false),
+			newTestHintedAction(t, "z", 0, false),
+			newTestHintedAction(t, "w", time.Second, false),
+			newTestHintedAction(t, "v", 0, false),
+		},
+	}
+	entries := diffTraces(a, b, 100*time.Millisecond)
+	kinds := make(map[diffKind][]diffEntry)
+	for _, entry := range entries {
+		kinds[entry.kind] = append(kinds[entry.kind], entry)
+	}
+	assert.Len(t, kinds[diffReordered], 1)
+	assert.Len(t, kinds[diffFault], 1)
+	assert.Equal(t, 2, kinds[diffFault][0].a)
+	assert.Len(t, kinds[diffTiming], 1)
+	assert.Equal(t, 3, kinds[diffTiming][0].a)
+	assert.Len(t, kinds[diffOnlyA], 0)
+	assert.Len(t, kinds[diffOnlyB], 1)
+	assert.Equal(t, 4, kinds[diffOnlyB][0].b)
+
+	var buf bytes.Buffer
+	printDiff(&buf, entries)
+	t.Logf("%s", buf.String())
+	assert.Contains(t, buf.String(), "faults only in A: 1, faults only in B: 0")
+}
+
+// classic O(n*m) table, for checking alignTraces()
+func lcsLength(a, b []int) int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	return lcs[0][0]
+}
+
+func TestAlignTraces(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	for k := 0; k < 200; k++ {
+		a, b := make([]int, rnd.Intn(30)), make([]int, rnd.Intn(30))
+		for i := range a {
+			a[i] = rnd.Intn(5)
+		}
+		for j := range b {
+			b[j] = rnd.Intn(5)
+		}
+		pairs := alignTraces(a, b)
+		assert.Equal(t, lcsLength(a, b), len(pairs), "a=%v, b=%v", a, b)
+		for i, p := range pairs {
+			assert.Equal(t, a[p[0]], b[p[1]])
+			if i > 0 {
+				assert.True(t, p[0] > pairs[i-1][0] && p[1] > pairs[i-1][1], "pairs=%v", pairs)
+			}
+		}
+	}
+}
+
+func TestNearestPassingRun(t *testing.T) {
+	successful := []bool{true, false, false, false, true}
+	assert.Equal(t, 0, nearestPassingRun(successful, 1))
+	assert.Equal(t, 0, nearestPassingRun(successful, 2))
+	assert.Equal(t, 4, nearestPassingRun(successful, 3))
+	assert.Equal(t, -1, nearestPassingRun([]bool{false}, 0))
+}
@@ -16,10 +16,10 @@
 package tools
 
 import (
-	"encoding/gob"
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 	"time"
 
@@ -30,6 +30,7 @@ import (
 
 type dumpTraceFlags struct {
 	TracePath string
+	Format    string
 }
 
 var (
@@ -39,6 +40,7 @@ var (
 
 func init() {
 	dumpTraceFlagset.StringVar(&_dumpTraceFlags.TracePath, "trace-path", "", "path of trace data file")
+	dumpTraceFlagset.StringVar(&_dumpTraceFlags.Format, "format", formatText, formatUsage)
 }
 
 func dumpMap(m map[string]interface{}, desc string) {
@@ -119,17 +121,24 @@ func (cmd dumpTraceCmd) Run(args []string) int {
 		return 1
 	}
 
-	file, err := os.Open(_dumpTraceFlags.TracePath)
-	if err != nil {
-		fmt.Printf("failed to open trace data file(%s): %s\n", _dumpTraceFlags.TracePath, err)
+	if err := checkFormat(_dumpTraceFlags.Format); err != nil {
+		fmt.Printf("%s\n", err)
 		return 1
 	}
-	var trace SingleTrace
-	if err = gob.NewDecoder(file).Decode(&trace); err != nil {
-		fmt.Printf("failed to decode trace file(%s): %s\n", _dumpTraceFlags.TracePath, err)
+
+	trace, err := loadTraceFile(_dumpTraceFlags.TracePath)
+	if err != nil {
+		fmt.Printf("%s\n", err)
 		return 1
 	}
 
-	doDumpTrace(&trace)
+	if _dumpTraceFlags.Format != formatText {
+		if err = writeActions(os.Stdout, _dumpTraceFlags.Format, filepath.Base(_dumpTraceFlags.TracePath), trace); err != nil {
+			fmt.Printf("%s\n", err)
+			return 1
+		}
+		return 0
+	}
+	doDumpTrace(trace)
 	return 0
 }
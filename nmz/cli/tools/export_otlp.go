@@ -0,0 +1,102 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mitchellh/cli"
+	"github.com/osrg/namazu/nmz/historystorage"
+	. "github.com/osrg/namazu/nmz/util/trace"
+)
+
+type exportOTLPFlags struct {
+	TracePath  string
+	OutputPath string
+}
+
+var (
+	exportOTLPFlagset = flag.NewFlagSet("export-otlp", flag.ExitOnError)
+	_exportOTLPFlags  = exportOTLPFlags{}
+)
+
+func init() {
+	exportOTLPFlagset.StringVar(&_exportOTLPFlags.TracePath, "trace-path", "", "path of trace data file (instead of <storage> <id>)")
+	exportOTLPFlagset.StringVar(&_exportOTLPFlags.OutputPath, "o", "", "output OTLP-JSON file (default: stdout)")
+}
+
+func loadExportedTrace() (*SingleTrace, error) {
+	if _exportOTLPFlags.TracePath != "" {
+		return loadTraceFile(_exportOTLPFlags.TracePath)
+	}
+	if exportOTLPFlagset.NArg() != 2 {
+		return nil, fmt.Errorf("need history storage path and run ID (or -trace-path)")
+	}
+	id, err := parseRunID(exportOTLPFlagset.Arg(1))
+	if err != nil {
+		return nil, err
+	}
+	storage, err := historystorage.LoadStorage(exportOTLPFlagset.Arg(0))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load history storage %s: %s", exportOTLPFlagset.Arg(0), err)
+	}
+	storage.Init()
+	return storage.GetStoredHistory(id)
+}
+
+type exportOTLPCmd struct {
+}
+
+func ExportOTLPCommandFactory() (cli.Command, error) {
+	return exportOTLPCmd{}, nil
+}
+
+func (cmd exportOTLPCmd) Synopsis() string {
+	return "export-otlp subcommand"
+}
+
+func (cmd exportOTLPCmd) Help() string {
+	return "Please run `nmz --help tools` instead"
+}
+
+func (cmd exportOTLPCmd) Run(args []string) int {
+	exportOTLPFlagset.Parse(args)
+
+	trace, err := loadExportedTrace()
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+
+	var w io.Writer = os.Stdout
+	if _exportOTLPFlags.OutputPath != "" {
+		f, err := os.Create(_exportOTLPFlags.OutputPath)
+		if err != nil {
+			fmt.Printf("%s\n", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	if err = trace.WriteOTLPJSON(w); err != nil {
+		fmt.Printf("failed to export trace: %s\n", err)
+		return 1
+	}
+	return 0
+}
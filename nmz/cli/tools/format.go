@@ -0,0 +1,372 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/osrg/namazu/nmz/historystorage"
+	. "github.com/osrg/namazu/nmz/signal"
+	signalutil "github.com/osrg/namazu/nmz/util/signal"
+	. "github.com/osrg/namazu/nmz/util/trace"
+)
+
+// output formats (`-format`)
+const (
+	formatText  = "text"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+	formatJUnit = "junit"
+)
+
+const formatUsage = "output format (text, json, csv, junit)"
+
+func checkFormat(format string) error {
+	switch format {
+	case formatText, formatJSON, formatCSV, formatJUnit:
+		return nil
+	}
+	return fmt.Errorf("unknown format: %s", format)
+}
+
+// the version of the schema of runRecord and actionRecord.
+// must be incremented on incompatible changes.
+const recordSchemaVersion = 1
+
+// machine-readable result of a run
+type runRecord struct {
+	// "%08x"
+	ID             string  `json:"id"`
+	Successful     bool    `json:"successful"`
+	RequiredTimeMS float64 `json:"required_time_ms"`
+	NrActions      int     `json:"nr_actions"`
+	NrFaults       int     `json:"nr_faults"`
+	// action class -> count
+	Actions map[string]int `json:"actions"`
+	// fault action class -> count
+	Faults map[string]int `json:"faults"`
+	// non-empty if the run could not be loaded
+	Error string `json:"error,omitempty"`
+
+	Outcome string `json:"outcome,omitempty"`
+	// -1 if the validate script was not executed
+	ValidateExitCode int               `json:"validate_exit_code"`
+	OutputTail       string            `json:"output_tail,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	Signature        string            `json:"signature,omitempty"`
+
+	// for `visualize -mode gnuplot`
+	Unique         *bool `json:"unique,omitempty"`
+	NrUniqueTraces *int  `json:"nr_unique_traces,omitempty"`
+}
+
+func countActions(trace *SingleTrace) (actions, faults map[string]int) {
+	actions = make(map[string]int)
+	faults = make(map[string]int)
+	for _, action := range trace.ActionSequence {
+		class := signalutil.ActionClass(action)
+		actions[class]++
+		if signalutil.IsFaultAction(action) {
+			faults[class]++
+		}
+	}
+	return actions, faults
+}
+
+func newRunRecord(storage historystorage.HistoryStorage, id int) *runRecord {
+	record := &runRecord{
+		ID:               fmt.Sprintf("%08x", id),
+		Actions:          make(map[string]int),
+		Faults:           make(map[string]int),
+		ValidateExitCode: -1,
+	}
+	result, err := historystorage.LoadResult(storage, id)
+	if err != nil {
+		record.Error = err.Error()
+		return record
+	}
+	record.Successful = result.Successful
+	record.RequiredTimeMS = float64(result.RequiredTime) / float64(time.Millisecond)
+	record.Outcome = string(result.Outcome)
+	record.ValidateExitCode = result.ValidateExitCode
+	record.OutputTail = result.OutputTail
+	record.Labels = result.Labels
+	record.Signature = result.Signature
+	trace, err := storage.GetStoredHistory(id)
+	if err != nil {
+		record.Error = err.Error()
+		return record
+	}
+	record.NrActions = len(trace.ActionSequence)
+	record.Actions, record.Faults = countActions(trace)
+	for _, n := range record.Faults {
+		record.NrFaults += n
+	}
+	return record
+}
+
+// "class1=n1;class2=n2" (sorted by class)
+func formatCounts(m map[string]int) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	ss := make([]string, 0, len(keys))
+	for _, k := range keys {
+		ss = append(ss, fmt.Sprintf("%s=%d", k, m[k]))
+	}
+	return strings.Join(ss, ";")
+}
+
+// "key1=value1;key2=value2" (sorted by key)
+func formatLabels(m map[string]string) string {
+	ss := make([]string, 0, len(m))
+	for k, v := range m {
+		ss = append(ss, k+"="+v)
+	}
+	sort.Strings(ss)
+	return strings.Join(ss, ";")
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeRunsJSON(w io.Writer, records []*runRecord) error {
+	return writeJSON(w, map[string]interface{}{
+		"schema_version": recordSchemaVersion,
+		"runs":           records,
+	})
+}
+
+func writeRunsCSV(w io.Writer, records []*runRecord) error {
+	withUnique := len(records) > 0 && records[0].Unique != nil
+	header := []string{"id", "successful", "required_time_ms", "nr_actions", "nr_faults", "actions", "faults", "error",
+		"outcome", "validate_exit_code", "labels", "signature"}
+	if withUnique {
+		header = append(header, "unique", "nr_unique_traces")
+	}
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	for _, r := range records {
+		row := []string{r.ID, strconv.FormatBool(r.Successful), formatFloat(r.RequiredTimeMS),
+			strconv.Itoa(r.NrActions), strconv.Itoa(r.NrFaults),
+			formatCounts(r.Actions), formatCounts(r.Faults), r.Error,
+			r.Outcome, strconv.Itoa(r.ValidateExitCode), formatLabels(r.Labels), r.Signature}
+		if withUnique {
+			row = append(row, strconv.FormatBool(*r.Unique), strconv.Itoa(*r.NrUniqueTraces))
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// JUnit XML (as consumed by Jenkins, GitLab, ..)
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func writeJUnit(w io.Writer, suite junitTestSuite) error {
+	suite.Tests = len(suite.Cases)
+	total := 0.0
+	for _, c := range suite.Cases {
+		if c.Failure != nil {
+			suite.Failures++
+		}
+		if c.Error != nil {
+			suite.Errors++
+		}
+		t, _ := strconv.ParseFloat(c.Time, 64)
+		total += t
+	}
+	suite.Time = formatFloat(total)
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func writeRunsJUnit(w io.Writer, suiteName string, records []*runRecord) error {
+	suite := junitTestSuite{Name: suiteName}
+	for _, r := range records {
+		c := junitTestCase{
+			Name:      r.ID,
+			ClassName: "nmz." + suiteName,
+			Time:      formatFloat(r.RequiredTimeMS / 1000),
+			SystemOut: fmt.Sprintf("actions: %s\nfaults: %s\n", formatCounts(r.Actions), formatCounts(r.Faults)),
+		}
+		if r.Error != "" {
+			c.Error = &junitMessage{Message: r.Error, Type: "error"}
+		} else if r.Outcome == string(historystorage.OutcomeInfraError) {
+			c.Error = &junitMessage{Message: r.Outcome, Type: r.Outcome, Text: r.OutputTail}
+		} else if !r.Successful {
+			message := r.Outcome
+			if message == "" {
+				message = "validation failed"
+			}
+			if r.Signature != "" {
+				message += ": " + r.Signature
+			}
+			c.Failure = &junitMessage{Message: message, Type: "failure", Text: r.OutputTail}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	return writeJUnit(w, suite)
+}
+
+// writes records in the format (except formatText)
+func writeRuns(w io.Writer, format, suiteName string, records []*runRecord) error {
+	switch format {
+	case formatJSON:
+		return writeRunsJSON(w, records)
+	case formatCSV:
+		return writeRunsCSV(w, records)
+	case formatJUnit:
+		return writeRunsJUnit(w, suiteName, records)
+	}
+	return fmt.Errorf("unsupported format: %s", format)
+}
+
+// machine-readable action in a trace
+type actionRecord struct {
+	Index         int    `json:"index"`
+	ActionClass   string `json:"action_class"`
+	Entity        string `json:"entity"`
+	Fault         bool   `json:"fault"`
+	TriggeredTime string `json:"triggered_time"`
+	// empty if the action has no event
+	EventClass  string                 `json:"event_class,omitempty"`
+	EventEntity string                 `json:"event_entity,omitempty"`
+	ArrivedTime string                 `json:"arrived_time,omitempty"`
+	DelayMS     float64                `json:"delay_ms"`
+	ReplayHint  string                 `json:"replay_hint,omitempty"`
+	Option      map[string]interface{} `json:"option,omitempty"`
+	EventOption map[string]interface{} `json:"event_option,omitempty"`
+}
+
+func newActionRecord(i int, action Action) *actionRecord {
+	record := &actionRecord{
+		Index:         i,
+		ActionClass:   signalutil.ActionClass(action),
+		Entity:        action.EntityID(),
+		Fault:         signalutil.IsFaultAction(action),
+		TriggeredTime: action.TriggeredTime().Format(time.RFC3339Nano),
+	}
+	record.Option, _ = action.JSONMap()["option"].(map[string]interface{})
+	event := action.Event()
+	if event == nil {
+		return record
+	}
+	record.EventClass = signalutil.EventClass(event)
+	record.EventEntity = event.EntityID()
+	record.ArrivedTime = event.ArrivedTime().Format(time.RFC3339Nano)
+	record.DelayMS = float64(actionDelay(action)) / float64(time.Millisecond)
+	record.ReplayHint = event.ReplayHint()
+	record.EventOption, _ = event.JSONMap()["option"].(map[string]interface{})
+	return record
+}
+
+// writes actions of the trace in the format (except formatText)
+func writeActions(w io.Writer, format, suiteName string, trace *SingleTrace) error {
+	records := make([]*actionRecord, 0, len(trace.ActionSequence))
+	for i, action := range trace.ActionSequence {
+		records = append(records, newActionRecord(i, action))
+	}
+	switch format {
+	case formatJSON:
+		return writeJSON(w, map[string]interface{}{
+			"schema_version": recordSchemaVersion,
+			"actions":        records,
+		})
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"index", "action_class", "entity", "fault", "triggered_time",
+			"event_class", "event_entity", "arrived_time", "delay_ms", "replay_hint"})
+		for _, r := range records {
+			cw.Write([]string{strconv.Itoa(r.Index), r.ActionClass, r.Entity, strconv.FormatBool(r.Fault), r.TriggeredTime,
+				r.EventClass, r.EventEntity, r.ArrivedTime, formatFloat(r.DelayMS), r.ReplayHint})
+		}
+		cw.Flush()
+		return cw.Error()
+	case formatJUnit:
+		// a test case per action. the time of the test case is the delay of the action.
+		suite := junitTestSuite{Name: suiteName}
+		for _, r := range records {
+			name := fmt.Sprintf("%d %s", r.Index, r.ActionClass)
+			if r.EventClass != "" {
+				name = fmt.Sprintf("%d %s -> %s", r.Index, r.EventClass, r.ActionClass)
+			}
+			c := junitTestCase{
+				Name:      name,
+				ClassName: "nmz." + r.Entity,
+				Time:      formatFloat(r.DelayMS / 1000),
+			}
+			if r.ReplayHint != "" {
+				c.SystemOut = fmt.Sprintf("replay_hint: %s\n", r.ReplayHint)
+			}
+			suite.Cases = append(suite.Cases, c)
+		}
+		return writeJUnit(w, suite)
+	}
+	return fmt.Errorf("unsupported format: %s", format)
+}
@@ -0,0 +1,109 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	. "github.com/osrg/namazu/nmz/signal"
+	. "github.com/osrg/namazu/nmz/util/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+func testRunRecords(t *testing.T) []*runRecord {
+	trace := &SingleTrace{
+		ActionSequence: []Action{
+			newTestHintedAction(t, "x", 0, false),
+			newTestHintedAction(t, "y", time.Millisecond, true),
+		},
+	}
+	actions, faults := countActions(trace)
+	return []*runRecord{
+		{ID: "00000000", Successful: true, RequiredTimeMS: 1500, NrActions: 2, NrFaults: 1, Actions: actions, Faults: faults,
+			Outcome: "pass", ValidateExitCode: 0, Labels: map[string]string{"commit": "abc", "node": "n1"}},
+		{ID: "00000001", Successful: false, RequiredTimeMS: 500, Actions: map[string]int{}, Faults: map[string]int{},
+			Outcome: "validation_failure", ValidateExitCode: 1, OutputTail: "assertion failed\n", Signature: "AssertionError"},
+		{ID: "00000002", Error: "not found", Actions: map[string]int{}, Faults: map[string]int{}, ValidateExitCode: -1},
+	}
+}
+
+func TestWriteRuns(t *testing.T) {
+	records := testRunRecords(t)
+	assert.Equal(t, map[string]int{"EventAcceptanceAction": 1, "PacketFaultAction": 1}, records[0].Actions)
+	assert.Equal(t, map[string]int{"PacketFaultAction": 1}, records[0].Faults)
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeRuns(&buf, formatJSON, "x", records))
+	var decoded struct {
+		SchemaVersion int          `json:"schema_version"`
+		Runs          []*runRecord `json:"runs"`
+	}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, recordSchemaVersion, decoded.SchemaVersion)
+	assert.Equal(t, records, decoded.Runs)
+
+	buf.Reset()
+	assert.NoError(t, writeRuns(&buf, formatCSV, "x", records))
+	assert.Equal(t, "id,successful,required_time_ms,nr_actions,nr_faults,actions,faults,error,outcome,validate_exit_code,labels,signature\n"+
+		"00000000,true,1500,2,1,EventAcceptanceAction=1;PacketFaultAction=1,PacketFaultAction=1,,pass,0,commit=abc;node=n1,\n"+
+		"00000001,false,500,0,0,,,,validation_failure,1,,AssertionError\n"+
+		"00000002,false,0,0,0,,,not found,,-1,,\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, writeRuns(&buf, formatJUnit, "x", records))
+	t.Logf("%s", buf.String())
+	var suites junitTestSuites
+	assert.NoError(t, xml.Unmarshal(buf.Bytes(), &suites))
+	suite := suites.Suites[0]
+	assert.Equal(t, 3, suite.Tests)
+	assert.Equal(t, 1, suite.Failures)
+	assert.Equal(t, 1, suite.Errors)
+	assert.Equal(t, "2", suite.Time)
+	assert.Equal(t, "1.5", suite.Cases[0].Time)
+	assert.Nil(t, suite.Cases[0].Failure)
+	assert.Equal(t, "validation_failure: AssertionError", suite.Cases[1].Failure.Message)
+	assert.Equal(t, "assertion failed\n", suite.Cases[1].Failure.Text)
+
+	assert.Error(t, checkFormat("yaml"))
+}
+
+func TestWriteActions(t *testing.T) {
+	trace := &SingleTrace{
+		ActionSequence: []Action{
+			newTestHintedAction(t, "x", 0, false),
+			newTestHintedAction(t, "y", 2*time.Millisecond, true),
+		},
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, writeActions(&buf, formatJSON, "x", trace))
+	var decoded struct {
+		Actions []*actionRecord `json:"actions"`
+	}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Len(t, decoded.Actions, 2)
+	assert.Equal(t, "PacketFaultAction", decoded.Actions[1].ActionClass)
+	assert.True(t, decoded.Actions[1].Fault)
+	assert.Equal(t, 2.0, decoded.Actions[1].DelayMS)
+	assert.Equal(t, "y", decoded.Actions[1].ReplayHint)
+
+	buf.Reset()
+	assert.NoError(t, writeActions(&buf, formatJUnit, "x", trace))
+	assert.Contains(t, buf.String(), `<testcase name="1 PacketEvent -&gt; PacketFaultAction" classname="nmz._namazu_ethernet_inspector" time="0.002">`)
+}
@@ -0,0 +1,178 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/osrg/namazu/nmz/historystorage"
+)
+
+type gcFlags struct {
+	KeepFailures   bool
+	KeepLastPasses int
+	OlderThan      time.Duration
+	Compact        bool
+	DryRun         bool
+}
+
+var (
+	gcFlagset = flag.NewFlagSet("gc", flag.ExitOnError)
+	_gcFlags  = gcFlags{}
+)
+
+func init() {
+	gcFlagset.BoolVar(&_gcFlags.KeepFailures, "keep-failures", true, "never delete failing runs")
+	gcFlagset.IntVar(&_gcFlags.KeepLastPasses, "keep-last-passes", -1, "delete passing runs except the last N ones (negative: keep all)")
+	gcFlagset.DurationVar(&_gcFlags.OlderThan, "older-than", 0, "delete runs recorded before this duration ago (zero: disabled)")
+	gcFlagset.BoolVar(&_gcFlags.Compact, "compact", false, "compact the JSON files of the actions of the remaining runs")
+	gcFlagset.BoolVar(&_gcFlags.DryRun, "dry-run", false, "only print what would be done")
+}
+
+// finished run, subject to gc
+type gcRun struct {
+	id         int
+	successful bool
+	recorded   time.Time
+}
+
+type gcPolicy struct {
+	keepFailures   bool
+	keepLastPasses int
+	olderThan      time.Duration
+	now            time.Time
+}
+
+// returns the IDs of the runs to be deleted. runs must be sorted by ID.
+func (p *gcPolicy) selectRuns(runs []gcRun) []int {
+	nrPasses := 0
+	for _, r := range runs {
+		if r.successful {
+			nrPasses++
+		}
+	}
+	ids := make([]int, 0)
+	passIdx := 0
+	for _, r := range runs {
+		if r.successful {
+			passIdx++
+		}
+		if !r.successful && p.keepFailures {
+			continue
+		}
+		old := p.olderThan > 0 && p.now.Sub(r.recorded) > p.olderThan
+		overPasses := r.successful && p.keepLastPasses >= 0 && passIdx <= nrPasses-p.keepLastPasses
+		if old || overPasses {
+			ids = append(ids, r.id)
+		}
+	}
+	return ids
+}
+
+// returns the finished runs (the runs in progress and the deleted runs are skipped)
+func loadGCRuns(storage historystorage.HistoryStorage) []gcRun {
+	nrStored := storage.NrStoredHistories()
+	runs := make([]gcRun, 0, nrStored)
+	for i := 0; i < nrStored; i++ {
+		successful, err := storage.IsSuccessful(i)
+		if err != nil {
+			continue
+		}
+		recorded, err := storage.GetRecordedTime(i)
+		if err != nil {
+			continue
+		}
+		runs = append(runs, gcRun{id: i, successful: successful, recorded: recorded})
+	}
+	return runs
+}
+
+func gc(w io.Writer, storage historystorage.HistoryStorage, policy *gcPolicy, compact, dryRun bool) error {
+	runs := loadGCRuns(storage)
+	deleted := make(map[int]bool)
+	for _, id := range policy.selectRuns(runs) {
+		fmt.Fprintf(w, "deleting %08x\n", id)
+		if !dryRun {
+			if err := storage.DeleteHistory(id); err != nil {
+				return fmt.Errorf("failed to delete %08x: %s", id, err)
+			}
+		}
+		deleted[id] = true
+	}
+	nrCompacted := 0
+	if compact {
+		for _, r := range runs {
+			if deleted[r.id] {
+				continue
+			}
+			if !dryRun {
+				if err := storage.CompactHistory(r.id); err != nil {
+					return fmt.Errorf("failed to compact %08x: %s", r.id, err)
+				}
+			}
+			nrCompacted++
+		}
+	}
+	fmt.Fprintf(w, "deleted %d runs, compacted %d runs (%d finished runs)\n", len(deleted), nrCompacted, len(runs))
+	return nil
+}
+
+type gcCmd struct {
+}
+
+func GCCommandFactory() (cli.Command, error) {
+	return gcCmd{}, nil
+}
+
+func (cmd gcCmd) Synopsis() string {
+	return "gc subcommand"
+}
+
+func (cmd gcCmd) Help() string {
+	return "Please run `nmz --help tools` instead"
+}
+
+func (cmd gcCmd) Run(args []string) int {
+	gcFlagset.Parse(args)
+
+	if gcFlagset.NArg() != 1 {
+		fmt.Printf("need history storage path\n")
+		return 1
+	}
+
+	storage, err := historystorage.LoadStorage(gcFlagset.Arg(0))
+	if err != nil {
+		fmt.Printf("failed to load history storage %s: %s\n", gcFlagset.Arg(0), err)
+		return 1
+	}
+	storage.Init()
+	policy := &gcPolicy{
+		keepFailures:   _gcFlags.KeepFailures,
+		keepLastPasses: _gcFlags.KeepLastPasses,
+		olderThan:      _gcFlags.OlderThan,
+		now:            time.Now(),
+	}
+	if err := gc(os.Stdout, storage, policy, _gcFlags.Compact, _gcFlags.DryRun); err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+	return 0
+}
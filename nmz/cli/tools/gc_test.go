@@ -0,0 +1,96 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/osrg/namazu/nmz/historystorage"
+	. "github.com/osrg/namazu/nmz/signal"
+	testutil "github.com/osrg/namazu/nmz/util/test"
+	. "github.com/osrg/namazu/nmz/util/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGCPolicy(t *testing.T) {
+	now := time.Now()
+	runs := []gcRun{
+		{id: 0, successful: true, recorded: now.Add(-48 * time.Hour)},
+		{id: 1, successful: false, recorded: now.Add(-48 * time.Hour)},
+		{id: 3, successful: true, recorded: now.Add(-time.Hour)},
+		{id: 4, successful: true, recorded: now},
+		{id: 5, successful: false, recorded: now},
+	}
+	p := &gcPolicy{keepFailures: true, keepLastPasses: -1, now: now}
+	assert.Empty(t, p.selectRuns(runs))
+
+	p.keepLastPasses = 1
+	assert.Equal(t, []int{0, 3}, p.selectRuns(runs))
+
+	p.keepLastPasses = -1
+	p.olderThan = 24 * time.Hour
+	assert.Equal(t, []int{0}, p.selectRuns(runs))
+
+	p.keepFailures = false
+	assert.Equal(t, []int{0, 1}, p.selectRuns(runs))
+
+	p.keepLastPasses = 0
+	assert.Equal(t, []int{0, 1, 3, 4}, p.selectRuns(runs))
+}
+
+func TestGC(t *testing.T) {
+	dir := testutil.NewNaiveStorage(t, "test-gc")
+	defer os.RemoveAll(dir)
+	for i, successful := range []bool{true, false, true, true} {
+		n := testutil.NewNaiveRun(t, dir, &SingleTrace{ActionSequence: []Action{newTestHintedAction(t, "x", 0, i == 1)}})
+		assert.NoError(t, n.RecordResult(successful, time.Second, nil))
+	}
+
+	storage, err := historystorage.LoadStorage(dir)
+	assert.NoError(t, err)
+	storage.Init()
+	policy := &gcPolicy{keepFailures: true, keepLastPasses: 1, now: time.Now()}
+	var buf bytes.Buffer
+	assert.NoError(t, gc(&buf, storage, policy, true, true))
+	_, err = os.Stat(path.Join(dir, "00000000"))
+	assert.NoError(t, err, "dry run")
+
+	buf.Reset()
+	assert.NoError(t, gc(&buf, storage, policy, true, false))
+	assert.Equal(t, "deleting 00000000\ndeleting 00000002\ndeleted 2 runs, compacted 2 runs (4 finished runs)\n", buf.String())
+	_, err = os.Stat(path.Join(dir, "00000000"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(path.Join(dir, "00000003", "actions.json.gz"))
+	assert.NoError(t, err)
+
+	// the remaining runs are still available
+	assert.Equal(t, 4, storage.NrStoredHistories())
+	trace, err := storage.GetStoredHistory(3)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, trace.ActionSequence)
+	successful, err := storage.IsSuccessful(1)
+	assert.NoError(t, err)
+	assert.False(t, successful)
+
+	// gc again (with the gaps)
+	buf.Reset()
+	assert.NoError(t, gc(&buf, storage, policy, true, false))
+	assert.Equal(t, "deleted 0 runs, compacted 2 runs (2 finished runs)\n", buf.String())
+}
@@ -0,0 +1,212 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/cli"
+	"github.com/osrg/namazu/nmz/historystorage"
+	"github.com/osrg/namazu/nmz/signal"
+	. "github.com/osrg/namazu/nmz/util/trace"
+	"github.com/osrg/namazu/nmz/util/traceimport"
+)
+
+const (
+	importFormatPcap   = "pcap"
+	importFormatStrace = "strace"
+)
+
+type importTraceFlags struct {
+	Format      string
+	EntityID    string
+	Ports       string
+	StripPrefix string
+	Output      string
+	Storage     string
+	Outcome     string
+}
+
+var (
+	importTraceFlagset = flag.NewFlagSet("import-trace", flag.ExitOnError)
+	_importTraceFlags  = importTraceFlags{}
+)
+
+func init() {
+	importTraceFlagset.StringVar(&_importTraceFlags.Format, "format", "", "format of the input (pcap (also for pcapng), strace (also for ltrace)). inferred from the file name if empty")
+	importTraceFlagset.StringVar(&_importTraceFlags.EntityID, "entity", "", "entity ID of the events (default: the one of the Ethernet or the filesystem inspector)")
+	importTraceFlagset.StringVar(&_importTraceFlags.Ports, "ports", "", "pcap: import only the packets from/to these TCP ports (comma-separated)")
+	importTraceFlagset.StringVar(&_importTraceFlags.StripPrefix, "strip-prefix", "", "strace: import only the paths under this dir, relative to it (as the filesystem inspector sees)")
+	importTraceFlagset.StringVar(&_importTraceFlags.Output, "o", "", "path of the trace file to write")
+	importTraceFlagset.StringVar(&_importTraceFlags.Storage, "storage", "", "record the trace as a new run in the storage")
+	importTraceFlagset.StringVar(&_importTraceFlags.Outcome, "outcome", "", "outcome of the run recorded with -storage (pass, validation_failure, run_crash, hang, infra_error)")
+}
+
+func importFormat(format, inputPath string) (string, error) {
+	if format == "" {
+		switch filepath.Ext(inputPath) {
+		case ".pcap", ".pcapng", ".cap":
+			return importFormatPcap, nil
+		default:
+			return "", fmt.Errorf("cannot infer the format of %s, specify -format", inputPath)
+		}
+	}
+	if format != importFormatPcap && format != importFormatStrace {
+		return "", fmt.Errorf("unknown format %s", format)
+	}
+	return format, nil
+}
+
+func parsePorts(s string) ([]int, error) {
+	ports := make([]int, 0)
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		port, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("bad port %s", p)
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+func importEvents(format, inputPath string, flags *importTraceFlags) ([]signal.Event, error) {
+	f, err := os.Open(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	switch format {
+	case importFormatPcap:
+		opts := traceimport.PacketOptions{EntityID: flags.EntityID}
+		if opts.EntityID == "" {
+			opts.EntityID = "_namazu_ethernet_inspector"
+		}
+		if opts.Ports, err = parsePorts(flags.Ports); err != nil {
+			return nil, err
+		}
+		return traceimport.PacketEvents(f, opts)
+	default:
+		opts := traceimport.StraceOptions{EntityID: flags.EntityID, StripPrefix: flags.StripPrefix}
+		if opts.EntityID == "" {
+			opts.EntityID = "_namazu_fs_inspector"
+		}
+		return traceimport.StraceEvents(f, opts)
+	}
+}
+
+// records the trace as a new run (the required time is the duration of the events)
+func recordImportedTrace(storage historystorage.HistoryStorage, trace *SingleTrace, outcome historystorage.Outcome, inputPath string) (string, error) {
+	dir := storage.CreateNewWorkingDir()
+	storage.RecordNewTrace(trace)
+	result := &historystorage.Result{
+		Successful:       outcome == historystorage.OutcomePass,
+		Outcome:          outcome,
+		ValidateExitCode: -1,
+		Labels:           map[string]string{"imported_from": filepath.Base(inputPath)},
+	}
+	if seq := trace.ActionSequence; len(seq) > 0 {
+		first, last := seq[0].TriggeredTime(), seq[len(seq)-1].TriggeredTime()
+		if !first.IsZero() && last.After(first) {
+			result.RequiredTime = last.Sub(first)
+		}
+	}
+	return dir, historystorage.RecordResult(storage, result)
+}
+
+type importTraceCmd struct {
+}
+
+func ImportTraceCommandFactory() (cli.Command, error) {
+	return importTraceCmd{}, nil
+}
+
+func (cmd importTraceCmd) Synopsis() string {
+	return "import-trace subcommand"
+}
+
+func (cmd importTraceCmd) Help() string {
+	return "Please run `nmz --help tools` instead"
+}
+
+func (cmd importTraceCmd) Run(args []string) int {
+	importTraceFlagset.Parse(args)
+
+	if importTraceFlagset.NArg() != 1 {
+		fmt.Printf("specify the input file (pcap or strace)\n")
+		return 1
+	}
+	inputPath := importTraceFlagset.Arg(0)
+	if _importTraceFlags.Output == "" && _importTraceFlags.Storage == "" {
+		fmt.Printf("specify -o or -storage\n")
+		return 1
+	}
+	var outcome historystorage.Outcome
+	if _importTraceFlags.Storage != "" {
+		var err error
+		if outcome, err = historystorage.ParseOutcome(_importTraceFlags.Outcome); err != nil {
+			fmt.Printf("specify -outcome for -storage: %s\n", err)
+			return 1
+		}
+	}
+	format, err := importFormat(_importTraceFlags.Format, inputPath)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+
+	events, err := importEvents(format, inputPath, &_importTraceFlags)
+	if err != nil {
+		fmt.Printf("failed to import %s: %s\n", inputPath, err)
+		return 1
+	}
+	trace, err := traceimport.NewTrace(events)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+	fmt.Printf("imported %d events from %s\n", len(events), inputPath)
+
+	if _importTraceFlags.Output != "" {
+		if err = SaveTraceFile(_importTraceFlags.Output, trace, TraceFormatJSONL); err != nil {
+			fmt.Printf("%s\n", err)
+			return 1
+		}
+	}
+	if _importTraceFlags.Storage != "" {
+		storage, err := historystorage.LoadStorage(_importTraceFlags.Storage)
+		if err != nil {
+			fmt.Printf("failed to load history storage %s: %s\n", _importTraceFlags.Storage, err)
+			return 1
+		}
+		storage.Init()
+		defer storage.Close()
+		dir, err := recordImportedTrace(storage, trace, outcome, inputPath)
+		if err != nil {
+			fmt.Printf("failed to record the result: %s\n", err)
+			return 1
+		}
+		fmt.Printf("recorded as %s\n", dir)
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/osrg/namazu/nmz/historystorage"
+	"github.com/osrg/namazu/nmz/historystorage/naive"
+	"github.com/osrg/namazu/nmz/util/traceimport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportFormat(t *testing.T) {
+	format, err := importFormat("", "/tmp/capture.pcapng")
+	assert.NoError(t, err)
+	assert.Equal(t, importFormatPcap, format)
+	_, err = importFormat("", "/tmp/strace.out")
+	assert.Error(t, err)
+	format, err = importFormat(importFormatStrace, "/tmp/strace.out")
+	assert.NoError(t, err)
+	assert.Equal(t, importFormatStrace, format)
+}
+
+func TestRecordImportedTrace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-import-trace")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	naive.New(dir).CreateStorage()
+
+	events, err := traceimport.StraceEvents(strings.NewReader(
+		`1500000000.000000 fsync(3</data/log>) = 0
+1500000001.000000 mkdir("/data/snap", 0755) = 0
+`), traceimport.StraceOptions{EntityID: "_namazu_fs_inspector"})
+	assert.NoError(t, err)
+	trace, err := traceimport.NewTrace(events)
+	assert.NoError(t, err)
+
+	storage := naive.New(dir)
+	storage.Init()
+	_, err = recordImportedTrace(storage, trace, historystorage.OutcomeValidationFailure, "/tmp/strace.out")
+	assert.NoError(t, err)
+
+	storage = naive.New(dir)
+	storage.Init()
+	result, err := historystorage.LoadResult(storage, 0)
+	assert.NoError(t, err)
+	assert.False(t, result.Successful)
+	assert.Equal(t, historystorage.OutcomeValidationFailure, result.Outcome)
+	assert.Equal(t, time.Second, result.RequiredTime)
+	assert.Equal(t, "strace.out", result.Labels["imported_from"])
+	stored, err := storage.GetStoredHistory(0)
+	assert.NoError(t, err)
+	assert.Len(t, stored.ActionSequence, 2)
+	assert.Equal(t, "FilesystemEvent", stored.ActionSequence[0].Event().JSONMap()["class"])
+}
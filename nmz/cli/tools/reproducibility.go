@@ -0,0 +1,252 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/osrg/namazu/nmz/historystorage"
+)
+
+type reproducibilityFlags struct {
+	Runs            int
+	BaselinePolicy  string
+	BaselineStorage string
+	Outcomes        outcomeFilter
+}
+
+var (
+	reproducibilityFlagset = flag.NewFlagSet("reproducibility", flag.ExitOnError)
+	_reproducibilityFlags  = reproducibilityFlags{Outcomes: outcomeFilter{}}
+)
+
+func init() {
+	reproducibilityFlagset.IntVar(&_reproducibilityFlags.Runs, "runs", 0, "run the experiment N times with the baseline policy and N times with the configured policy before reporting")
+	reproducibilityFlagset.StringVar(&_reproducibilityFlags.BaselinePolicy, "baseline-policy", "dumb", "exploration policy for the baseline runs")
+	reproducibilityFlagset.Var(_reproducibilityFlags.Outcomes, "outcome", outcomeUsage)
+	reproducibilityFlagset.StringVar(&_reproducibilityFlags.BaselineStorage, "baseline-storage", "", "storage for the baseline runs (default: <storage>-baseline, initialized automatically)")
+}
+
+// same as the materials dir in the storage created by `nmz init`
+const storageMaterialsPath = "materials"
+
+// z for 95% confidence
+const confidenceZ = 1.96
+
+// Wilson score interval of the binomial proportion k/n
+func wilsonInterval(k, n int) (lo, hi float64) {
+	if n == 0 {
+		return 0, 1
+	}
+	p := float64(k) / float64(n)
+	z2 := confidenceZ * confidenceZ
+	denom := 1 + z2/float64(n)
+	center := (p + z2/(2*float64(n))) / denom
+	margin := confidenceZ * math.Sqrt(p*(1-p)/float64(n)+z2/(4*float64(n)*float64(n))) / denom
+	return math.Max(0, center-margin), math.Min(1, center+margin)
+}
+
+type reproducibility struct {
+	name       string
+	nrRuns     int
+	nrFailures int
+	// failure rate and its 95% confidence interval
+	rate, rateLo, rateHi float64
+	// the number of runs until the first failure (0 if no failure)
+	runsToFirstFailure int
+	// the sum of required time of the runs until the first failure
+	timeToFirstFailure time.Duration
+	totalTime          time.Duration
+}
+
+func newReproducibility(name string, successful []bool, requiredTimes []time.Duration) *reproducibility {
+	r := &reproducibility{name: name, nrRuns: len(successful)}
+	for i, succeed := range successful {
+		r.totalTime += requiredTimes[i]
+		if !succeed {
+			r.nrFailures++
+			if r.runsToFirstFailure == 0 {
+				r.runsToFirstFailure = i + 1
+				r.timeToFirstFailure = r.totalTime
+			}
+		}
+	}
+	if r.nrRuns > 0 {
+		r.rate = float64(r.nrFailures) / float64(r.nrRuns)
+	}
+	r.rateLo, r.rateHi = wilsonInterval(r.nrFailures, r.nrRuns)
+	return r
+}
+
+func loadReproducibility(storagePath string) (*reproducibility, error) {
+	storage, err := historystorage.LoadStorage(storagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load history storage %s: %s", storagePath, err)
+	}
+	storage.Init()
+	nrStored := storage.NrStoredHistories()
+	successful := make([]bool, 0, nrStored)
+	requiredTimes := make([]time.Duration, 0, nrStored)
+	for i := 0; i < nrStored; i++ {
+		result, err := historystorage.LoadResult(storage, i)
+		if err != nil {
+			// e.g. the run was interrupted
+			continue
+		}
+		if !_reproducibilityFlags.Outcomes.matchResult(result) {
+			continue
+		}
+		successful = append(successful, result.Successful)
+		requiredTimes = append(requiredTimes, result.RequiredTime)
+	}
+	return newReproducibility(storagePath, successful, requiredTimes), nil
+}
+
+func printReproducibility(w io.Writer, r *reproducibility) {
+	fmt.Fprintf(w, "%s:\n", r.name)
+	fmt.Fprintf(w, "  failures:              %d / %d runs\n", r.nrFailures, r.nrRuns)
+	fmt.Fprintf(w, "  failure rate:          %.2f%% (95%% CI: %.2f%% - %.2f%%)\n", r.rate*100, r.rateLo*100, r.rateHi*100)
+	if r.runsToFirstFailure > 0 {
+		fmt.Fprintf(w, "  first failure:         run #%d (after %s)\n", r.runsToFirstFailure, r.timeToFirstFailure)
+		fmt.Fprintf(w, "  mean time to failure:  %s\n", r.totalTime/time.Duration(r.nrFailures))
+	} else {
+		fmt.Fprintf(w, "  first failure:         none (in %s)\n", r.totalTime)
+	}
+}
+
+func compareReproducibility(w io.Writer, baseline, target *reproducibility) {
+	printReproducibility(w, baseline)
+	printReproducibility(w, target)
+	switch {
+	case baseline.nrFailures == 0 && target.nrFailures == 0:
+		fmt.Fprintf(w, "no failure reproduced\n")
+	case baseline.nrFailures == 0:
+		fmt.Fprintf(w, "failures were reproduced only with %s\n", target.name)
+	default:
+		fmt.Fprintf(w, "failure rate ratio: %.2fx\n", target.rate/baseline.rate)
+	}
+	if target.rateLo > baseline.rateHi {
+		fmt.Fprintf(w, "the failure rate of %s is significantly higher (95%% CIs do not overlap)\n", target.name)
+	} else if baseline.rateLo > target.rateHi {
+		fmt.Fprintf(w, "the failure rate of %s is significantly higher (95%% CIs do not overlap)\n", baseline.name)
+	} else {
+		fmt.Fprintf(w, "the difference is not significant (95%% CIs overlap)\n")
+	}
+}
+
+// runs `nmz <args>` (the same executable as this process)
+func runNmz(args ...string) error {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func ensureBaselineStorage(storagePath, baselinePath string) error {
+	if _, err := os.Stat(baselinePath); err == nil {
+		return nil
+	}
+	fmt.Printf("initializing the baseline storage %s\n", baselinePath)
+	return runNmz("init", "-force",
+		path.Join(storagePath, historystorage.StorageTOMLConfigPath),
+		path.Join(storagePath, storageMaterialsPath),
+		baselinePath)
+}
+
+// runs the baseline and the target alternately, so that changes of the environment affect both of them equally
+func runForReproducibility(storagePath, baselinePath, baselinePolicy string, runs int) error {
+	for i := 0; i < runs; i++ {
+		fmt.Printf("baseline run %d/%d\n", i+1, runs)
+		if err := runNmz("run", "-explore-policy", baselinePolicy, baselinePath); err != nil {
+			return fmt.Errorf("baseline run failed: %s", err)
+		}
+		fmt.Printf("run %d/%d\n", i+1, runs)
+		if err := runNmz("run", storagePath); err != nil {
+			return fmt.Errorf("run failed: %s", err)
+		}
+	}
+	return nil
+}
+
+type reproducibilityCmd struct {
+}
+
+func ReproducibilityCommandFactory() (cli.Command, error) {
+	return reproducibilityCmd{}, nil
+}
+
+func (cmd reproducibilityCmd) Synopsis() string {
+	return "reproducibility subcommand"
+}
+
+func (cmd reproducibilityCmd) Help() string {
+	return "Please run `nmz --help tools` instead"
+}
+
+func (cmd reproducibilityCmd) Run(args []string) int {
+	reproducibilityFlagset.Parse(args)
+
+	var baselinePath, storagePath string
+	switch reproducibilityFlagset.NArg() {
+	case 1:
+		storagePath = reproducibilityFlagset.Arg(0)
+		baselinePath = _reproducibilityFlags.BaselineStorage
+		if baselinePath == "" {
+			baselinePath = filepath.Clean(storagePath) + "-baseline"
+		}
+	case 2:
+		// compare two storages
+		baselinePath = reproducibilityFlagset.Arg(0)
+		storagePath = reproducibilityFlagset.Arg(1)
+	default:
+		fmt.Printf("need history storage path (or baseline and target storage paths)\n")
+		return 1
+	}
+
+	if _reproducibilityFlags.Runs > 0 {
+		if err := ensureBaselineStorage(storagePath, baselinePath); err != nil {
+			fmt.Printf("%s\n", err)
+			return 1
+		}
+		err := runForReproducibility(storagePath, baselinePath, _reproducibilityFlags.BaselinePolicy, _reproducibilityFlags.Runs)
+		if err != nil {
+			fmt.Printf("%s\n", err)
+			return 1
+		}
+	}
+
+	baseline, err := loadReproducibility(baselinePath)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+	target, err := loadReproducibility(storagePath)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+	compareReproducibility(os.Stdout, baseline, target)
+	return 0
+}
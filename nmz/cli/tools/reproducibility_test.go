@@ -0,0 +1,59 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWilsonInterval(t *testing.T) {
+	lo, hi := wilsonInterval(0, 10)
+	assert.Equal(t, 0.0, lo)
+	assert.InDelta(t, 0.278, hi, 0.001)
+	lo, hi = wilsonInterval(5, 10)
+	assert.InDelta(t, 0.237, lo, 0.001)
+	assert.InDelta(t, 0.763, hi, 0.001)
+	lo, hi = wilsonInterval(0, 0)
+	assert.Equal(t, 0.0, lo)
+	assert.Equal(t, 1.0, hi)
+}
+
+func TestCompareReproducibility(t *testing.T) {
+	second := time.Second
+	baseline := newReproducibility("baseline",
+		[]bool{true, true, true, true, true, true, true, true, true, false},
+		[]time.Duration{second, second, second, second, second, second, second, second, second, second})
+	assert.Equal(t, 1, baseline.nrFailures)
+	assert.Equal(t, 10, baseline.runsToFirstFailure)
+	assert.Equal(t, 10*second, baseline.timeToFirstFailure)
+
+	target := newReproducibility("target",
+		[]bool{true, false, false, false, false, false, false, false, false, false},
+		[]time.Duration{second, 2 * second, second, second, second, second, second, second, second, second})
+	assert.Equal(t, 2, target.runsToFirstFailure)
+	assert.Equal(t, 3*second, target.timeToFirstFailure)
+	assert.InDelta(t, 0.9, target.rate, 1e-9)
+
+	var buf bytes.Buffer
+	compareReproducibility(&buf, baseline, target)
+	t.Logf("%s", buf.String())
+	assert.Contains(t, buf.String(), "failure rate ratio: 9.00x")
+	assert.Contains(t, buf.String(), "the failure rate of target is significantly higher")
+}
@@ -0,0 +1,70 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+
+	"github.com/mitchellh/cli"
+	"github.com/osrg/namazu/nmz/util/dashboard"
+)
+
+type serveFlags struct {
+	Port int
+}
+
+var (
+	serveFlagset = flag.NewFlagSet("serve", flag.ExitOnError)
+	_serveFlags  = serveFlags{}
+)
+
+func init() {
+	serveFlagset.IntVar(&_serveFlags.Port, "port", 10090, "port of the web dashboard")
+}
+
+type serveCmd struct {
+}
+
+func ServeCommandFactory() (cli.Command, error) {
+	return serveCmd{}, nil
+}
+
+func (cmd serveCmd) Synopsis() string {
+	return "serve subcommand"
+}
+
+func (cmd serveCmd) Help() string {
+	return "Please run `nmz --help tools` instead"
+}
+
+func (cmd serveCmd) Run(args []string) int {
+	serveFlagset.Parse(args)
+
+	if serveFlagset.NArg() != 1 {
+		fmt.Printf("need history storage path\n")
+		return 1
+	}
+
+	addr := fmt.Sprintf(":%d", _serveFlags.Port)
+	fmt.Printf("serving the dashboard for %s on %s\n", serveFlagset.Arg(0), addr)
+	if err := http.ListenAndServe(addr, dashboard.NewStorageHandler(serveFlagset.Arg(0))); err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+	return 0
+}
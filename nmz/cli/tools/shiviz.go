@@ -0,0 +1,252 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	. "github.com/osrg/namazu/nmz/signal"
+	signalutil "github.com/osrg/namazu/nmz/util/signal"
+	. "github.com/osrg/namazu/nmz/util/trace"
+)
+
+type spaceTimeEventKind int
+
+const (
+	spaceTimeLocal spaceTimeEventKind = iota
+	spaceTimeSend
+	spaceTimeRecv
+	// the message was dropped by a fault action
+	spaceTimeDrop
+)
+
+// an event on the space-time diagram
+type spaceTimeEvent struct {
+	kind spaceTimeEventKind
+	host string
+	// the other side of the message (empty for spaceTimeLocal)
+	peer string
+	// label of the message (or of the local event)
+	label string
+	time  time.Time
+	// index of the action in the trace
+	index int
+	// vector clock (host -> logical time)
+	clock map[string]int
+	// for spaceTimeRecv and spaceTimeDrop, the corresponding spaceTimeSend
+	send *spaceTimeEvent
+}
+
+func (this *spaceTimeEvent) description() string {
+	switch this.kind {
+	case spaceTimeSend:
+		return fmt.Sprintf("send %s to %s", this.label, this.peer)
+	case spaceTimeRecv:
+		return fmt.Sprintf("recv %s from %s", this.label, this.peer)
+	case spaceTimeDrop:
+		return fmt.Sprintf("drop %s from %s", this.label, this.peer)
+	default:
+		return this.label
+	}
+}
+
+type spaceTimeEventsByTime []*spaceTimeEvent
+
+func (s spaceTimeEventsByTime) Len() int      { return len(s) }
+func (s spaceTimeEventsByTime) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s spaceTimeEventsByTime) Less(i, j int) bool {
+	if !s[i].time.Equal(s[j].time) {
+		return s[i].time.Before(s[j].time)
+	}
+	if s[i].index != s[j].index {
+		return s[i].index < s[j].index
+	}
+	// send must precede its recv
+	return s[i].kind == spaceTimeSend && s[j].kind != spaceTimeSend
+}
+
+func spaceTimeLabel(event Event, action Action) string {
+	label := signalutil.EventClass(event)
+	if hint := event.ReplayHint(); hint != "" {
+		label += fmt.Sprintf("[%s]", hint)
+	}
+	if len(label) > 64 {
+		label = label[:61] + "..."
+	}
+	if signalutil.IsFaultAction(action) {
+		label += fmt.Sprintf(" (%s)", signalutil.ActionClass(action))
+	}
+	return label
+}
+
+// reconstructs per-entity vector clocks from the trace.
+//
+// A PacketEvent with src_entity/dst_entity is a message from src_entity (sent when the event arrived)
+// to dst_entity (received when the action was triggered). Other events are local events of their entities.
+func buildSpaceTime(trace *SingleTrace) []*spaceTimeEvent {
+	evs := make([]*spaceTimeEvent, 0)
+	for i, action := range trace.ActionSequence {
+		event := action.Event()
+		if event == nil {
+			continue
+		}
+		triggered := action.TriggeredTime()
+		label := spaceTimeLabel(event, action)
+		option, _ := event.JSONMap()["option"].(map[string]interface{})
+		src, _ := option["src_entity"].(string)
+		dst, _ := option["dst_entity"].(string)
+		// NOTE: event may be a *BasicEvent (e.g. CauseEvent of EventAcceptanceAction), so we check the class name
+		if signalutil.EventClass(event) != "PacketEvent" || src == "" || dst == "" {
+			evs = append(evs, &spaceTimeEvent{
+				kind:  spaceTimeLocal,
+				host:  event.EntityID(),
+				label: label,
+				time:  triggered,
+				index: i,
+			})
+			continue
+		}
+		arrived := event.ArrivedTime()
+		if arrived.IsZero() || arrived.After(triggered) {
+			arrived = triggered
+		}
+		send := &spaceTimeEvent{kind: spaceTimeSend, host: src, peer: dst, label: label, time: arrived, index: i}
+		recv := &spaceTimeEvent{kind: spaceTimeRecv, host: dst, peer: src, label: label, time: triggered, index: i, send: send}
+		if signalutil.IsFaultAction(action) {
+			// the message does not reach dst
+			recv.kind = spaceTimeDrop
+			recv.host, recv.peer = src, dst
+		}
+		evs = append(evs, send, recv)
+	}
+	sort.Stable(spaceTimeEventsByTime(evs))
+
+	clocks := make(map[string]map[string]int)
+	for _, ev := range evs {
+		clock, ok := clocks[ev.host]
+		if !ok {
+			clock = make(map[string]int)
+			clocks[ev.host] = clock
+		}
+		if ev.kind == spaceTimeRecv {
+			for host, t := range ev.send.clock {
+				if t > clock[host] {
+					clock[host] = t
+				}
+			}
+		}
+		clock[ev.host]++
+		ev.clock = make(map[string]int, len(clock))
+		for host, t := range clock {
+			ev.clock[host] = t
+		}
+	}
+	return evs
+}
+
+// the regular expression for parsing the log, which is put on the head of the log
+const shivizParserRegexp = `(?<event>.*)\n(?<host>\S*) (?<clock>{.*})`
+
+// writes a log that can be loaded into ShiViz (https://bestchai.bitbucket.io/shiviz/)
+func writeShiViz(w io.Writer, evs []*spaceTimeEvent) error {
+	fmt.Fprintf(w, "%s\n\n", shivizParserRegexp)
+	for _, ev := range evs {
+		clock, err := json.Marshal(ev.clock)
+		if err != nil {
+			return err
+		}
+		desc := strings.Replace(ev.description(), "\n", " ", -1)
+		fmt.Fprintf(w, "%s\n%s %s\n", desc, ev.host, clock)
+	}
+	return nil
+}
+
+func spaceTimeHosts(evs []*spaceTimeEvent) []string {
+	hosts := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, ev := range evs {
+		for _, host := range []string{ev.host, ev.peer} {
+			if host != "" && !seen[host] {
+				seen[host] = true
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	return hosts
+}
+
+// writes a Graphviz DOT space-time diagram (one cluster per entity)
+func writeDOT(w io.Writer, evs []*spaceTimeEvent) {
+	ids := make(map[*spaceTimeEvent]string, len(evs))
+	for i, ev := range evs {
+		ids[ev] = fmt.Sprintf("e%d", i)
+	}
+	fmt.Fprintf(w, "digraph nmz {\n")
+	fmt.Fprintf(w, "  node [shape=box];\n")
+	for i, host := range spaceTimeHosts(evs) {
+		fmt.Fprintf(w, "  subgraph cluster_%d {\n", i)
+		fmt.Fprintf(w, "    label=%q;\n", host)
+		prev := ""
+		for _, ev := range evs {
+			if ev.host != host {
+				continue
+			}
+			clock, _ := json.Marshal(ev.clock)
+			fmt.Fprintf(w, "    %s [label=%q];\n", ids[ev], ev.description()+"\n"+string(clock))
+			if prev != "" {
+				fmt.Fprintf(w, "    %s -> %s [style=dotted, arrowhead=none];\n", prev, ids[ev])
+			}
+			prev = ids[ev]
+		}
+		fmt.Fprintf(w, "  }\n")
+	}
+	for _, ev := range evs {
+		switch ev.kind {
+		case spaceTimeRecv:
+			fmt.Fprintf(w, "  %s -> %s;\n", ids[ev.send], ids[ev])
+		case spaceTimeDrop:
+			fmt.Fprintf(w, "  %s -> %s [color=red, style=dashed];\n", ids[ev.send], ids[ev])
+		}
+	}
+	fmt.Fprintf(w, "}\n")
+}
+
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(";", ",", "#", "", "\n", " ").Replace(s)
+}
+
+// writes a Mermaid sequence diagram (messages are placed in the order of their delivery)
+func writeMermaid(w io.Writer, evs []*spaceTimeEvent) {
+	fmt.Fprintf(w, "sequenceDiagram\n")
+	for _, host := range spaceTimeHosts(evs) {
+		fmt.Fprintf(w, "    participant %s\n", host)
+	}
+	for _, ev := range evs {
+		switch ev.kind {
+		case spaceTimeLocal:
+			fmt.Fprintf(w, "    Note over %s: %s\n", ev.host, mermaidEscape(ev.label))
+		case spaceTimeRecv:
+			fmt.Fprintf(w, "    %s->>%s: %s\n", ev.peer, ev.host, mermaidEscape(ev.label))
+		case spaceTimeDrop:
+			fmt.Fprintf(w, "    %s-x%s: %s\n", ev.host, ev.peer, mermaidEscape(ev.label))
+		}
+	}
+}
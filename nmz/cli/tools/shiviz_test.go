@@ -0,0 +1,82 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	. "github.com/osrg/namazu/nmz/signal"
+	. "github.com/osrg/namazu/nmz/util/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPacketAction(t *testing.T, src, dst string, arrived, triggered time.Time, fault bool) Action {
+	event, err := NewPacketEvent("_namazu_ethernet_inspector", src, dst, map[string]interface{}{})
+	assert.NoError(t, err)
+	event.(*PacketEvent).SetArrivedTime(arrived)
+	var action Action
+	if fault {
+		action, err = event.DefaultFaultAction()
+	} else {
+		action, err = event.DefaultAction()
+	}
+	assert.NoError(t, err)
+	action.SetTriggeredTime(triggered)
+	return action
+}
+
+func TestBuildSpaceTime(t *testing.T) {
+	t0 := time.Now()
+	at := func(ms int) time.Time { return t0.Add(time.Duration(ms) * time.Millisecond) }
+	trace := &SingleTrace{
+		ActionSequence: []Action{
+			// a -> b, delivered at 3
+			newTestPacketAction(t, "a", "b", at(0), at(3), false),
+			// b -> c, sent at 4 (after receiving from a), delivered at 5
+			newTestPacketAction(t, "b", "c", at(4), at(5), false),
+			// c -> a, dropped
+			newTestPacketAction(t, "c", "a", at(6), at(7), true),
+		},
+	}
+	evs := buildSpaceTime(trace)
+	assert.Len(t, evs, 6)
+
+	assert.Equal(t, spaceTimeSend, evs[0].kind)
+	assert.Equal(t, map[string]int{"a": 1}, evs[0].clock)
+	assert.Equal(t, spaceTimeRecv, evs[1].kind)
+	assert.Equal(t, map[string]int{"a": 1, "b": 1}, evs[1].clock)
+	assert.Equal(t, map[string]int{"a": 1, "b": 2}, evs[2].clock)
+	assert.Equal(t, "c", evs[3].host)
+	assert.Equal(t, map[string]int{"a": 1, "b": 2, "c": 1}, evs[3].clock)
+	assert.Equal(t, map[string]int{"a": 1, "b": 2, "c": 2}, evs[4].clock)
+	assert.Equal(t, spaceTimeDrop, evs[5].kind)
+	assert.Equal(t, "c", evs[5].host)
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeShiViz(&buf, evs))
+	assert.Contains(t, buf.String(), "send PacketEvent to b\na {\"a\":1}\n")
+
+	buf.Reset()
+	writeMermaid(&buf, evs)
+	assert.Contains(t, buf.String(), "a->>b: PacketEvent\n")
+	assert.Contains(t, buf.String(), "c-xa: PacketEvent (PacketFaultAction)\n")
+
+	buf.Reset()
+	writeDOT(&buf, evs)
+	assert.Contains(t, buf.String(), "e0 -> e1;\n")
+}
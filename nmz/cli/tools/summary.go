@@ -18,6 +18,8 @@ package tools
 import (
 	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/mitchellh/cli"
@@ -26,57 +28,128 @@ import (
 
 type summaryFlags struct {
 	ListUpOverAverage bool
+	ListRuns          bool
+	Format            string
+	Outcomes          outcomeFilter
 }
 
 var (
 	summaryFlagset = flag.NewFlagSet("summary", flag.ExitOnError)
-	_summaryFlags  = summaryFlags{}
+	_summaryFlags  = summaryFlags{Outcomes: outcomeFilter{}}
 )
 
 func init() {
 	summaryFlagset.BoolVar(&_summaryFlags.ListUpOverAverage, "list-up-over-average", false, "list up IDs of runs whose time is longer than average")
+	summaryFlagset.BoolVar(&_summaryFlags.ListRuns, "list-runs", false, "list up IDs of failing runs instead of the buckets")
+	summaryFlagset.StringVar(&_summaryFlags.Format, "format", formatText, formatUsage)
+	summaryFlagset.Var(_summaryFlags.Outcomes, "outcome", outcomeUsage)
 }
 
-func doSummary(historyStoragePath string) {
-	storage := historystorage.LoadStorage(historyStoragePath)
+func doSummary(historyStoragePath string) error {
+	storage, err := historystorage.LoadStorage(historyStoragePath)
+	if err != nil {
+		return fmt.Errorf("failed to load history storage %s: %s", historyStoragePath, err)
+	}
 
 	storage.Init()
 	nrStored := storage.NrStoredHistories()
 
+	outcomes := _summaryFlags.Outcomes
+	counts := make(map[historystorage.Outcome]int)
+	ids := make([]int, 0, nrStored)
+	results := make([]*historystorage.Result, 0, nrStored)
+	nrFailures := 0
 	for i := 0; i < nrStored; i++ {
-		succeed, err := storage.IsSuccessful(i)
+		result, err := historystorage.LoadResult(storage, i)
+		if isMissingRun(err) {
+			continue
+		}
 		if err != nil {
 			fmt.Printf("failed to open history %08x, %s\n", i, err)
 			continue
 		}
+		counts[result.Outcome]++
+		if !outcomes.matchResult(result) {
+			continue
+		}
+		ids = append(ids, i)
+		results = append(results, result)
+		if !result.Successful {
+			nrFailures++
+		}
+
+		if !_summaryFlags.ListRuns {
+			continue
+		}
+		if !result.Successful {
+			if result.Signature != "" {
+				fmt.Printf("%08x caused failure (%s): %s\n", i, result.Outcome, result.Signature)
+			} else {
+				fmt.Printf("%08x caused failure (%s)\n", i, result.Outcome)
+			}
+		} else if len(outcomes) > 0 {
+			fmt.Printf("%08x passed\n", i)
+		}
+	}
+
+	if !_summaryFlags.ListRuns {
+		printBuckets(os.Stdout, bucketRuns(ids, results), nrFailures, len(ids))
+	}
 
-		if !succeed {
-			fmt.Printf("%08x caused failure\n", i)
+	fmt.Printf("outcomes:")
+	for _, o := range historystorage.Outcomes {
+		if counts[o] > 0 {
+			fmt.Printf(" %s=%d", o, counts[o])
 		}
 	}
+	fmt.Printf("\n")
+	return nil
 }
 
-func listUpOverAverage(historyStoragePath string) {
-	storage := historystorage.LoadStorage(historyStoragePath)
+func listUpOverAverage(historyStoragePath string) error {
+	storage, err := historystorage.LoadStorage(historyStoragePath)
+	if err != nil {
+		return fmt.Errorf("failed to load history storage %s: %s", historyStoragePath, err)
+	}
 
 	storage.Init()
 	nrStored := storage.NrStoredHistories()
 
 	totalTime := time.Duration(0)
 
+	ids := make([]int, 0, nrStored)
 	for i := 0; i < nrStored; i++ {
+		matched, err := _summaryFlags.Outcomes.match(storage, i)
+		if isMissingRun(err) {
+			continue
+		}
+		if err != nil {
+			fmt.Printf("failed to open history %08x, %s\n", i, err)
+			continue // just skip?
+		}
+		if !matched {
+			continue
+		}
+
 		time, err := storage.GetRequiredTime(i)
+		if isMissingRun(err) {
+			continue
+		}
 		if err != nil {
 			fmt.Printf("failed to open history %08x, %s\n", i, err)
 			continue // just skip?
 		}
 
 		totalTime += time
+		ids = append(ids, i)
 	}
 
-	averageTime := time.Duration(int64(totalTime) / int64(nrStored))
+	if len(ids) == 0 {
+		return nil
+	}
+	averageTime := time.Duration(int64(totalTime) / int64(len(ids)))
 
-	for i := 0; i < nrStored; i++ {
+	for _, i := range ids {
 		time, err := storage.GetRequiredTime(i)
 		if err != nil {
 			fmt.Printf("failed to open history %08x, %s\n", i, err)
@@ -87,6 +160,49 @@ func listUpOverAverage(historyStoragePath string) {
 			fmt.Printf("%08x\n", i)
 		}
 	}
+	return nil
+}
+
+// prints all the runs (or the runs whose time is longer than average) in the machine-readable format
+func formattedSummary(historyStoragePath string, format string, overAverageOnly bool) error {
+	storage, err := historystorage.LoadStorage(historyStoragePath)
+	if err != nil {
+		return fmt.Errorf("failed to load history storage %s: %s", historyStoragePath, err)
+	}
+
+	storage.Init()
+	nrStored := storage.NrStoredHistories()
+
+	records := make([]*runRecord, 0, nrStored)
+	totalTime := 0.0
+	nrLoaded := 0
+	for i := 0; i < nrStored; i++ {
+		if _, err := storage.IsSuccessful(i); isMissingRun(err) {
+			continue
+		}
+		record := newRunRecord(storage, i)
+		if len(_summaryFlags.Outcomes) > 0 && (record.Error != "" || !_summaryFlags.Outcomes[historystorage.Outcome(record.Outcome)]) {
+			continue
+		}
+		records = append(records, record)
+		if record.Error == "" {
+			totalTime += record.RequiredTimeMS
+			nrLoaded++
+		}
+	}
+
+	if overAverageOnly && nrLoaded > 0 {
+		averageTime := totalTime / float64(nrLoaded)
+		overAverage := make([]*runRecord, 0)
+		for _, record := range records {
+			if record.Error == "" && averageTime < record.RequiredTimeMS {
+				overAverage = append(overAverage, record)
+			}
+		}
+		records = overAverage
+	}
+
+	return writeRuns(os.Stdout, format, filepath.Base(filepath.Clean(historyStoragePath)), records)
 }
 
 type summaryCmd struct {
@@ -112,10 +228,27 @@ func (cmd summaryCmd) Run(args []string) int {
 		return 1
 	}
 
+	if err := checkFormat(_summaryFlags.Format); err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+	if _summaryFlags.Format != formatText {
+		if err := formattedSummary(args[len(args)-1], _summaryFlags.Format, _summaryFlags.ListUpOverAverage); err != nil {
+			fmt.Printf("%s\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	var err error
 	if _summaryFlags.ListUpOverAverage {
-		listUpOverAverage(args[len(args)-1])
+		err = listUpOverAverage(args[len(args)-1])
 	} else {
-		doSummary(args[len(args)-1])
+		err = doSummary(args[len(args)-1])
+	}
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
 	}
 	return 0
 }
@@ -19,9 +19,24 @@ import (
 	"flag"
 	"os"
 	"testing"
+
+	"github.com/osrg/namazu/nmz/historystorage"
+	"github.com/osrg/namazu/nmz/signal"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestMain(m *testing.M) {
 	flag.Parse()
+	signal.RegisterKnownSignals()
 	os.Exit(m.Run())
 }
+
+func TestOutcomeFilter(t *testing.T) {
+	f := outcomeFilter{}
+	assert.True(t, f.matchResult(&historystorage.Result{Outcome: historystorage.OutcomePass}))
+	assert.NoError(t, f.Set("hang, run_crash"))
+	assert.Equal(t, "hang,run_crash", f.String())
+	assert.True(t, f.matchResult(&historystorage.Result{Outcome: historystorage.OutcomeHang}))
+	assert.False(t, f.matchResult(&historystorage.Result{Outcome: historystorage.OutcomePass}))
+	assert.Error(t, f.Set("flaky"))
+}
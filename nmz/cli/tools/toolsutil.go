@@ -0,0 +1,95 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/osrg/namazu/nmz/historystorage"
+	. "github.com/osrg/namazu/nmz/util/trace"
+)
+
+// parses a run ID printed as "%08x" (e.g. by `nmz tools summary`)
+func parseRunID(s string) (int, error) {
+	id, err := strconv.ParseUint(s, 16, 31)
+	if err != nil {
+		return -1, fmt.Errorf("bad run ID %s: %s", s, err)
+	}
+	return int(id), nil
+}
+
+// the run has been deleted (see `nmz tools gc`) or is in progress.
+// such runs are silently skipped.
+func isMissingRun(err error) bool {
+	return os.IsNotExist(err)
+}
+
+// loads a trace file (JSONL or legacy gob) e.g. saved by `nmz orchestrator -interactive`
+func loadTraceFile(tracePath string) (*SingleTrace, error) {
+	trace, _, err := LoadTraceFile(tracePath)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to open trace data file(%s): %s", tracePath, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode trace file(%s): %s", tracePath, err)
+	}
+	return trace, nil
+}
+
+// `-outcome pass,hang`: comma-separated outcomes of the runs to be processed (empty: all)
+type outcomeFilter map[historystorage.Outcome]bool
+
+const outcomeUsage = "process only the runs with these outcomes (comma-separated: pass, validation_failure, run_crash, hang, infra_error)"
+
+func (f outcomeFilter) String() string {
+	ss := make([]string, 0, len(f))
+	for o := range f {
+		ss = append(ss, string(o))
+	}
+	sort.Strings(ss)
+	return strings.Join(ss, ",")
+}
+
+func (f outcomeFilter) Set(s string) error {
+	for _, o := range strings.Split(s, ",") {
+		outcome, err := historystorage.ParseOutcome(strings.TrimSpace(o))
+		if err != nil {
+			return err
+		}
+		f[outcome] = true
+	}
+	return nil
+}
+
+func (f outcomeFilter) matchResult(result *historystorage.Result) bool {
+	return len(f) == 0 || f[result.Outcome]
+}
+
+// returns true if the outcome of the run is in the filter (or the filter is empty)
+func (f outcomeFilter) match(storage historystorage.HistoryStorage, id int) (bool, error) {
+	if len(f) == 0 {
+		return true, nil
+	}
+	result, err := historystorage.LoadResult(storage, id)
+	if err != nil {
+		return false, err
+	}
+	return f.matchResult(result), nil
+}
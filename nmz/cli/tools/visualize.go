@@ -18,6 +18,9 @@ package tools
 import (
 	"flag"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"sort"
 
 	"github.com/mitchellh/cli"
@@ -30,16 +33,32 @@ type visualizeFlags struct {
 	Mode string
 
 	POReduction bool
+
+	// for gnuplot
+	Format   string
+	Outcomes outcomeFilter
+
+	// for shiviz
+	TracePath   string
+	OutputPath  string
+	DOTPath     string
+	MermaidPath string
 }
 
 var (
 	visualizeFlagset = flag.NewFlagSet("visualize", flag.ExitOnError)
-	_visualizeFlags  = visualizeFlags{}
+	_visualizeFlags  = visualizeFlags{Outcomes: outcomeFilter{}}
 )
 
 func init() {
 	visualizeFlagset.StringVar(&_visualizeFlags.Mode, "mode", "", "mode of visualization")
 	visualizeFlagset.BoolVar(&_visualizeFlags.POReduction, "po-reduction", true, "count with partial order reduction")
+	visualizeFlagset.StringVar(&_visualizeFlags.Format, "format", formatText, "[gnuplot] "+formatUsage)
+	visualizeFlagset.Var(_visualizeFlags.Outcomes, "outcome", "[gnuplot] "+outcomeUsage)
+	visualizeFlagset.StringVar(&_visualizeFlags.TracePath, "trace-path", "", "[shiviz] path of trace data file (instead of <storage> <id>)")
+	visualizeFlagset.StringVar(&_visualizeFlags.OutputPath, "o", "", "[shiviz] output ShiViz log file (default: stdout)")
+	visualizeFlagset.StringVar(&_visualizeFlags.DOTPath, "dot", "", "[shiviz] also write a Graphviz DOT space-time diagram to this file")
+	visualizeFlagset.StringVar(&_visualizeFlags.MermaidPath, "mermaid", "", "[shiviz] also write a Mermaid sequence diagram to this file")
 }
 
 type uniqueTraceUnit struct {
@@ -135,16 +154,34 @@ func seenBeforePOR(traces []*uniqueTraceUnit, newUnit *uniqueTraceUnit) bool {
 	return false
 }
 
-func gnuplot(historyStoragePath string, poReduction bool) error {
-	storage := historystorage.LoadStorage(historyStoragePath)
+func gnuplot(historyStoragePath string, poReduction bool, format string) error {
+	storage, err := historystorage.LoadStorage(historyStoragePath)
+	if err != nil {
+		return fmt.Errorf("failed to load history storage %s: %s", historyStoragePath, err)
+	}
 
 	storage.Init()
 	nrStored := storage.NrStoredHistories()
 	nrUniques := 0
 	uniqueTraces := make([]*uniqueTraceUnit, 0)
+	records := make([]*runRecord, 0)
 
 	for i := 0; i < nrStored; i++ {
+		matched, err := _visualizeFlags.Outcomes.match(storage, i)
+		if isMissingRun(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to open history %08x, %s\n", i, err)
+		}
+		if !matched {
+			continue
+		}
+
 		trace, err := storage.GetStoredHistory(i)
+		if isMissingRun(err) {
+			continue
+		}
 		if err != nil {
 			return fmt.Errorf("failed to open history %08x, %s\n", i, err)
 		}
@@ -166,7 +203,75 @@ func gnuplot(historyStoragePath string, poReduction bool) error {
 			uniqueTraces = append(uniqueTraces, newUnit)
 		}
 
-		fmt.Printf("%d %d\n", i+1, nrUniques)
+		if format == formatText {
+			fmt.Printf("%d %d\n", i+1, nrUniques)
+		} else {
+			record := newRunRecord(storage, i)
+			unique, n := !seen, nrUniques
+			record.Unique, record.NrUniqueTraces = &unique, &n
+			records = append(records, record)
+		}
+	}
+	if format != formatText {
+		return writeRuns(os.Stdout, format, filepath.Base(filepath.Clean(historyStoragePath)), records)
+	}
+	return nil
+}
+
+func loadVisualizedTrace(args []string) (*SingleTrace, error) {
+	if _visualizeFlags.TracePath != "" {
+		return loadTraceFile(_visualizeFlags.TracePath)
+	}
+	if len(args) != 2 {
+		return nil, fmt.Errorf("need history storage path and run ID (or -trace-path)")
+	}
+	id, err := parseRunID(args[1])
+	if err != nil {
+		return nil, err
+	}
+	storage, err := historystorage.LoadStorage(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to load history storage %s: %s", args[0], err)
+	}
+	storage.Init()
+	return storage.GetStoredHistory(id)
+}
+
+func writeFile(path string, f func(w io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return f(file)
+}
+
+func shiviz(args []string) error {
+	trace, err := loadVisualizedTrace(args)
+	if err != nil {
+		return err
+	}
+	evs := buildSpaceTime(trace)
+
+	if _visualizeFlags.OutputPath == "" {
+		err = writeShiViz(os.Stdout, evs)
+	} else {
+		err = writeFile(_visualizeFlags.OutputPath, func(w io.Writer) error { return writeShiViz(w, evs) })
+	}
+	if err != nil {
+		return err
+	}
+	if _visualizeFlags.DOTPath != "" {
+		err = writeFile(_visualizeFlags.DOTPath, func(w io.Writer) error { writeDOT(w, evs); return nil })
+		if err != nil {
+			return err
+		}
+	}
+	if _visualizeFlags.MermaidPath != "" {
+		err = writeFile(_visualizeFlags.MermaidPath, func(w io.Writer) error { writeMermaid(w, evs); return nil })
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -189,15 +294,29 @@ func (cmd visualizeCmd) Help() string {
 func (cmd visualizeCmd) Run(args []string) int {
 	visualizeFlagset.Parse(args)
 
+	if err := checkFormat(_visualizeFlags.Format); err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+
 	switch _visualizeFlags.Mode {
 	case "gnuplot":
 		if visualizeFlagset.NArg() != 1 {
 			fmt.Printf("need a path of history storage")
 		}
-		if err := gnuplot(args[len(args)-1], _visualizeFlags.POReduction); err != nil {
+		if err := gnuplot(args[len(args)-1], _visualizeFlags.POReduction, _visualizeFlags.Format); err != nil {
 			fmt.Printf("%s", err)
 			return 1
 		}
+	case "shiviz":
+		if _visualizeFlags.Format != formatText {
+			fmt.Printf("-format is not supported for shiviz (use -o, -dot, -mermaid)\n")
+			return 1
+		}
+		if err := shiviz(visualizeFlagset.Args()); err != nil {
+			fmt.Printf("%s\n", err)
+			return 1
+		}
 	default:
 		fmt.Printf("unknown mode of visualize: %s\n", _visualizeFlags.Mode)
 		return 1
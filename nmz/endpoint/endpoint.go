@@ -34,6 +34,19 @@ const (
 	endpointTypePB
 )
 
+func (typ endpointType) String() string {
+	switch typ {
+	case endpointTypeLocal:
+		return "local"
+	case endpointTypeREST:
+		return "rest"
+	case endpointTypePB:
+		return "pb"
+	default:
+		return "unknown"
+	}
+}
+
 var (
 	muxEventCh  = make(chan signal.Event)
 	muxActionCh chan signal.Action
@@ -92,7 +105,7 @@ func StartAll(actionCh chan signal.Action, cfg config.Config) (chan signal.Event
 		if pbPort >= 0 {
 			// zero is also legal (auto-assign)
 			log.Infof("PB port: %d", pbPort)
-			restEventCh = pb.SingletonPBEndpoint.Start(pbPort, restActionCh)
+			pbEventCh = pb.SingletonPBEndpoint.Start(pbPort, pbActionCh)
 		} else {
 			log.Warnf("ignoring pbPort: %d", pbPort)
 		}
@@ -119,6 +132,17 @@ func registerEntityEndpointType(entityID string, typ endpointType) {
 	entityEndpointTypesMu.Unlock()
 }
 
+// Returns the registered entities and their endpoint types ("local", "rest", "pb")
+func EntityEndpointTypes() map[string]string {
+	entityEndpointTypesMu.RLock()
+	defer entityEndpointTypesMu.RUnlock()
+	m := make(map[string]string, len(entityEndpointTypes))
+	for entityID, typ := range entityEndpointTypes {
+		m[entityID] = typ.String()
+	}
+	return m
+}
+
 // Dispatch where action should be sent (localActionCh, restActionCh, pbActionCh..)
 func dispatchAction(action signal.Action) {
 	log.Debugf("EP handling action %s", action)
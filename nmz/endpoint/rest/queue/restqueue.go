@@ -21,11 +21,15 @@ import (
 
 	log "github.com/cihub/seelog"
 	. "github.com/osrg/namazu/nmz/signal"
+	"github.com/osrg/namazu/nmz/util/metrics"
 )
 
 var (
 	queues     = make(map[string]*ActionQueue, 0)
 	queuesLock = sync.RWMutex{}
+
+	queuedActions = metrics.NewGaugeVec("nmz_rest_action_queue_items",
+		"Number of actions waiting for being fetched by REST inspectors.", "entity")
 )
 
 // concurrent-safe, deletable queue
@@ -106,6 +110,7 @@ func (this *ActionQueue) Put(action Action) {
 	this.actionsLock.Lock()
 	oldLen := len(this.actions)
 	this.actions = append(this.actions, action)
+	queuedActions.Set(float64(len(this.actions)), this.EntityID)
 	this.actionsLock.Unlock()
 	this.actionsUpdatedCh <- true
 	log.Debugf("ActionQueue[%s]: Put(%d->%d) %s", this.EntityID, oldLen, oldLen+1, action)
@@ -130,6 +135,7 @@ func (this *ActionQueue) Delete(actionUUID string) {
 	}
 	if deleted > 0 {
 		this.actions = newActions
+		queuedActions.Set(float64(newLen), this.EntityID)
 	}
 	log.Debugf("ActionQueue[%s]: Deleted(%d->%d) %s", this.EntityID, oldLen, newLen, actionUUID)
 }
@@ -16,6 +16,7 @@
 package rest
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -29,6 +30,8 @@ import (
 	"github.com/gorilla/mux"
 	. "github.com/osrg/namazu/nmz/endpoint/rest/queue"
 	. "github.com/osrg/namazu/nmz/signal"
+	"github.com/osrg/namazu/nmz/util/dashboard"
+	"github.com/osrg/namazu/nmz/util/metrics"
 	restutil "github.com/osrg/namazu/nmz/util/rest"
 )
 
@@ -147,6 +150,8 @@ func actionsOnDelete(w http.ResponseWriter, r *http.Request) {
 const (
 	opDisableOrchestration = "disableOrchestration"
 	opEnableOrchestration  = "enableOrchestration"
+	opReleaseEvent         = "release"
+	opFaultEvent           = "fault"
 )
 
 func controlEnableOrchestration(w http.ResponseWriter, r *http.Request) {
@@ -159,6 +164,75 @@ func controlDisableOrchestration(w http.ResponseWriter, r *http.Request) {
 	orchestratorControlCh <- Control{Op: ControlDisableOrchestration}
 }
 
+// sends a control to the orchestrator, and writes the result as JSON
+func writeControlResult(w http.ResponseWriter, op int, arg interface{}) {
+	resultCh := make(chan ControlResult)
+	orchestratorControlCh <- Control{Op: op, Arg: arg, ResultCh: resultCh}
+	result := <-resultCh
+	switch result.Err.(type) {
+	case nil:
+	case ControlArgError:
+		restutil.WriteErrorWithStatus(w, result.Err, http.StatusBadRequest)
+		return
+	case ControlNotFoundError:
+		restutil.WriteErrorWithStatus(w, result.Err, http.StatusNotFound)
+		return
+	default:
+		restutil.WriteError(w, result.Err)
+		return
+	}
+	if err := restutil.WriteJSON(w, result.Value); err != nil {
+		restutil.WriteError(w, err)
+	}
+}
+
+// @app.route(api_root + '/control/events', methods=['GET'])
+func controlGetPendingEvents(w http.ResponseWriter, r *http.Request) {
+	writeControlResult(w, ControlGetPendingEvents, nil)
+}
+
+// @app.route(api_root + '/control/events/<event_uuid>?op=release', methods=['POST'])
+func controlReleaseEvent(w http.ResponseWriter, r *http.Request) {
+	eventUUID := mux.Vars(r)["event_uuid"]
+	log.Infof("releasing event %s", eventUUID)
+	writeControlResult(w, ControlReleaseEvent, eventUUID)
+}
+
+// @app.route(api_root + '/control/events/<event_uuid>?op=fault', methods=['POST'])
+func controlFaultEvent(w http.ResponseWriter, r *http.Request) {
+	eventUUID := mux.Vars(r)["event_uuid"]
+	log.Infof("injecting fault for event %s", eventUUID)
+	writeControlResult(w, ControlFaultEvent, eventUUID)
+}
+
+// @app.route(api_root + '/control/actions', methods=['GET'])
+func controlGetRecentActions(w http.ResponseWriter, r *http.Request) {
+	writeControlResult(w, ControlGetRecentActions, nil)
+}
+
+// @app.route(api_root + '/control/entities', methods=['GET'])
+func controlGetEntities(w http.ResponseWriter, r *http.Request) {
+	writeControlResult(w, ControlGetEntities, nil)
+}
+
+// @app.route(api_root + '/control/policy', methods=['GET'])
+func controlGetPolicyConfig(w http.ResponseWriter, r *http.Request) {
+	writeControlResult(w, ControlGetPolicyConfig, nil)
+}
+
+// @app.route(api_root + '/control/policy', methods=['PUT'])
+//
+// the body is a JSON object for "explorePolicyParam"
+func controlReloadPolicyConfig(w http.ResponseWriter, r *http.Request) {
+	param := make(map[string]interface{})
+	if err := json.NewDecoder(r.Body).Decode(&param); err != nil {
+		restutil.WriteErrorWithStatus(w, err, http.StatusBadRequest)
+		return
+	}
+	log.Infof("reloading explorePolicyParam")
+	writeControlResult(w, ControlReloadPolicyConfig, param)
+}
+
 func actionPropagatorRoutine() {
 	for {
 		action := <-orchestratorActionCh
@@ -191,12 +265,21 @@ var (
 func newRouter() http.Handler {
 	router := mux.NewRouter().StrictSlash(true)
 	router.HandleFunc("/", rootOnGet).Methods("GET")
+	router.Handle("/dashboard", dashboard.NewLiveHandler()).Methods("GET")
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
 	router.HandleFunc(path.Join(restutil.APIRoot, "/events/{entity_id}/{event_uuid}"), eventsOnPost).Methods("POST")
 	router.HandleFunc(path.Join(restutil.APIRoot, "/actions/{entity_id}"), actionsOnGet).Methods("GET")
 	router.HandleFunc(path.Join(restutil.APIRoot, "/actions/{entity_id}/{action_uuid}"), actionsOnDelete).Methods("DELETE")
 
 	router.HandleFunc(path.Join(restutil.APIRoot, "/control"), controlEnableOrchestration).Queries("op", "enableOrchestration").Methods("POST")
 	router.HandleFunc(path.Join(restutil.APIRoot, "/control"), controlDisableOrchestration).Queries("op", "disableOrchestration").Methods("POST")
+	router.HandleFunc(path.Join(restutil.APIRoot, "/control/events"), controlGetPendingEvents).Methods("GET")
+	router.HandleFunc(path.Join(restutil.APIRoot, "/control/events/{event_uuid}"), controlReleaseEvent).Queries("op", opReleaseEvent).Methods("POST")
+	router.HandleFunc(path.Join(restutil.APIRoot, "/control/events/{event_uuid}"), controlFaultEvent).Queries("op", opFaultEvent).Methods("POST")
+	router.HandleFunc(path.Join(restutil.APIRoot, "/control/actions"), controlGetRecentActions).Methods("GET")
+	router.HandleFunc(path.Join(restutil.APIRoot, "/control/entities"), controlGetEntities).Methods("GET")
+	router.HandleFunc(path.Join(restutil.APIRoot, "/control/policy"), controlGetPolicyConfig).Methods("GET")
+	router.HandleFunc(path.Join(restutil.APIRoot, "/control/policy"), controlReloadPolicyConfig).Methods("PUT")
 
 	return router
 }
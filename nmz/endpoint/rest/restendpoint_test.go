@@ -16,10 +16,13 @@
 package rest
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 
@@ -151,3 +154,66 @@ func testRESTEndpointShouldNotBlockWithPacketEvent(t *testing.T, n, entities int
 	}
 	// TODO: clean up transceivers
 }
+
+func TestRESTEndpointControl(t *testing.T) {
+	// mock the orchestrator side of orchestratorControlCh
+	go func() {
+		for i := 0; i < 5; i++ {
+			control := <-orchestratorControlCh
+			var result signal.ControlResult
+			switch control.Op {
+			case signal.ControlFaultEvent:
+				result.Value = map[string]interface{}{"event_uuid": control.Arg}
+			case signal.ControlReleaseEvent:
+				result.Err = signal.ControlNotFoundError{Err: fmt.Errorf("no pending event %s", control.Arg)}
+			case signal.ControlReloadPolicyConfig:
+				if _, ok := control.Arg.(map[string]interface{})["bad"]; ok {
+					result.Err = signal.ControlArgError{Err: fmt.Errorf("bad explorePolicyParam")}
+					break
+				}
+				result.Value = control.Arg
+			default:
+				result.Err = fmt.Errorf("unexpected op %d", control.Op)
+			}
+			control.ResultCh <- result
+		}
+	}()
+
+	res, err := http.Post(srv.URL+restutil.APIRoot+"/control/events/dummy-uuid?op=fault", "application/json", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	m := make(map[string]interface{})
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&m))
+	res.Body.Close()
+	assert.Equal(t, "dummy-uuid", m["event_uuid"])
+
+	req, err := http.NewRequest("PUT", srv.URL+restutil.APIRoot+"/control/policy",
+		strings.NewReader(`{"minInterval": "10ms"}`))
+	assert.NoError(t, err)
+	res, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	m = make(map[string]interface{})
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&m))
+	res.Body.Close()
+	assert.Equal(t, "10ms", m["minInterval"])
+
+	res, err = http.Post(srv.URL+restutil.APIRoot+"/control/events/dummy-uuid?op=release", "application/json", nil)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	req, err = http.NewRequest("PUT", srv.URL+restutil.APIRoot+"/control/policy",
+		strings.NewReader(`{"bad": true}`))
+	assert.NoError(t, err)
+	res, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	// unexpected op in the mock orchestrator
+	res, err = http.Get(srv.URL + restutil.APIRoot + "/control/entities")
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+}
@@ -17,6 +17,7 @@
 package dumb
 
 import (
+	"sync"
 	"time"
 
 	log "github.com/cihub/seelog"
@@ -36,10 +37,18 @@ type Dumb struct {
 
 	// parameter "interval"
 	Interval time.Duration
+
+	// protects the parameters, as LoadConfig() can be called while the policy is running
+	paramMu sync.RWMutex
 }
 
 func New() *Dumb {
-	q := queue.NewBasicTBQueue()
+	return NewWithQueueOwner(Name)
+}
+
+// queueOwner is the label of nmz_queue_items (e.g. for telling the fallback policy of the orchestrator from the configured one)
+func NewWithQueueOwner(queueOwner string) *Dumb {
+	q := queue.NewBasicTBQueue(queueOwner)
 	d := &Dumb{
 		nextActionChan: make(chan signal.Action),
 		queue:          q,
@@ -63,6 +72,8 @@ func (d *Dumb) Name() string {
 // should support dynamic reloading
 func (d *Dumb) LoadConfig(cfg config.Config) error {
 	log.Debugf("CONFIG: %s", cfg.AllSettings())
+	d.paramMu.Lock()
+	defer d.paramMu.Unlock()
 	paramInterval := "explorepolicyparam.interval"
 	if cfg.IsSet(paramInterval) {
 		d.Interval = cfg.GetDuration(paramInterval)
@@ -82,7 +93,10 @@ func (d *Dumb) ActionChan() chan signal.Action {
 }
 
 func (d *Dumb) QueueEvent(event signal.Event) {
-	item, err := queue.NewBasicTBQueueItem(event, d.Interval, d.Interval)
+	d.paramMu.RLock()
+	interval := d.Interval
+	d.paramMu.RUnlock()
+	item, err := queue.NewBasicTBQueueItem(event, interval, interval)
 	if err != nil {
 		panic(log.Critical(err))
 	}
@@ -18,6 +18,7 @@ package explorepolicy
 import (
 	"flag"
 	"github.com/osrg/namazu/nmz/explorepolicy/dumb"
+	"github.com/osrg/namazu/nmz/explorepolicy/manual"
 	"github.com/osrg/namazu/nmz/explorepolicy/random"
 	logutil "github.com/osrg/namazu/nmz/util/log"
 	"github.com/stretchr/testify/assert"
@@ -39,6 +40,9 @@ func TestPoliciesAreRegistered(t *testing.T) {
 	r, err := CreatePolicy("random")
 	assert.NoError(t, err)
 	assert.IsType(t, &random.Random{}, r)
+	m, err := CreatePolicy("manual")
+	assert.NoError(t, err)
+	assert.IsType(t, &manual.Manual{}, m)
 	x, err := CreatePolicy("thisshouldnotexist")
 	assert.Error(t, err)
 	assert.Nil(t, x)
@@ -38,3 +38,10 @@ type ExplorePolicy interface {
 	// queue event
 	QueueEvent(signal.Event)
 }
+
+// implemented by the policies which hold the events until the operator determines the actions (e.g. manual),
+// so that they can drop the events determined via the control API of the orchestrator.
+type ForcedEventHandler interface {
+	// called after the orchestrator determined the action for the pending event regardless of the policy
+	EventForced(event signal.Event)
+}
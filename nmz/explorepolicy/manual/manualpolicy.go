@@ -0,0 +1,185 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package manual provides the policy which lets an operator determine actions by hand
+package manual
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/osrg/namazu/nmz/historystorage"
+	"github.com/osrg/namazu/nmz/signal"
+	"github.com/osrg/namazu/nmz/util/config"
+)
+
+type Manual struct {
+	// channel
+	actionCh chan signal.Action
+
+	// deferred events held until Release(), Fault() or StepRandom() is called
+	pending   []signal.Event
+	pendingMu sync.Mutex
+
+	rand *rand.Rand
+}
+
+func New() *Manual {
+	m := &Manual{
+		actionCh: make(chan signal.Action),
+		pending:  make([]signal.Event, 0),
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	return m
+}
+
+const Name = "manual"
+
+// returns "manual"
+func (m *Manual) Name() string {
+	return Name
+}
+
+// parameters:
+//  - seed(int): seed for StepRandom() (default: current time)
+//
+// should support dynamic reloading
+func (m *Manual) LoadConfig(cfg config.Config) error {
+	log.Debugf("CONFIG: %s", cfg.AllSettings())
+	paramSeed := "explorepolicyparam.seed"
+	if cfg.IsSet(paramSeed) {
+		seed := int64(cfg.GetInt(paramSeed))
+		m.pendingMu.Lock()
+		m.rand = rand.New(rand.NewSource(seed))
+		m.pendingMu.Unlock()
+		log.Infof("Set seed=%d", seed)
+	}
+	return nil
+}
+
+func (m *Manual) SetHistoryStorage(storage historystorage.HistoryStorage) error {
+	return nil
+}
+
+func (m *Manual) ActionChan() chan signal.Action {
+	return m.actionCh
+}
+
+// non-deferred events are accepted immediately, as no one is waiting for them
+func (m *Manual) QueueEvent(event signal.Event) {
+	if event.Deferred() {
+		m.pendingMu.Lock()
+		m.pending = append(m.pending, event)
+		m.pendingMu.Unlock()
+		return
+	}
+	action, err := event.DefaultAction()
+	if err != nil {
+		panic(log.Critical(err))
+	}
+	go func() {
+		m.actionCh <- action
+	}()
+}
+
+// returns the pending events in the arrival order
+func (m *Manual) PendingEvents() []signal.Event {
+	m.pendingMu.Lock()
+	defer m.pendingMu.Unlock()
+	events := make([]signal.Event, len(m.pending))
+	copy(events, m.pending)
+	return events
+}
+
+// removes the pending event. returns nil if not found.
+func (m *Manual) takeEvent(eventID string) signal.Event {
+	m.pendingMu.Lock()
+	defer m.pendingMu.Unlock()
+	for i, event := range m.pending {
+		if event.ID() == eventID {
+			m.pending = append(m.pending[:i], m.pending[i+1:]...)
+			return event
+		}
+	}
+	return nil
+}
+
+// drops the event released or faulted via the control API of the orchestrator
+func (m *Manual) EventForced(event signal.Event) {
+	if m.takeEvent(event.ID()) != nil {
+		log.Debugf("MANUAL: Dropped event %s determined by the orchestrator", event)
+	}
+}
+
+func (m *Manual) determine(eventID string, fault bool) (signal.Action, error) {
+	event := m.takeEvent(eventID)
+	if event == nil {
+		return nil, fmt.Errorf("no pending event %s", eventID)
+	}
+	var action signal.Action
+	var err error
+	if fault {
+		action, err = event.DefaultFaultAction()
+		if err == nil && action == nil {
+			err = fmt.Errorf("event %s has no fault action", eventID)
+		}
+	} else {
+		action, err = event.DefaultAction()
+	}
+	if err != nil {
+		// put it back so that the operator can choose another action
+		m.pendingMu.Lock()
+		m.pending = append([]signal.Event{event}, m.pending...)
+		m.pendingMu.Unlock()
+		return nil, err
+	}
+	log.Debugf("MANUAL: Determined action %s for event %s", action, event)
+	m.actionCh <- action
+	return action, nil
+}
+
+// releases the pending event with its default action
+func (m *Manual) Release(eventID string) (signal.Action, error) {
+	return m.determine(eventID, false)
+}
+
+// injects the default fault action for the pending event
+func (m *Manual) Fault(eventID string) (signal.Action, error) {
+	return m.determine(eventID, true)
+}
+
+// releases n pending events chosen at random.
+// returns the determined actions, which can be fewer than n if there are not enough pending events.
+func (m *Manual) StepRandom(n int) ([]signal.Action, error) {
+	actions := make([]signal.Action, 0, n)
+	for i := 0; i < n; i++ {
+		m.pendingMu.Lock()
+		if len(m.pending) == 0 {
+			m.pendingMu.Unlock()
+			break
+		}
+		eventID := m.pending[m.rand.Intn(len(m.pending))].ID()
+		m.pendingMu.Unlock()
+		action, err := m.Release(eventID)
+		if err != nil {
+			return actions, err
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
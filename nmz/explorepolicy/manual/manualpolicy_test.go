@@ -0,0 +1,91 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manual
+
+import (
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/osrg/namazu/nmz/signal"
+	logutil "github.com/osrg/namazu/nmz/util/log"
+	testutil "github.com/osrg/namazu/nmz/util/test"
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	logutil.InitLog("", true)
+	signal.RegisterKnownSignals()
+	os.Exit(m.Run())
+}
+
+func TestManualHoldsDeferredEvents(t *testing.T) {
+	policy := New()
+	nop := testutil.NewNopEvent(t, "entity-0", 0)
+	policy.QueueEvent(nop)
+	action := <-policy.ActionChan()
+	assert.Equal(t, nop.ID(), action.Event().ID())
+
+	events := make([]signal.Event, 3)
+	for i := range events {
+		events[i] = testutil.NewPacketEvent(t, "entity-0", i)
+		policy.QueueEvent(events[i])
+	}
+	assert.Len(t, policy.PendingEvents(), 3)
+
+	actionCh := make(chan signal.Action, 3)
+	go func() {
+		for i := 0; i < 3; i++ {
+			actionCh <- <-policy.ActionChan()
+		}
+	}()
+
+	action, err := policy.Release(events[2].ID())
+	assert.NoError(t, err)
+	assert.IsType(t, &signal.EventAcceptanceAction{}, action)
+	assert.Equal(t, action, <-actionCh)
+
+	action, err = policy.Fault(events[0].ID())
+	assert.NoError(t, err)
+	assert.IsType(t, &signal.PacketFaultAction{}, action)
+	assert.Equal(t, action, <-actionCh)
+
+	_, err = policy.Release(events[0].ID())
+	assert.Error(t, err)
+
+	actions, err := policy.StepRandom(2)
+	assert.NoError(t, err)
+	assert.Len(t, actions, 1)
+	assert.Equal(t, events[1].ID(), (<-actionCh).Event().ID())
+	assert.Empty(t, policy.PendingEvents())
+}
+
+func TestManualEventForced(t *testing.T) {
+	policy := New()
+	events := make([]signal.Event, 2)
+	for i := range events {
+		events[i] = testutil.NewPacketEvent(t, "entity-0", i)
+		policy.QueueEvent(events[i])
+	}
+	policy.EventForced(events[0])
+	pending := policy.PendingEvents()
+	assert.Len(t, pending, 1)
+	assert.Equal(t, events[1].ID(), pending[0].ID())
+	_, err := policy.Release(events[0].ID())
+	assert.Error(t, err)
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/osrg/namazu/nmz/util/config"
 	queue "github.com/osrg/namazu/nmz/util/queue"
 	"math/rand"
+	"sync"
 	"time"
 )
 
@@ -56,6 +57,9 @@ type Random struct {
 	// parameter "faultActionProbability”
 	FaultActionProbability float64
 
+	// parameter "failpointMaxSleep"
+	FailpointMaxSleep time.Duration
+
 	// parameter "procPolicy"
 	ProcPolicy string
 
@@ -69,6 +73,9 @@ type Random struct {
 
 	// parameter "procPolicyParam" (for "dirichlet" procPolicy)
 	PPPDirichlet pppDirichlet
+
+	// protects the parameters (and procPolicy), as LoadConfig() can be called while the policy is running
+	paramMu sync.RWMutex
 }
 
 type procPolicyIntf interface {
@@ -92,7 +99,7 @@ type pppDirichlet struct {
 
 func New() *Random {
 	nextActionChan := make(chan signal.Action)
-	q := queue.NewBasicTBQueue()
+	q := queue.NewBasicTBQueue(Name)
 	r := &Random{
 		nextActionChan:           nextActionChan,
 		queue:                    q,
@@ -104,6 +111,7 @@ func New() *Random {
 		ShellActionInterval:      time.Duration(0),
 		ShellActionCommand:       "",
 		FaultActionProbability:   0.0,
+		FailpointMaxSleep:        signal.DefaultFailpointSleep,
 		ProcPolicy:               "mild",
 		PPPMild: pppMild{
 			UseBatch: true,
@@ -140,6 +148,9 @@ func (this *Random) Name() string {
 //    NOTE: the command execution blocks.
 //
 //  - faultActionProbability(float64): probability (0.0-1.0) of PacketFaultAction/FilesystemFaultAction (default: 0.0)
+//    For FailpointEvent, one of the terms of the failpoint (error, panic, sleep) is chosen randomly.
+//
+//  - failpointMaxSleep(duration): max sleep of FailpointSleepAction (default: 1s)
 //
 //  - procPolicy(string): "mild", "extreme", "dirichlet", ..
 //
@@ -158,6 +169,8 @@ func (r *Random) LoadConfig(cfg config.Config) error {
 	if policyName != r.Name() {
 		log.Warnf("Policy name mismatch: \"%s\" != \"%s\"", policyName, r.Name())
 	}
+	r.paramMu.Lock()
+	defer r.paramMu.Unlock()
 
 	epp := "explorepolicyparam."
 	paramMinInterval := epp + "minInterval"
@@ -182,6 +195,8 @@ func (r *Random) LoadConfig(cfg config.Config) error {
 	if cfg.IsSet(paramPrioritizedEntities) {
 		slice := cfg.GetStringSlice(paramPrioritizedEntities)
 		if slice != nil {
+			// replaced rather than extended, so that reloading can remove entities
+			r.PrioritizedEntities = make(map[string]bool, len(slice))
 			for i := 0; i < len(slice); i++ {
 				r.PrioritizedEntities[slice[i]] = true
 			}
@@ -210,7 +225,6 @@ func (r *Random) LoadConfig(cfg config.Config) error {
 	}
 
 	if r.ShellActionInterval > 0 && !r.shelActionRoutineRunning {
-		// FIXME: not thread safe!
 		r.shelActionRoutineRunning = true
 		go r.shellFaultInjectionRoutine()
 	}
@@ -224,6 +238,15 @@ func (r *Random) LoadConfig(cfg config.Config) error {
 		return fmt.Errorf("bad faultActionProbability %f", r.FaultActionProbability)
 	}
 
+	paramFailpointMaxSleep := epp + "failpointMaxSleep"
+	if cfg.IsSet(paramFailpointMaxSleep) {
+		r.FailpointMaxSleep = cfg.GetDuration(paramFailpointMaxSleep)
+		log.Infof("Set failpointMaxSleep=%s", r.FailpointMaxSleep)
+	}
+	if r.FailpointMaxSleep < 0 {
+		return fmt.Errorf("failpointMaxSleep(=%s) must be non-negative value", r.FailpointMaxSleep)
+	}
+
 	return r.loadProcConfig(cfg)
 }
 
@@ -279,16 +302,22 @@ func (r *Random) ActionChan() chan signal.Action {
 
 // put a ShellAction to nextActionChan
 func (r *Random) shellFaultInjectionRoutine() {
-	if r.ShellActionInterval == 0 {
-		panic(fmt.Errorf("implementation error. should not be called here."))
-	}
 	for {
-		<-time.After(r.ShellActionInterval)
+		r.paramMu.Lock()
+		interval, command := r.ShellActionInterval, r.ShellActionCommand
+		if interval == 0 {
+			// reloaded with shellActionInterval=0 (LoadConfig() restarts the routine when needed)
+			r.shelActionRoutineRunning = false
+			r.paramMu.Unlock()
+			return
+		}
+		r.paramMu.Unlock()
+		<-time.After(interval)
 		// NOTE: you can also set arbitrary info (e.g., expected shutdown or unexpected kill)
 		comments := map[string]interface{}{
 			"comment": "injected by the random explorer",
 		}
-		action, err := signal.NewShellAction(r.ShellActionCommand, comments)
+		action, err := signal.NewShellAction(command, comments)
 		if err != nil {
 			panic(log.Critical(err))
 		}
@@ -298,9 +327,13 @@ func (r *Random) shellFaultInjectionRoutine() {
 
 // for dequeueRoutine()
 func (r *Random) makeActionForEvent(event signal.Event) (signal.Action, error) {
+	r.paramMu.RLock()
+	defer r.paramMu.RUnlock()
 	switch event.(type) {
 	case *signal.ProcSetEvent:
 		return r.procPolicy.Action(event.(*signal.ProcSetEvent))
+	case *signal.FailpointEvent:
+		return r.makeActionForFailpointEvent(event.(*signal.FailpointEvent))
 	}
 	defaultAction, defaultActionErr := event.DefaultAction()
 	faultAction, faultActionErr := event.DefaultFaultAction()
@@ -315,6 +348,21 @@ func (r *Random) makeActionForEvent(event signal.Event) (signal.Action, error) {
 	}
 }
 
+// continues, or injects one of the terms of the failpoint (with FaultActionProbability)
+func (r *Random) makeActionForFailpointEvent(event *signal.FailpointEvent) (signal.Action, error) {
+	terms := event.Terms()
+	if len(terms) == 0 || rand.Intn(999) >= int(r.FaultActionProbability*1000.0) {
+		return event.DefaultAction()
+	}
+	term := terms[rand.Intn(len(terms))]
+	sleep := time.Duration(0)
+	if r.FailpointMaxSleep > 0 {
+		sleep = time.Duration(rand.Int63n(int64(r.FailpointMaxSleep)))
+	}
+	log.Debugf("Injecting failpoint term %s for %s", term, event)
+	return event.FaultAction(term, sleep)
+}
+
 // dequeue event, determine corresponding action, and put the action to nextActionChan
 func (r *Random) dequeueEventRoutine() {
 	for {
@@ -330,9 +378,11 @@ func (r *Random) dequeueEventRoutine() {
 }
 
 func (r *Random) QueueEvent(event signal.Event) {
+	r.paramMu.RLock()
 	minInterval := r.MinInterval
 	maxInterval := r.MaxInterval
 	_, prioritized := r.PrioritizedEntities[event.EntityID()]
+	r.paramMu.RUnlock()
 	if prioritized {
 		// FIXME: magic coefficient for prioritizing (decrease intervals)
 		minInterval = time.Duration(float64(minInterval) * 0.8)
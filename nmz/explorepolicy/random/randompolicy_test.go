@@ -71,6 +71,7 @@ explorePolicy = "random"
 	assert.Zero(t, policy.ShellActionInterval)
 	assert.Empty(t, policy.ShellActionCommand)
 	assert.True(t, policy.FaultActionProbability < 0.01)
+	assert.Equal(t, signal.DefaultFailpointSleep, policy.FailpointMaxSleep)
 	assert.True(t, policy.PPPDirichlet.ResetProbability > 0.09)
 
 	badPolicyNameAllowedForExtensibility := `
@@ -82,6 +83,7 @@ explorePolicy = "randomBADBAD"
   shellActionInterval = "10s"
   shellActionCommand = "echo hello world"
   faultActionProbability = 0.1
+  failpointMaxSleep = "200ms"
   thisParameterDoesNotExistButShouldNotMatter = 42
   procPolicy = "dirichlet"
 
@@ -97,6 +99,7 @@ explorePolicy = "randomBADBAD"
 	assert.Equal(t, policy.ShellActionInterval, 10*time.Second)
 	assert.Equal(t, policy.ShellActionCommand, "echo hello world")
 	assert.True(t, policy.FaultActionProbability > 0.09)
+	assert.Equal(t, policy.FailpointMaxSleep, 200*time.Millisecond)
 	assert.Equal(t, policy.ProcPolicy, "dirichlet")
 	assert.True(t, policy.PPPDirichlet.ResetProbability < 0.01)
 }
@@ -117,6 +120,35 @@ func TestRandomPolicyShouldNotBlockWithPacketEvent_10_10(t *testing.T) {
 	tester.XTestPolicyWithPacketEvent(t, newPolicy(t), 10, 10, false)
 }
 
+// LoadConfig() can be called while the policy is running (e.g. PUT /api/v3/control/policy)
+func TestRandomPolicyReloadWithPacketEvent_10_2(t *testing.T) {
+	policy := newPolicy(t)
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for i := 0; ; i = (i + 1) % 10 {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			cfg, err := config.NewFromString(fmt.Sprintf(`
+explorePolicy = "random"
+[explorePolicyParam]
+  minInterval = "%dms"
+  maxInterval = "100ms"
+  faultActionProbability = 0.%d
+`, i*10, i), "toml")
+			assert.NoError(t, err)
+			assert.NoError(t, policy.LoadConfig(cfg))
+		}
+	}()
+	tester.XTestPolicyWithPacketEvent(t, policy, 10, 2, true)
+	close(stop)
+	<-stopped
+}
+
 func TestRandomPolicyDirichlet_100(t *testing.T) {
 	testRandomPolicyDirichlet(t, 100)
 }
@@ -196,3 +228,29 @@ explorePolicy = "random"
 	attrs := option["attrs"].(map[string]linuxsched.SchedAttr)
 	assert.NotNil(t, attrs)
 }
+
+func TestRandomPolicyWithFailpointEvent(t *testing.T) {
+	policy := New()
+	policy.FaultActionProbability = 1.0
+	policy.FailpointMaxSleep = 10 * time.Millisecond
+	event, err := signal.NewFailpointEvent("dummy", "raftBeforeSave",
+		[]string{signal.FailpointTermError, signal.FailpointTermSleep})
+	assert.NoError(t, err)
+	classes := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		action, err := policy.makeActionForEvent(event)
+		assert.NoError(t, err)
+		classes[action.JSONMap()["class"].(string)] = true
+		if sleepAction, ok := action.(*signal.FailpointSleepAction); ok {
+			duration, err := sleepAction.Duration()
+			assert.NoError(t, err)
+			assert.True(t, duration < 10*time.Millisecond, "%s", duration)
+		}
+	}
+	assert.Equal(t, map[string]bool{"FailpointErrorAction": true, "FailpointSleepAction": true}, classes)
+
+	policy.FaultActionProbability = 0.0
+	action, err := policy.makeActionForEvent(event)
+	assert.NoError(t, err)
+	assert.IsType(t, &signal.EventAcceptanceAction{}, action)
+}
@@ -17,6 +17,7 @@ package explorepolicy
 
 import (
 	dumb "github.com/osrg/namazu/nmz/explorepolicy/dumb"
+	manual "github.com/osrg/namazu/nmz/explorepolicy/manual"
 	random "github.com/osrg/namazu/nmz/explorepolicy/random"
 	replayable "github.com/osrg/namazu/nmz/explorepolicy/replayable"
 )
@@ -25,4 +26,5 @@ func RegisterKnownExplorePolicies() {
 	RegisterPolicy(dumb.Name, func() ExplorePolicy { return dumb.New() })
 	RegisterPolicy(random.Name, func() ExplorePolicy { return random.New() })
 	RegisterPolicy(replayable.Name, func() ExplorePolicy { return replayable.New() })
+	RegisterPolicy(manual.Name, func() ExplorePolicy { return manual.New() })
 }
@@ -17,8 +17,10 @@
 package replayable
 
 import (
+	"fmt"
 	"hash/fnv"
 	"os"
+	"sync"
 	"time"
 
 	log "github.com/cihub/seelog"
@@ -36,14 +38,35 @@ type Replayable struct {
 
 	// parameter "seed"
 	Seed string
+
+	// parameter "trace"
+	TracePath string
+
+	// parameter "traceTimeout"
+	TraceTimeout time.Duration
+
+	// the rest of the trace, and the events waiting for the preceding steps (see trace.go)
+	traceSteps          []traceStep
+	traceRemaining      map[string]int
+	tracePending        map[string][]signal.Event
+	traceRoutineRunning bool
+	traceWakeCh         chan struct{}
+	traceMu             sync.Mutex
+
+	// protects the parameters, as LoadConfig() can be called while the policy is running
+	paramMu sync.RWMutex
 }
 
 func New() *Replayable {
 	log.Warnf("The replayable explorer is EXPERIMENTAL feature.")
 	r := &Replayable{
-		actionCh:    make(chan signal.Action),
-		MaxInterval: time.Duration(0),
-		Seed:        "",
+		actionCh:       make(chan signal.Action),
+		MaxInterval:    time.Duration(0),
+		Seed:           "",
+		TraceTimeout:   time.Duration(0),
+		traceRemaining: make(map[string]int),
+		tracePending:   make(map[string][]signal.Event),
+		traceWakeCh:    make(chan struct{}, 1),
 	}
 	return r
 }
@@ -59,9 +82,17 @@ func (r *Replayable) Name() string {
 //  - maxInterval(duration): max interval (default: 10 msecs)
 //  - seed(string): seed for replaying (default: empty). can be overriden by NMZ_REPLAY_SEED.
 //
+//  - trace(string): trace file to replay (default: empty), e.g. saved by `nmz orchestrator -interactive`.
+//    The events in the trace are released in the recorded order, with the same kind of actions (e.g. faults) as recorded.
+//    The other events are delayed by the seed as usual.
+//
+//  - traceTimeout(duration): time to wait for the next event in the trace before skipping it (default: 10 secs)
+//
 // should support dynamic reloading
 func (r *Replayable) LoadConfig(cfg config.Config) error {
 	log.Debugf("CONFIG: %s", cfg.AllSettings())
+	r.paramMu.Lock()
+	defer r.paramMu.Unlock()
 	paramMaxInterval := "explorepolicyparam.maxInterval"
 	if cfg.IsSet(paramMaxInterval) {
 		r.MaxInterval = cfg.GetDuration(paramMaxInterval)
@@ -86,6 +117,38 @@ func (r *Replayable) LoadConfig(cfg config.Config) error {
 		log.Infof("Overriding seed=%s (%s)", r.Seed, envSeed)
 	}
 
+	paramTraceTimeout := "explorepolicyparam.traceTimeout"
+	if cfg.IsSet(paramTraceTimeout) {
+		r.TraceTimeout = cfg.GetDuration(paramTraceTimeout)
+		log.Infof("Set traceTimeout=%s", r.TraceTimeout)
+	} else {
+		r.TraceTimeout = 10 * time.Second
+		log.Infof("Using default traceTimeout=%s", r.TraceTimeout)
+	}
+
+	paramTrace := "explorepolicyparam.trace"
+	tracePath := cfg.GetString(paramTrace)
+	if tracePath != r.TracePath {
+		steps := []traceStep{}
+		if tracePath != "" {
+			var err error
+			if steps, err = loadTraceSteps(tracePath); err != nil {
+				return fmt.Errorf("failed to load trace %s: %s", tracePath, err)
+			}
+		}
+		r.traceMu.Lock()
+		orphans := r.setTraceSteps(steps)
+		r.traceMu.Unlock()
+		// QueueEvent() cannot be called here, as r.paramMu is held
+		go func() {
+			for _, event := range orphans {
+				r.QueueEvent(event)
+			}
+		}()
+		log.Infof("Set trace=%s (%d events)", tracePath, len(steps))
+	}
+	r.TracePath = tracePath
+
 	return nil
 }
 
@@ -98,6 +161,8 @@ func (d *Replayable) ActionChan() chan signal.Action {
 }
 
 func (r *Replayable) determineInterval(event signal.Event) time.Duration {
+	r.paramMu.RLock()
+	defer r.paramMu.RUnlock()
 	if r.MaxInterval == 0 {
 		log.Warnf("MaxInterval is zero")
 		return 0
@@ -114,6 +179,9 @@ func (r *Replayable) determineInterval(event signal.Event) time.Duration {
 }
 
 func (r *Replayable) QueueEvent(event signal.Event) {
+	if r.queueTraceEvent(event) {
+		return
+	}
 	interval := r.determineInterval(event)
 	action, err := event.DefaultAction()
 	if err != nil {
@@ -18,6 +18,7 @@ package replayable
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"sync"
 	"testing"
@@ -28,7 +29,9 @@ import (
 	"github.com/osrg/namazu/nmz/signal"
 	"github.com/osrg/namazu/nmz/util/config"
 	logutil "github.com/osrg/namazu/nmz/util/log"
+	signalutil "github.com/osrg/namazu/nmz/util/signal"
 	testutil "github.com/osrg/namazu/nmz/util/test"
+	. "github.com/osrg/namazu/nmz/util/trace"
 )
 
 func TestMain(m *testing.M) {
@@ -108,3 +111,83 @@ func xTestPolicyWithPacketEvent(t *testing.T, n, entities int, concurrent bool)
 		receiver()
 	}
 }
+
+func newHintedPacketEvent(t *testing.T, entityID string, i int) signal.Event {
+	event := testutil.NewPacketEvent(t, entityID, i).(*signal.PacketEvent)
+	event.SetReplayHint(fmt.Sprintf("hint-%d", i))
+	return event
+}
+
+func saveTestTrace(t *testing.T, actions []signal.Action) string {
+	f, err := ioutil.TempFile("", "test-replayable-trace")
+	assert.NoError(t, err)
+	f.Close()
+	assert.NoError(t, SaveTraceFile(f.Name(), &SingleTrace{ActionSequence: actions}, TraceFormatJSONL))
+	return f.Name()
+}
+
+func newTracePolicy(t *testing.T, tracePath string, traceTimeout time.Duration) *Replayable {
+	policy := New()
+	cfg := config.New()
+	cfg.Set("explorePolicy", "replayable")
+	cfg.Set("explorePolicyParam", map[string]interface{}{
+		"maxInterval":  10 * time.Millisecond,
+		"trace":        tracePath,
+		"traceTimeout": traceTimeout,
+	})
+	assert.NoError(t, policy.LoadConfig(cfg))
+	return policy
+}
+
+func TestReplayableWithTrace(t *testing.T) {
+	// recorded order: 2, 0 (fault), 1
+	recorded := make([]signal.Action, 0)
+	for _, i := range []int{2, 0, 1} {
+		event := newHintedPacketEvent(t, "entity-0", i)
+		action, err := event.DefaultAction()
+		if i == 0 {
+			action, err = event.DefaultFaultAction()
+		}
+		assert.NoError(t, err)
+		recorded = append(recorded, action)
+	}
+	tracePath := saveTestTrace(t, recorded)
+	defer os.Remove(tracePath)
+	policy := newTracePolicy(t, tracePath, 10*time.Second)
+
+	// 9 is not in the trace, and released without waiting for the others
+	for _, i := range []int{0, 1, 9, 2} {
+		policy.QueueEvent(newHintedPacketEvent(t, "entity-0", i))
+	}
+	hints := make([]string, 0)
+	for i := 0; i < 4; i++ {
+		action := <-policy.ActionChan()
+		hint := action.Event().ReplayHint()
+		assert.Equal(t, hint == "hint-0", signalutil.IsFaultAction(action), "%s", action)
+		if hint != "hint-9" {
+			hints = append(hints, hint)
+		}
+	}
+	assert.Equal(t, []string{"hint-2", "hint-0", "hint-1"}, hints)
+}
+
+func TestReplayableWithTraceSkipsMissingEvent(t *testing.T) {
+	recorded := make([]signal.Action, 0)
+	for _, i := range []int{0, 1} {
+		action, err := newHintedPacketEvent(t, "entity-0", i).DefaultAction()
+		assert.NoError(t, err)
+		recorded = append(recorded, action)
+	}
+	tracePath := saveTestTrace(t, recorded)
+	defer os.Remove(tracePath)
+	policy := newTracePolicy(t, tracePath, 100*time.Millisecond)
+
+	// 0 never arrives
+	policy.QueueEvent(newHintedPacketEvent(t, "entity-0", 1))
+	select {
+	case action := <-policy.ActionChan():
+		assert.Equal(t, "hint-1", action.Event().ReplayHint())
+	case <-time.After(10 * time.Second):
+		t.Fatal("event 1 was not released after skipping event 0")
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replayable
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/osrg/namazu/nmz/signal"
+	signalutil "github.com/osrg/namazu/nmz/util/signal"
+	. "github.com/osrg/namazu/nmz/util/trace"
+)
+
+// a recorded action, to be replayed for the event with the same key
+type traceStep struct {
+	key    string
+	action signal.Action
+}
+
+// identifies the event across runs: the class, the entity, and the replay hint (or the option if no hint is set).
+// the UUID differs among runs, so it is not used.
+func traceEventKey(event signal.Event) string {
+	class := signalutil.EventClass(event)
+	if hint := event.ReplayHint(); hint != "" {
+		return fmt.Sprintf("%s/%s/%s", class, event.EntityID(), hint)
+	}
+	// map keys are sorted by encoding/json
+	b, err := json.Marshal(event.JSONMap()["option"])
+	if err != nil {
+		b = []byte(event.String())
+	}
+	return fmt.Sprintf("%s/%s/%s", class, event.EntityID(), b)
+}
+
+func loadTraceSteps(tracePath string) ([]traceStep, error) {
+	trace, _, err := LoadTraceFile(tracePath)
+	if err != nil {
+		return nil, err
+	}
+	steps := make([]traceStep, 0, len(trace.ActionSequence))
+	for _, action := range trace.ActionSequence {
+		// e.g. ShellAction is not caused by any event
+		if event := action.Event(); event != nil {
+			steps = append(steps, traceStep{key: traceEventKey(event), action: action})
+		}
+	}
+	return steps, nil
+}
+
+// makes the action of the same kind as the recorded one for the event
+func replayAction(event signal.Event, recorded signal.Action) (signal.Action, error) {
+	if !signalutil.IsFaultAction(recorded) {
+		return event.DefaultAction()
+	}
+	if fpEvent, ok := event.(*signal.FailpointEvent); ok {
+		switch recorded := recorded.(type) {
+		case *signal.FailpointErrorAction:
+			return fpEvent.FaultAction(signal.FailpointTermError, 0)
+		case *signal.FailpointPanicAction:
+			return fpEvent.FaultAction(signal.FailpointTermPanic, 0)
+		case *signal.FailpointSleepAction:
+			sleep, err := recorded.Duration()
+			if err != nil {
+				return nil, err
+			}
+			return fpEvent.FaultAction(signal.FailpointTermSleep, sleep)
+		}
+	}
+	action, err := event.DefaultFaultAction()
+	if err == nil && action == nil {
+		log.Warnf("REPLAYABLE: %s has no fault action, accepting it instead", event)
+		return event.DefaultAction()
+	}
+	return action, err
+}
+
+// starts replaying the steps in order (the rest of the previous steps are discarded).
+// returns the events that were waiting for the previous steps, which should be queued again.
+// must be called with r.traceMu held.
+func (r *Replayable) setTraceSteps(steps []traceStep) []signal.Event {
+	orphans := make([]signal.Event, 0)
+	for _, events := range r.tracePending {
+		orphans = append(orphans, events...)
+	}
+	r.tracePending = make(map[string][]signal.Event)
+	r.traceSteps = steps
+	r.traceRemaining = make(map[string]int)
+	for _, step := range steps {
+		r.traceRemaining[step.key]++
+	}
+	if !r.traceRoutineRunning && len(steps) > 0 {
+		r.traceRoutineRunning = true
+		go r.traceRoutine()
+	}
+	return orphans
+}
+
+// returns false if the event is not in the rest of the trace.
+// the event is released by traceRoutine() when all the preceding steps are released (or skipped).
+func (r *Replayable) queueTraceEvent(event signal.Event) bool {
+	key := traceEventKey(event)
+	r.traceMu.Lock()
+	if r.traceRemaining[key] <= len(r.tracePending[key]) {
+		r.traceMu.Unlock()
+		return false
+	}
+	r.tracePending[key] = append(r.tracePending[key], event)
+	r.traceMu.Unlock()
+	select {
+	case r.traceWakeCh <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// pops the steps whose events are pending, and returns the actions for them
+func (r *Replayable) popTraceSteps() []signal.Action {
+	r.traceMu.Lock()
+	defer r.traceMu.Unlock()
+	actions := make([]signal.Action, 0)
+	for len(r.traceSteps) > 0 {
+		step := r.traceSteps[0]
+		events := r.tracePending[step.key]
+		if len(events) == 0 {
+			break
+		}
+		event := events[0]
+		r.tracePending[step.key] = events[1:]
+		r.traceSteps = r.traceSteps[1:]
+		r.traceRemaining[step.key]--
+		action, err := replayAction(event, step.action)
+		if err != nil {
+			panic(log.Critical(err))
+		}
+		log.Debugf("REPLAYABLE: Determined action %s for event %s (recorded: %s)", action, event, step.action)
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// skips the next step, as its event has not arrived within the timeout
+func (r *Replayable) skipTraceStep() {
+	r.traceMu.Lock()
+	defer r.traceMu.Unlock()
+	if len(r.traceSteps) == 0 || len(r.tracePending[r.traceSteps[0].key]) > 0 {
+		return
+	}
+	step := r.traceSteps[0]
+	log.Warnf("REPLAYABLE: Skipping %s, as the event did not arrive within %s", step.action, r.TraceTimeout)
+	r.traceSteps = r.traceSteps[1:]
+	r.traceRemaining[step.key]--
+}
+
+// waits for the event of the next step up to TraceTimeout after the last progress
+func (r *Replayable) traceRoutine() {
+	var deadline time.Time
+	for {
+		actions := r.popTraceSteps()
+		for _, action := range actions {
+			r.actionCh <- action
+		}
+		r.traceMu.Lock()
+		if len(r.traceSteps) == 0 {
+			r.traceRoutineRunning = false
+			r.traceMu.Unlock()
+			log.Infof("REPLAYABLE: Replayed the trace")
+			return
+		}
+		r.traceMu.Unlock()
+		r.paramMu.RLock()
+		timeout := r.TraceTimeout
+		r.paramMu.RUnlock()
+		if len(actions) > 0 || deadline.IsZero() {
+			deadline = time.Now().Add(timeout)
+		}
+		select {
+		case <-r.traceWakeCh:
+		case <-time.After(deadline.Sub(time.Now())):
+			r.skipTraceStep()
+			deadline = time.Now().Add(timeout)
+		}
+	}
+}
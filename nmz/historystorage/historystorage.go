@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"github.com/osrg/namazu/nmz/historystorage/mongodb"
 	"github.com/osrg/namazu/nmz/historystorage/naive"
+	"github.com/osrg/namazu/nmz/historystorage/sqlite"
 	. "github.com/osrg/namazu/nmz/signal"
 	"github.com/osrg/namazu/nmz/util/config"
 	. "github.com/osrg/namazu/nmz/util/trace"
@@ -31,7 +32,7 @@ const (
 )
 
 type HistoryStorage interface {
-	CreateStorage()
+	CreateStorage() error
 
 	Init()
 	Close()
@@ -39,45 +40,49 @@ type HistoryStorage interface {
 
 	CreateNewWorkingDir() string
 	RecordNewTrace(newTrace *SingleTrace)
-	RecordResult(successful bool, requiredTime time.Duration) error
+	// metadata can be nil (see Result)
+	RecordResult(successful bool, requiredTime time.Duration, metadata map[string]interface{}) error
 
 	NrStoredHistories() int
 	GetStoredHistory(id int) (*SingleTrace, error)
 
 	IsSuccessful(id int) (bool, error)
 	GetRequiredTime(id int) (time.Duration, error)
+	// returns an empty map for a result recorded without metadata
+	GetResultMetadata(id int) (map[string]interface{}, error)
+	GetRecordedTime(id int) (time.Time, error)
 
+	// deleted histories leave gaps in the IDs (the methods above return os.IsNotExist errors)
+	DeleteHistory(id int) error
+	// compacts the history for saving the disk space
+	CompactHistory(id int) error
+
+	// returns the IDs of the histories whose action sequences start with prefix
 	Search(prefix []Action) []int
 	SearchWithConverter(prefix []Action, converter func(actions []Action) []Action) []int
 }
 
-func New(name, dirPath string) (HistoryStorage, error) {
+// cfg is used by the storages that need extra parameters (e.g. mongodbURI)
+func New(name, dirPath string, cfg config.Config) (HistoryStorage, error) {
 	switch name {
 	case "naive":
 		return naive.New(dirPath), nil
 	case "mongodb":
-		return mongodb.New(dirPath), nil
+		return mongodb.New(dirPath, cfg)
+	case "sqlite":
+		return sqlite.New(dirPath)
 	}
 	return nil, fmt.Errorf("unknown history storage: %s", name)
 }
 
-func LoadStorage(dirPath string) HistoryStorage {
+// loads the storage initialized in dirPath (see "nmz init")
+func LoadStorage(dirPath string) (HistoryStorage, error) {
 	confPath := dirPath + "/" + StorageTOMLConfigPath
 
 	// TODO: we should not parse config twice. (run should have already parsed the config)
 	cfg, err := config.NewFromFile(confPath)
 	if err != nil {
-		fmt.Printf("error: %s\n", err)
-		return nil
-	}
-	storageType := cfg.Get("storageType")
-
-	switch storageType {
-	case "naive":
-		return naive.New(dirPath)
-	default:
-		fmt.Printf("unknown history storage: %s\n", storageType)
-		return nil
+		return nil, err
 	}
-	// NOTREACHED
+	return New(cfg.GetString("storageType"), dirPath, cfg)
 }
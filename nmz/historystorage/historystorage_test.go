@@ -17,11 +17,33 @@ package historystorage
 
 import (
 	"flag"
+	"io/ioutil"
 	"os"
+	"path"
 	"testing"
+
+	testutil "github.com/osrg/namazu/nmz/util/test"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestMain(m *testing.M) {
 	flag.Parse()
 	os.Exit(m.Run())
 }
+
+func TestLoadStorage(t *testing.T) {
+	dir := testutil.NewNaiveStorage(t, "test-load-storage")
+	defer os.RemoveAll(dir)
+	storage, err := LoadStorage(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "naive", storage.Name())
+
+	conf := path.Join(dir, StorageTOMLConfigPath)
+	assert.NoError(t, ioutil.WriteFile(conf, []byte("storageType = \"unknown\"\n"), 0644))
+	_, err = LoadStorage(dir)
+	assert.Error(t, err)
+
+	assert.NoError(t, os.Remove(conf))
+	_, err = LoadStorage(dir)
+	assert.Error(t, err, "no config")
+}
@@ -16,54 +16,187 @@
 package mongodb
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/cihub/seelog"
 	naive "github.com/osrg/namazu/nmz/historystorage/naive"
 	. "github.com/osrg/namazu/nmz/signal"
+	"github.com/osrg/namazu/nmz/util/config"
+	signalutil "github.com/osrg/namazu/nmz/util/signal"
 	. "github.com/osrg/namazu/nmz/util/trace"
+	"github.com/satori/go.uuid"
 	mgo "gopkg.in/mgo.v2"
-	"time"
+	"gopkg.in/mgo.v2/bson"
 )
 
 const (
-	// TODO: make them configurable
-	dialTo        = "mongodb://localhost/namazu"
-	dbName        = "namazu"
 	actionColName = "action"
 	eventColName  = "event"
 	traceColName  = "trace"
+	resultColName = "result"
+
+	// relative to the storage dir.
+	// documents of several storages can share a database, and they are distinguished by this ID.
+	storageIDPath = "MongoDBStorageID"
+
+	// used when mongodbPassword is empty
+	passwordEnv = "NMZ_MONGODB_PASSWORD"
 )
 
 // type that implements interface HistoryStorage
+//
+// The working dirs are still allocated by Naive (the scripts and the logs need them),
+// but the traces and the results are read from MongoDB.
 type MongoDB struct {
-	Naive   *naive.Naive
-	dirPath string
+	Naive     *naive.Naive
+	dirPath   string
+	storageID string
+	// ID of the working dir created by CreateNewWorkingDir() (-1 if not created yet)
+	curID   int
 	Session *mgo.Session
 	DB      *mgo.Database
+	// prefix of the collection names
+	colPrefix string
 }
 
-// TODO: get config
+type traceDoc struct {
+	StorageID      string                   `bson:"storage_id"`
+	TraceID        int                      `bson:"trace_id"`
+	Dir            string                   `bson:"dir"`
+	ActionSequence []map[string]interface{} `bson:"action_sequence"`
+	// see naive.ActionSignature()
+	Signatures []string `bson:"signatures"`
+	// JSONL (see trace.EncodeTrace())
+	Trace []byte `bson:"trace"`
+	// legacy, written before the JSONL format was introduced
+	Gob        []byte    `bson:"gob,omitempty"`
+	RecordedAt time.Time `bson:"recorded_at"`
+}
+
+type resultDoc struct {
+	StorageID    string                 `bson:"storage_id"`
+	TraceID      int                    `bson:"trace_id"`
+	Successful   bool                   `bson:"successful"`
+	RequiredTime time.Duration          `bson:"required_time"`
+	Metadata     map[string]interface{} `bson:"metadata"`
+	RecordedAt   time.Time              `bson:"recorded_at"`
+}
+
+// returns the dial info for mongodbURI, overridden by the other mongodbXXX params
+func dialInfo(cfg config.Config) (*mgo.DialInfo, error) {
+	info, err := mgo.ParseURL(cfg.GetString("mongodbURI"))
+	if err != nil {
+		return nil, fmt.Errorf("bad mongodbURI: %s", err)
+	}
+	if db := cfg.GetString("mongodbDatabase"); db != "" {
+		info.Database = db
+	}
+	if info.Database == "" {
+		info.Database = "namazu"
+	}
+	if user := cfg.GetString("mongodbUsername"); user != "" {
+		info.Username = user
+	}
+	if password := cfg.GetString("mongodbPassword"); password != "" {
+		info.Password = password
+	} else if password = os.Getenv(passwordEnv); password != "" {
+		info.Password = password
+	}
+	if source := cfg.GetString("mongodbAuthSource"); source != "" {
+		info.Source = source
+	}
+	info.Timeout = cfg.GetDuration("mongodbTimeout")
+	return info, nil
+}
 
-func New(dirPath string) *MongoDB {
-	session, err := mgo.Dial(dialTo)
+func New(dirPath string, cfg config.Config) (*MongoDB, error) {
+	info, err := dialInfo(cfg)
+	if err != nil {
+		return nil, err
+	}
+	session, err := mgo.DialWithInfo(info)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("failed to connect to %s: %s", strings.Join(info.Addrs, ","), err)
 	}
 	// Optional. Switch the session to a monotonic behavior.
 	session.SetMode(mgo.Monotonic, true)
-	db := session.DB(dbName)
 
-	return &MongoDB{
-		Naive:   naive.New(dirPath),
-		dirPath: dirPath,
-		Session: session,
-		DB:      db,
+	this := &MongoDB{
+		Naive:     naive.New(dirPath),
+		dirPath:   dirPath,
+		curID:     -1,
+		Session:   session,
+		DB:        session.DB(info.Database),
+		colPrefix: cfg.GetString("mongodbCollectionPrefix"),
+	}
+	// missing before CreateStorage() (checked in Init())
+	if b, err := ioutil.ReadFile(path.Join(dirPath, storageIDPath)); err == nil {
+		this.storageID = strings.TrimSpace(string(b))
+	}
+	if err = this.ensureIndexes(); err != nil {
+		session.Close()
+		return nil, err
+	}
+	return this, nil
+}
+
+func (this *MongoDB) col(name string) *mgo.Collection {
+	return this.DB.C(this.colPrefix + name)
+}
+
+func (this *MongoDB) ensureIndexes() error {
+	for _, name := range []string{traceColName, resultColName} {
+		err := this.col(name).EnsureIndex(mgo.Index{
+			Key:    []string{"storage_id", "trace_id"},
+			Unique: true,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create index for %s: %s", name, err)
+		}
+	}
+	for _, name := range []string{actionColName, eventColName} {
+		if err := this.col(name).EnsureIndexKey("storage_id", "trace_id"); err != nil {
+			return fmt.Errorf("failed to create index for %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func (this *MongoDB) selector(id int) bson.M {
+	return bson.M{"storage_id": this.storageID, "trace_id": id}
+}
+
+// converts mgo.ErrNotFound so that os.IsNotExist() works as in Naive
+func notFound(err error, id int, name string) error {
+	if err == mgo.ErrNotFound {
+		return &os.PathError{Op: "find", Path: fmt.Sprintf("%s %d", name, id), Err: os.ErrNotExist}
 	}
+	return err
 }
 
-func (this *MongoDB) CreateStorage() {
-	this.Naive.CreateStorage()
+func (this *MongoDB) CreateStorage() error {
+	if err := this.Naive.CreateStorage(); err != nil {
+		return err
+	}
+	this.storageID = uuid.NewV4().String()
+	err := ioutil.WriteFile(path.Join(this.dirPath, storageIDPath), []byte(this.storageID+"\n"), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write storage ID: %s", err)
+	}
+	return nil
 }
 
 func (this *MongoDB) Init() {
+	if this.storageID == "" {
+		panic(log.Criticalf("%s is not a mongodb storage (no %s)", this.dirPath, storageIDPath))
+	}
 	this.Naive.Init()
 }
 
@@ -78,21 +211,37 @@ func (this *MongoDB) Name() string {
 
 func (this *MongoDB) CreateNewWorkingDir() string {
 	d := this.Naive.CreateNewWorkingDir()
+	if _, err := fmt.Sscanf(path.Base(d), "%x", &this.curID); err != nil {
+		panic(log.Criticalf("unexpected working dir %s: %s", d, err))
+	}
 	return d
 }
 
 func (this *MongoDB) RecordNewTrace(newTrace *SingleTrace) {
 	this.Naive.RecordNewTrace(newTrace)
 
-	traceDoc := map[string]interface{}{
-		// FIXME: use something like this.Naive.GetCurrentTraceID()
-		"trace_id": this.Naive.NrStoredHistories() - 1,
-		"dir":      this.dirPath,
+	var traceBuf bytes.Buffer
+	if err := EncodeTrace(&traceBuf, newTrace, TraceFormatJSONL); err != nil {
+		panic(log.Criticalf("encoding trace failed: %s", err))
+	}
+	doc := traceDoc{
+		StorageID:      this.storageID,
+		TraceID:        this.curID,
+		Dir:            this.dirPath,
+		ActionSequence: make([]map[string]interface{}, 0, len(newTrace.ActionSequence)),
+		Signatures:     make([]string, 0, len(newTrace.ActionSequence)),
+		Trace:          traceBuf.Bytes(),
+		RecordedAt:     time.Now(),
 	}
-	actionSequence := make([]map[string]interface{}, 0)
-	for _, act := range newTrace.ActionSequence {
+	for i, act := range newTrace.ActionSequence {
 		actJSON := act.JSONMap()
-		this.DB.C(actionColName).Insert(&actJSON)
+		actDoc := bson.M{"storage_id": this.storageID, "trace_id": this.curID, "seq": i}
+		for k, v := range actJSON {
+			actDoc[k] = v
+		}
+		if err := this.col(actionColName).Insert(actDoc); err != nil {
+			panic(log.Criticalf("failed to insert action: %s", err))
+		}
 		m := map[string]interface{}{
 			// TODO: consider mongodb ObjectID?
 			"uuid": actJSON["uuid"],
@@ -103,19 +252,41 @@ func (this *MongoDB) RecordNewTrace(newTrace *SingleTrace) {
 		evt := act.Event()
 		if evt != nil {
 			evtJSON := evt.JSONMap()
-			this.DB.C(eventColName).Insert(&evtJSON)
+			evtDoc := bson.M{"storage_id": this.storageID, "trace_id": this.curID}
+			for k, v := range evtJSON {
+				evtDoc[k] = v
+			}
+			if err := this.col(eventColName).Insert(evtDoc); err != nil {
+				panic(log.Criticalf("failed to insert event: %s", err))
+			}
 			m["event_class"] = evtJSON["class"]
 			m["event_option"] = evtJSON["option"]
-
 		}
-		actionSequence = append(actionSequence, m)
+		doc.ActionSequence = append(doc.ActionSequence, m)
+		doc.Signatures = append(doc.Signatures, naive.ActionSignature(act))
+	}
+	if _, err := this.col(traceColName).Upsert(this.selector(this.curID), &doc); err != nil {
+		panic(log.Criticalf("failed to insert trace: %s", err))
 	}
-	traceDoc["action_sequence"] = actionSequence
-	this.DB.C(traceColName).Insert(&traceDoc)
 }
 
-func (this *MongoDB) RecordResult(successful bool, requiredTime time.Duration) error {
-	return this.Naive.RecordResult(successful, requiredTime)
+func (this *MongoDB) RecordResult(successful bool, requiredTime time.Duration, metadata map[string]interface{}) error {
+	if err := this.Naive.RecordResult(successful, requiredTime, metadata); err != nil {
+		return err
+	}
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	doc := resultDoc{
+		StorageID:    this.storageID,
+		TraceID:      this.curID,
+		Successful:   successful,
+		RequiredTime: requiredTime,
+		Metadata:     metadata,
+		RecordedAt:   time.Now(),
+	}
+	_, err := this.col(resultColName).Upsert(this.selector(this.curID), &doc)
+	return err
 }
 
 func (this *MongoDB) NrStoredHistories() int {
@@ -123,27 +294,127 @@ func (this *MongoDB) NrStoredHistories() int {
 	return nr
 }
 
-func (this *MongoDB) GetStoredHistory(id int) (*SingleTrace, error) {
-	trace, err := this.Naive.GetStoredHistory(id)
+func decodeTrace(doc *traceDoc) (*SingleTrace, error) {
+	b := doc.Trace
+	if len(b) == 0 {
+		b = doc.Gob
+	}
+	trace, _, err := DecodeTrace(bytes.NewReader(b))
 	return trace, err
 }
 
+func (this *MongoDB) GetStoredHistory(id int) (*SingleTrace, error) {
+	var doc traceDoc
+	if err := this.col(traceColName).Find(this.selector(id)).One(&doc); err != nil {
+		return nil, notFound(err, id, "trace")
+	}
+	return decodeTrace(&doc)
+}
+
+func (this *MongoDB) getResult(id int) (*resultDoc, error) {
+	var doc resultDoc
+	if err := this.col(resultColName).Find(this.selector(id)).One(&doc); err != nil {
+		return nil, notFound(err, id, "result")
+	}
+	return &doc, nil
+}
+
 func (this *MongoDB) IsSuccessful(id int) (bool, error) {
-	succ, err := this.Naive.IsSuccessful(id)
-	return succ, err
+	doc, err := this.getResult(id)
+	if err != nil {
+		return false, err
+	}
+	return doc.Successful, nil
 }
 
 func (this *MongoDB) GetRequiredTime(id int) (time.Duration, error) {
-	t, err := this.Naive.GetRequiredTime(id)
-	return t, err
+	doc, err := this.getResult(id)
+	if err != nil {
+		return 0, err
+	}
+	return doc.RequiredTime, nil
+}
+
+func (this *MongoDB) GetResultMetadata(id int) (map[string]interface{}, error) {
+	doc, err := this.getResult(id)
+	if err != nil {
+		return nil, err
+	}
+	// round-trip via JSON so that the types are the same as in Naive (e.g. bson.M -> map[string]interface{})
+	b, err := json.Marshal(doc.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	metadata := map[string]interface{}{}
+	if err = json.Unmarshal(b, &metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+func (this *MongoDB) GetRecordedTime(id int) (time.Time, error) {
+	doc, err := this.getResult(id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return doc.RecordedAt, nil
+}
+
+func (this *MongoDB) DeleteHistory(id int) error {
+	for _, name := range []string{actionColName, eventColName, traceColName, resultColName} {
+		if _, err := this.col(name).RemoveAll(this.selector(id)); err != nil {
+			return err
+		}
+	}
+	return this.Naive.DeleteHistory(id)
+}
+
+// only the working dir is compacted
+func (this *MongoDB) CompactHistory(id int) error {
+	return this.Naive.CompactHistory(id)
 }
 
 func (this *MongoDB) Search(prefix []Action) []int {
-	slice := this.Naive.Search(prefix)
-	return slice
+	query := bson.M{"storage_id": this.storageID}
+	for i, act := range prefix {
+		query[fmt.Sprintf("signatures.%d", i)] = naive.ActionSignature(act)
+	}
+	var docs []traceDoc
+	err := this.col(traceColName).Find(query).Select(bson.M{"trace_id": 1}).Sort("trace_id").All(&docs)
+	if err != nil {
+		panic(log.Criticalf("failed to search traces: %s", err))
+	}
+	matched := make([]int, 0, len(docs))
+	for _, doc := range docs {
+		matched = append(matched, doc.TraceID)
+	}
+	return matched
 }
 
+// scans all the traces, as the converter cannot be queried.
+// use Search() if possible.
 func (this *MongoDB) SearchWithConverter(prefix []Action, converter func(actions []Action) []Action) []int {
-	slice := this.Naive.SearchWithConverter(prefix, converter)
-	return slice
+	matched := make([]int, 0)
+	iter := this.col(traceColName).Find(bson.M{"storage_id": this.storageID}).Sort("trace_id").Iter()
+	for {
+		var doc traceDoc
+		if !iter.Next(&doc) {
+			break
+		}
+		history, err := decodeTrace(&doc)
+		if err != nil {
+			panic(log.Criticalf("failed to decode trace %d: %s", doc.TraceID, err))
+		}
+		if len(history.ActionSequence) < len(prefix) {
+			continue
+		}
+		converted := converter(history.ActionSequence)
+		if signalutil.AreActionsSliceEqual(prefix, converted) {
+			matched = append(matched, doc.TraceID)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		panic(log.Criticalf("failed to search traces: %s", err))
+	}
+	return matched
 }
@@ -24,6 +24,14 @@ import (
 const (
 	searchModeInfoPath = "SearchModeInfo" // relative path of metadata
 	resultPath         = "result.json"
+	// lock file for allocating working dirs (parallel "nmz run" processes can share the storage)
+	lockPath = "SearchModeInfo.lock"
+	// prefix index of the histories (see index.go)
+	searchIndexPath = "SearchIndex"
+	// JSON files of the actions (and the events), per history
+	actionsPath = "actions"
+	// actions compacted by CompactHistory(), per history
+	compactedActionsPath = "actions.json.gz"
 )
 
 // type of metadata
@@ -36,7 +44,7 @@ type searchModeInfo struct {
 type testResult struct {
 	Successful   bool                   `json:"successful"`
 	RequiredTime time.Duration          `json:"required_time"`
-	Metadata     map[string]interface{} `json:"metadata"` // not yet really supported. intended for tags and so on.
+	Metadata     map[string]interface{} `json:"metadata"` // see historystorage.Result
 }
 
 // type that implements interface HistoryStorage
@@ -45,6 +53,9 @@ type Naive struct {
 	info *searchModeInfo
 
 	nextWorkingDir string
+	nextID         int
+
+	cachedSearchIndex
 }
 
 func (n *Naive) Name() string {
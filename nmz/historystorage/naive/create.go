@@ -26,7 +26,7 @@ import (
 
 // CreateStorage(): used for initializing a directory for naive history storage
 // called in a process of "nmz init"
-func (n *Naive) CreateStorage() {
+func (n *Naive) CreateStorage() error {
 	var infoBuf bytes.Buffer
 	enc := gob.NewEncoder(&infoBuf)
 
@@ -36,19 +36,18 @@ func (n *Naive) CreateStorage() {
 
 	err := enc.Encode(&info)
 	if err != nil {
-		fmt.Printf("failed to encode search mode information: %s\n", err)
-		return
+		return fmt.Errorf("failed to encode search mode information: %s", err)
 	}
 
 	file, oerr := os.Create(n.dir + "/" + searchModeInfoPath)
 	if oerr != nil {
-		fmt.Printf("failed to open file for search mode info: %s\n", oerr)
-		return
+		return fmt.Errorf("failed to open file for search mode info: %s", oerr)
 	}
+	defer file.Close()
 
 	_, werr := file.Write(infoBuf.Bytes())
 	if werr != nil {
-		fmt.Printf("failed to write search mode info: %s\n", werr)
-		return
+		return fmt.Errorf("failed to write search mode info: %s", werr)
 	}
+	return nil
 }
@@ -0,0 +1,186 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package naive
+
+// Retention and compaction of naive history storage (see "nmz tools gc").
+// Deleted histories leave gaps in the IDs; NrStoredHistories() is not decreased.
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/cihub/seelog"
+	. "github.com/osrg/namazu/nmz/signal"
+)
+
+func (n *Naive) historyDir(id int) string {
+	return fmt.Sprintf("%s/%08x", n.dir, id)
+}
+
+// returns the time when the result of the history was recorded
+func (n *Naive) GetRecordedTime(id int) (time.Time, error) {
+	fi, err := os.Stat(path.Join(n.historyDir(id), resultPath))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+// removes the working dir of the history. the ID is not reused.
+func (n *Naive) DeleteHistory(id int) error {
+	dir := n.historyDir(id)
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	var actions []Action
+	if history, err := n.GetStoredHistory(id); err == nil {
+		actions = history.ActionSequence
+	}
+	err := n.updateSearchIndex(func(idx *searchIndex) {
+		idx.remove(id, actions)
+	})
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// returns the sorted indices of actions/*.action.json
+func actionIndices(actionsDir string) ([]int, error) {
+	fis, err := ioutil.ReadDir(actionsDir)
+	if err != nil {
+		return nil, err
+	}
+	indices := make([]int, 0, len(fis))
+	suffix := ".action.json"
+	for _, fi := range fis {
+		if !strings.HasSuffix(fi.Name(), suffix) {
+			continue
+		}
+		i, err := strconv.Atoi(strings.TrimSuffix(fi.Name(), suffix))
+		if err != nil {
+			log.Warnf("ignoring %s: %s", fi.Name(), err)
+			continue
+		}
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+	return indices, nil
+}
+
+func readJSONFile(fileName string) (map[string]interface{}, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{})
+	err = json.Unmarshal(b, &m)
+	return m, err
+}
+
+// reads actions/*.action.json, with the events as "event"
+func readActionsDir(actionsDir string) ([]map[string]interface{}, error) {
+	indices, err := actionIndices(actionsDir)
+	if err != nil {
+		return nil, err
+	}
+	actions := make([]map[string]interface{}, 0, len(indices))
+	for _, i := range indices {
+		action, err := readJSONFile(path.Join(actionsDir, fmt.Sprintf("%d.action.json", i)))
+		if err != nil {
+			return nil, err
+		}
+		// event JSON does not exist for actions without events (e.g. ShellAction)
+		event, err := readJSONFile(path.Join(actionsDir, fmt.Sprintf("%d.event.json", i)))
+		if err == nil {
+			action["event"] = event
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+func readCompactedActions(fileName string) ([]map[string]interface{}, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	actions := make([]map[string]interface{}, 0)
+	err = json.NewDecoder(gz).Decode(&actions)
+	return actions, err
+}
+
+// reads the JSON maps of the actions (with the events as "event") in the working dir of a history.
+// both of the compacted and non-compacted histories are supported.
+func ReadActionJSONs(historyDir string) ([]map[string]interface{}, error) {
+	actions, err := readCompactedActions(path.Join(historyDir, compactedActionsPath))
+	if !os.IsNotExist(err) {
+		return actions, err
+	}
+	return readActionsDir(path.Join(historyDir, actionsPath))
+}
+
+// compacts the JSON files of the actions into a gzipped file.
+// does nothing if already compacted.
+func (n *Naive) CompactHistory(id int) error {
+	dir := n.historyDir(id)
+	actionsDir := path.Join(dir, actionsPath)
+	if _, err := os.Stat(actionsDir); os.IsNotExist(err) {
+		return nil
+	}
+	actions, err := readActionsDir(actionsDir)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path.Join(dir, compactedActionsPath+".tmp")
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(f)
+	err = json.NewEncoder(gz).Encode(actions)
+	if err == nil {
+		err = gz.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err = os.Rename(tmpPath, path.Join(dir, compactedActionsPath)); err != nil {
+		return err
+	}
+	return os.RemoveAll(actionsDir)
+}
@@ -0,0 +1,274 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package naive
+
+// Prefix index of the recorded histories, used by Search().
+// The index is persisted as SearchIndex next to SearchModeInfo, and updated by RecordNewTrace() and DeleteHistory().
+// If the index does not exist (e.g. the storage was created by an old version), it is rebuilt from the histories.
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	log "github.com/cihub/seelog"
+	. "github.com/osrg/namazu/nmz/signal"
+)
+
+// prefix trie over the action sequences of the recorded histories
+type searchIndex struct {
+	// Nodes[0] is the root
+	Nodes []*indexNode
+}
+
+type indexNode struct {
+	// action signature -> index of the child node
+	Children map[string]int
+	// sorted IDs of the histories whose action sequences pass this node
+	IDs []int
+}
+
+func newIndexNode() *indexNode {
+	return &indexNode{Children: make(map[string]int)}
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{Nodes: []*indexNode{newIndexNode()}}
+}
+
+// removes the UUIDs, which differ among runs
+func withoutUUIDs(m map[string]interface{}) map[string]interface{} {
+	ret := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if k != "uuid" && k != "event_uuid" {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+// actions with the same signature are regarded as equal.
+// unlike Action.Equals(), the event is compared by its content rather than its UUID,
+// so that the actions of different runs can match.
+func actionSignature(act Action) string {
+	m := withoutUUIDs(act.JSONMap())
+	if evt := act.Event(); evt != nil {
+		m["event"] = withoutUUIDs(evt.JSONMap())
+	}
+	return mapSignature(m, act.String())
+}
+
+// fallback is used if m cannot be encoded
+func mapSignature(m map[string]interface{}, fallback string) string {
+	// map keys are sorted by encoding/json
+	b, err := json.Marshal(m)
+	if err != nil {
+		b = []byte(fallback)
+	}
+	sum := sha1.Sum(b)
+	return string(sum[:])
+}
+
+// hex-encoded actionSignature(), for the other storages that embed Naive
+func ActionSignature(act Action) string {
+	return hex.EncodeToString([]byte(actionSignature(act)))
+}
+
+// hex-encoded signature of the event, which ignores the UUID like Event.Equals() does
+func EventSignature(evt Event) string {
+	return hex.EncodeToString([]byte(mapSignature(withoutUUIDs(evt.JSONMap()), evt.String())))
+}
+
+func insertID(ids []int, id int) []int {
+	i := sort.SearchInts(ids, id)
+	if i < len(ids) && ids[i] == id {
+		return ids
+	}
+	ids = append(ids, 0)
+	copy(ids[i+1:], ids[i:])
+	ids[i] = id
+	return ids
+}
+
+func removeID(ids []int, id int) []int {
+	i := sort.SearchInts(ids, id)
+	if i < len(ids) && ids[i] == id {
+		return append(ids[:i], ids[i+1:]...)
+	}
+	return ids
+}
+
+func (idx *searchIndex) insert(id int, actions []Action) {
+	node := idx.Nodes[0]
+	node.IDs = insertID(node.IDs, id)
+	for _, act := range actions {
+		sig := actionSignature(act)
+		if node.Children == nil {
+			// gob does not encode empty maps
+			node.Children = make(map[string]int)
+		}
+		child, ok := node.Children[sig]
+		if !ok {
+			child = len(idx.Nodes)
+			idx.Nodes = append(idx.Nodes, newIndexNode())
+			node.Children[sig] = child
+		}
+		node = idx.Nodes[child]
+		node.IDs = insertID(node.IDs, id)
+	}
+}
+
+// if actions is nil (e.g. the history is broken), all the nodes are scanned
+func (idx *searchIndex) remove(id int, actions []Action) {
+	if actions == nil {
+		for _, node := range idx.Nodes {
+			node.IDs = removeID(node.IDs, id)
+		}
+		return
+	}
+	node := idx.Nodes[0]
+	node.IDs = removeID(node.IDs, id)
+	for _, act := range actions {
+		child, ok := node.Children[actionSignature(act)]
+		if !ok {
+			return
+		}
+		node = idx.Nodes[child]
+		node.IDs = removeID(node.IDs, id)
+	}
+}
+
+// returns the IDs of the histories that start with prefix, in O(len(prefix) + len(result))
+func (idx *searchIndex) search(prefix []Action) []int {
+	node := idx.Nodes[0]
+	for _, act := range prefix {
+		child, ok := node.Children[actionSignature(act)]
+		if !ok {
+			return []int{}
+		}
+		node = idx.Nodes[child]
+	}
+	matched := make([]int, len(node.IDs))
+	copy(matched, node.IDs)
+	return matched
+}
+
+func (n *Naive) searchIndexPath() string {
+	return path.Join(n.dir, searchIndexPath)
+}
+
+func loadSearchIndex(fileName string) (*searchIndex, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var idx searchIndex
+	if err = gob.NewDecoder(f).Decode(&idx); err != nil {
+		return nil, fmt.Errorf("failed to decode search index %s: %s", fileName, err)
+	}
+	return &idx, nil
+}
+
+func (idx *searchIndex) save(fileName string) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(idx); err != nil {
+		return err
+	}
+	// readers do not take the lock, so the file is replaced atomically
+	tmpName := fileName + ".tmp"
+	if err := ioutil.WriteFile(tmpName, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, fileName)
+}
+
+// builds the index from all the recorded histories
+func (n *Naive) rebuildSearchIndex() *searchIndex {
+	log.Infof("Building search index for %d histories", n.info.NrCollectedTraces)
+	idx := newSearchIndex()
+	for i := 0; i < n.info.NrCollectedTraces; i++ {
+		history, err := n.GetStoredHistory(i)
+		if err != nil {
+			// in progress, deleted, or broken
+			continue
+		}
+		idx.insert(i, history.ActionSequence)
+	}
+	return idx
+}
+
+// updates the persisted index with f, under the lock of the storage
+func (n *Naive) updateSearchIndex(f func(idx *searchIndex)) error {
+	lockFile, err := n.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock(lockFile)
+
+	idx, err := loadSearchIndex(n.searchIndexPath())
+	if os.IsNotExist(err) {
+		n.info = n.readSearchModeInfo()
+		idx = n.rebuildSearchIndex()
+	} else if err != nil {
+		return err
+	}
+	f(idx)
+	if err = idx.save(n.searchIndexPath()); err != nil {
+		// stale index is worse than no index (it will be rebuilt)
+		os.Remove(n.searchIndexPath())
+		return err
+	}
+	return nil
+}
+
+// returns the up-to-date index (other processes may have updated it)
+func (n *Naive) loadSearchIndex() (*searchIndex, error) {
+	fi, err := os.Stat(n.searchIndexPath())
+	if os.IsNotExist(err) {
+		if err = n.updateSearchIndex(func(*searchIndex) {}); err != nil {
+			return nil, err
+		}
+		fi, err = os.Stat(n.searchIndexPath())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n.index != nil && fi.ModTime().Equal(n.indexModTime) && fi.Size() == n.indexSize {
+		return n.index, nil
+	}
+	idx, err := loadSearchIndex(n.searchIndexPath())
+	if err != nil {
+		return nil, err
+	}
+	n.index, n.indexModTime, n.indexSize = idx, fi.ModTime(), fi.Size()
+	return idx, nil
+}
+
+// cached index, with the stat of the file
+type cachedSearchIndex struct {
+	index        *searchIndex
+	indexModTime time.Time
+	indexSize    int64
+}
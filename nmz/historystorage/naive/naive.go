@@ -23,6 +23,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"syscall"
 	"time"
 
 	log "github.com/cihub/seelog"
@@ -39,6 +40,7 @@ func (n *Naive) updateSearchModeInfo() {
 	if err != nil {
 		panic(log.Criticalf("failed to open file: %s", err))
 	}
+	defer infoFile.Close()
 
 	var infoBuf bytes.Buffer
 	enc := gob.NewEncoder(&infoBuf)
@@ -80,32 +82,27 @@ func recordAction(i int, act Action, dir string) {
 }
 
 func (n *Naive) RecordNewTrace(newTrace *SingleTrace) {
-	var traceBuf bytes.Buffer
-	enc := gob.NewEncoder(&traceBuf)
-	eerr := enc.Encode(&newTrace)
-	if eerr != nil {
-		panic(log.Criticalf("encoding trace failed: %s", eerr))
-	}
-
 	tracePath := fmt.Sprintf("%s/history", n.nextWorkingDir)
 	log.Debugf("new trace path: %s", tracePath)
-	traceFile, oerr := os.Create(tracePath)
-	if oerr != nil {
-		panic(log.Criticalf("failed to create a file for new trace: %s", oerr))
+	if err := SaveTraceFile(tracePath, newTrace, TraceFormatJSONL); err != nil {
+		panic(log.Criticalf("writing new trace to file failed: %s", err))
 	}
 
-	_, werr := traceFile.Write(traceBuf.Bytes())
-	if werr != nil {
-		panic(log.Criticalf("writing new trace to file failed: %s", werr))
-	}
-
-	actionTraceDir := path.Join(n.nextWorkingDir, "actions")
+	actionTraceDir := path.Join(n.nextWorkingDir, actionsPath)
 	if err := os.Mkdir(actionTraceDir, 0777); err != nil {
 		panic(log.Criticalf("%s", err))
 	}
 	for i, act := range newTrace.ActionSequence {
 		recordAction(i, act, actionTraceDir)
 	}
+
+	err := n.updateSearchIndex(func(idx *searchIndex) {
+		idx.insert(n.nextID, newTrace.ActionSequence)
+	})
+	if err != nil {
+		// this is not a critical error (the index will be rebuilt)
+		log.Warnf("failed to update search index: %s", err)
+	}
 }
 
 func (n *Naive) readSearchModeInfo() *searchModeInfo {
@@ -114,6 +111,7 @@ func (n *Naive) readSearchModeInfo() *searchModeInfo {
 	if err != nil {
 		panic(log.Criticalf("failed to open search mode info: %s", err))
 	}
+	defer file.Close()
 
 	fi, serr := file.Stat()
 	if serr != nil {
@@ -138,14 +136,41 @@ func (n *Naive) readSearchModeInfo() *searchModeInfo {
 	return &ret
 }
 
+// locks the storage exclusively among processes
+func (n *Naive) lock() (*os.File, error) {
+	f, err := os.OpenFile(path.Join(n.dir, lockPath), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func unlock(f *os.File) {
+	syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	f.Close()
+}
+
+// safe for concurrent calls from multiple processes (e.g. workers of "nmz campaign")
 func (n *Naive) CreateNewWorkingDir() string {
 	if n.nextWorkingDir != "" {
 		panic(log.Critical("creating working directory twice"))
 	}
 
+	lockFile, err := n.lock()
+	if err != nil {
+		panic(log.Criticalf("failed to lock the storage: %s", err))
+	}
+	defer unlock(lockFile)
+	// other processes may have updated the info
+	n.info = n.readSearchModeInfo()
+
 	newDirPath := fmt.Sprintf("%s/%08x", n.dir, n.info.NrCollectedTraces)
 
-	err := os.Mkdir(newDirPath, 0777)
+	err = os.Mkdir(newDirPath, 0777)
 	if err != nil {
 		panic(log.Criticalf("failed to create directory %s: %s", newDirPath, err))
 	}
@@ -154,6 +179,7 @@ func (n *Naive) CreateNewWorkingDir() string {
 	n.updateSearchModeInfo()
 
 	n.nextWorkingDir = newDirPath
+	n.nextID = n.info.NrCollectedTraces - 1
 	return newDirPath
 }
 
@@ -161,32 +187,23 @@ func (n *Naive) NrStoredHistories() int {
 	return n.info.NrCollectedTraces
 }
 
+// both of the JSONL traces and the legacy gob-encoded traces can be read
 func (n *Naive) GetStoredHistory(id int) (*SingleTrace, error) {
 	path := fmt.Sprintf("%s/%08x/history", n.dir, id)
-
-	encoded, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-
-	byteBuf := bytes.NewBuffer(encoded)
-	dec := gob.NewDecoder(byteBuf)
-	var ret SingleTrace
-	derr := dec.Decode(&ret)
-	if derr != nil {
-		return nil, derr
-	}
-
-	return &ret, nil
+	trace, _, err := LoadTraceFile(path)
+	return trace, err
 }
 
-func (n *Naive) RecordResult(successful bool, requiredTime time.Duration) error {
+func (n *Naive) RecordResult(successful bool, requiredTime time.Duration, metadata map[string]interface{}) error {
 	path := fmt.Sprintf("%s/%s", n.nextWorkingDir, resultPath)
 
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
 	result := testResult{
 		successful,
 		requiredTime,
-		map[string]interface{}{},
+		metadata,
 	}
 	js, err := json.MarshalIndent(result, "", "\t")
 	if err != nil {
@@ -232,13 +249,38 @@ func (n *Naive) GetRequiredTime(id int) (time.Duration, error) {
 	return ret.RequiredTime, nil
 }
 
+func (n *Naive) GetResultMetadata(id int) (map[string]interface{}, error) {
+	path := fmt.Sprintf("%s/%08x/%s", n.dir, id, resultPath)
+
+	encoded, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret testResult
+	err = json.Unmarshal(encoded, &ret)
+	if err != nil {
+		return nil, err
+	}
+
+	if ret.Metadata == nil {
+		ret.Metadata = map[string]interface{}{}
+	}
+	return ret.Metadata, nil
+}
+
+// scans all the histories, as the converter cannot be indexed.
+// use Search() if possible.
 func (n *Naive) SearchWithConverter(prefix []Action, converter func(actions []Action) []Action) []int {
-	// FIXME: quite ineffective
 	matched := make([]int, 0)
 	for i := 0; i < n.info.NrCollectedTraces-1; i++ { // FIXME: need to - 1 because the latest trace isn't recorded yet
 		history, err := n.GetStoredHistory(i)
+		if os.IsNotExist(err) {
+			// the run is in progress in another process (or has crashed)
+			continue
+		}
 		if err != nil {
-			panic(log.Criticalf("failed to get history %i: %s", i, err))
+			panic(log.Criticalf("failed to get history %d: %s", i, err))
 		}
 		if len(history.ActionSequence) < len(prefix) {
 			continue
@@ -251,9 +293,13 @@ func (n *Naive) SearchWithConverter(prefix []Action, converter func(actions []Ac
 	return matched
 }
 
+// returns the IDs of the recorded histories that start with prefix, using the index
 func (n *Naive) Search(prefix []Action) []int {
-	return n.SearchWithConverter(prefix,
-		func(actions []Action) []Action { return actions })
+	idx, err := n.loadSearchIndex()
+	if err != nil {
+		panic(log.Criticalf("failed to load search index: %s", err))
+	}
+	return idx.search(prefix)
 }
 
 func (n *Naive) Init() {
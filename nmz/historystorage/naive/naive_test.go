@@ -17,11 +17,166 @@ package naive
 
 import (
 	"flag"
+	"io/ioutil"
 	"os"
+	"path"
+	"sync"
 	"testing"
+	"time"
+
+	. "github.com/osrg/namazu/nmz/signal"
+	. "github.com/osrg/namazu/nmz/util/trace"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestMain(m *testing.M) {
 	flag.Parse()
+	RegisterKnownSignals()
 	os.Exit(m.Run())
 }
+
+func TestConcurrentCreateNewWorkingDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-naive")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	New(dir).CreateStorage()
+
+	const nrWorkers = 8
+	var wg sync.WaitGroup
+	dirs := make(chan string, nrWorkers)
+	for i := 0; i < nrWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n := New(dir)
+			n.Init()
+			dirs <- n.CreateNewWorkingDir()
+		}()
+	}
+	wg.Wait()
+	close(dirs)
+
+	seen := make(map[string]bool)
+	for d := range dirs {
+		assert.False(t, seen[d], "allocated twice: %s", d)
+		seen[d] = true
+	}
+	n := New(dir)
+	n.Init()
+	assert.Equal(t, nrWorkers, n.NrStoredHistories())
+}
+
+// util/test is not used, as it imports this package
+func newTestPacketEvent(t *testing.T, entityID string) Event {
+	event, err := NewPacketEvent(entityID, entityID, entityID, map[string]interface{}{"value": 0})
+	assert.NoError(t, err)
+	return event
+}
+
+func recordTestRun(t *testing.T, dir string) {
+	n := New(dir)
+	n.Init()
+	n.CreateNewWorkingDir()
+	event := newTestPacketEvent(t, "entity-0")
+	action, err := event.DefaultFaultAction()
+	assert.NoError(t, err)
+	n.RecordNewTrace(&SingleTrace{ActionSequence: []Action{action}})
+	assert.NoError(t, n.RecordResult(true, time.Second, nil))
+}
+
+func TestCompactAndDeleteHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-naive")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	New(dir).CreateStorage()
+	for i := 0; i < 3; i++ {
+		recordTestRun(t, dir)
+	}
+	n := New(dir)
+	n.Init()
+
+	historyDir := path.Join(dir, "00000000")
+	actions, err := ReadActionJSONs(historyDir)
+	assert.NoError(t, err)
+	assert.Len(t, actions, 1)
+	assert.Contains(t, actions[0], "event")
+
+	assert.NoError(t, n.CompactHistory(0))
+	_, err = os.Stat(path.Join(historyDir, actionsPath))
+	assert.True(t, os.IsNotExist(err))
+	compacted, err := ReadActionJSONs(historyDir)
+	assert.NoError(t, err)
+	assert.Equal(t, actions, compacted)
+	// idempotent
+	assert.NoError(t, n.CompactHistory(0))
+
+	assert.NoError(t, n.DeleteHistory(1))
+	assert.True(t, os.IsNotExist(n.DeleteHistory(1)))
+	_, err = n.GetStoredHistory(1)
+	assert.True(t, os.IsNotExist(err))
+	_, err = n.IsSuccessful(1)
+	assert.True(t, os.IsNotExist(err))
+
+	// the IDs are not reused
+	assert.Equal(t, 3, n.NrStoredHistories())
+	recordTestRun(t, dir)
+	n.Init()
+	assert.Equal(t, 4, n.NrStoredHistories())
+	_, err = n.GetRecordedTime(3)
+	assert.NoError(t, err)
+}
+
+func newTestActions(t *testing.T, entities ...string) []Action {
+	actions := make([]Action, 0, len(entities))
+	for _, entity := range entities {
+		// the UUIDs differ, but the actions are regarded as equal
+		event := newTestPacketEvent(t, entity)
+		action, err := event.DefaultFaultAction()
+		assert.NoError(t, err)
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+func recordTestTrace(t *testing.T, dir string, actions []Action) {
+	n := New(dir)
+	n.Init()
+	n.CreateNewWorkingDir()
+	n.RecordNewTrace(&SingleTrace{ActionSequence: actions})
+	assert.NoError(t, n.RecordResult(true, time.Second, nil))
+}
+
+func TestSearch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-naive")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	New(dir).CreateStorage()
+	recordTestTrace(t, dir, newTestActions(t, "a", "b", "c"))
+	recordTestTrace(t, dir, newTestActions(t, "a", "b"))
+	recordTestTrace(t, dir, newTestActions(t, "a", "c"))
+	recordTestTrace(t, dir, newTestActions(t))
+
+	n := New(dir)
+	n.Init()
+	assert.Equal(t, []int{0, 1, 2, 3}, n.Search(nil))
+	assert.Equal(t, []int{0, 1, 2}, n.Search(newTestActions(t, "a")))
+	assert.Equal(t, []int{0, 1}, n.Search(newTestActions(t, "a", "b")))
+	assert.Equal(t, []int{0}, n.Search(newTestActions(t, "a", "b", "c")))
+	assert.Empty(t, n.Search(newTestActions(t, "a", "b", "c", "d")))
+	assert.Empty(t, n.Search(newTestActions(t, "b")))
+
+	// updated by another instance
+	recordTestTrace(t, dir, newTestActions(t, "a", "b", "d"))
+	assert.Equal(t, []int{0, 1, 4}, n.Search(newTestActions(t, "a", "b")))
+
+	assert.NoError(t, n.DeleteHistory(1))
+	assert.Equal(t, []int{0, 4}, n.Search(newTestActions(t, "a", "b")))
+
+	// rebuilt from the histories
+	assert.NoError(t, os.Remove(path.Join(dir, searchIndexPath)))
+	n = New(dir)
+	n.Init()
+	assert.Equal(t, []int{0, 2, 4}, n.Search(newTestActions(t, "a")))
+	_, err = os.Stat(path.Join(dir, searchIndexPath))
+	assert.NoError(t, err)
+}
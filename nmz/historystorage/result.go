@@ -0,0 +1,170 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package historystorage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// outcome of a run, recorded as "outcome" in the metadata of the result
+type Outcome string
+
+const (
+	OutcomePass Outcome = "pass"
+	// the validate script exited with non-zero
+	OutcomeValidationFailure Outcome = "validation_failure"
+	// the run script exited with non-zero
+	OutcomeRunCrash Outcome = "run_crash"
+	// the run script did not finish within runTimeout
+	OutcomeHang Outcome = "hang"
+	// the scripts could not be executed (e.g. not found)
+	OutcomeInfraError Outcome = "infra_error"
+)
+
+// all the known outcomes
+var Outcomes = []Outcome{
+	OutcomePass,
+	OutcomeValidationFailure,
+	OutcomeRunCrash,
+	OutcomeHang,
+	OutcomeInfraError,
+}
+
+func ParseOutcome(s string) (Outcome, error) {
+	for _, o := range Outcomes {
+		if string(o) == s {
+			return o, nil
+		}
+	}
+	return "", fmt.Errorf("unknown outcome: %s", s)
+}
+
+// keys of the metadata of the result
+const (
+	metadataOutcome          = "outcome"
+	metadataValidateExitCode = "validate_exit_code"
+	metadataOutputTail       = "output_tail"
+	metadataLabels           = "labels"
+	metadataSignature        = "signature"
+)
+
+// result of a run.
+// the fields other than Successful and RequiredTime are stored in the metadata of the result.
+type Result struct {
+	Successful   bool
+	RequiredTime time.Duration
+	Outcome      Outcome
+	// -1 if the validate script was not executed
+	ValidateExitCode int
+	// the last part of stdout and stderr of the validate script
+	// (or of the run script, if the validate script was not run, e.g. for OutcomeRunCrash and OutcomeHang)
+	OutputTail string
+	// free-form labels (e.g. `nmz run -label key=value`)
+	Labels map[string]string
+	// failure signature (see util/signature). empty if not found.
+	Signature string
+}
+
+func (r *Result) Metadata() map[string]interface{} {
+	labels := make(map[string]interface{}, len(r.Labels))
+	for k, v := range r.Labels {
+		labels[k] = v
+	}
+	return map[string]interface{}{
+		metadataOutcome:          string(r.Outcome),
+		metadataValidateExitCode: r.ValidateExitCode,
+		metadataOutputTail:       r.OutputTail,
+		metadataLabels:           labels,
+		metadataSignature:        r.Signature,
+	}
+}
+
+// "key1=value1,key2=value2" (sorted by key)
+func (r *Result) LabelsString() string {
+	ss := make([]string, 0, len(r.Labels))
+	for k, v := range r.Labels {
+		ss = append(ss, k+"="+v)
+	}
+	sort.Strings(ss)
+	return strings.Join(ss, ",")
+}
+
+func RecordResult(storage HistoryStorage, r *Result) error {
+	return storage.RecordResult(r.Successful, r.RequiredTime, r.Metadata())
+}
+
+func resultFromMetadata(successful bool, requiredTime time.Duration, metadata map[string]interface{}) *Result {
+	r := &Result{
+		Successful:       successful,
+		RequiredTime:     requiredTime,
+		ValidateExitCode: -1,
+		Labels:           make(map[string]string),
+	}
+	if s, ok := metadata[metadataOutcome].(string); ok {
+		r.Outcome = Outcome(s)
+	}
+	if r.Outcome == "" {
+		// recorded by an old version
+		if successful {
+			r.Outcome = OutcomePass
+		} else {
+			r.Outcome = OutcomeValidationFailure
+		}
+	}
+	// JSON numbers are decoded as float64
+	switch code := metadata[metadataValidateExitCode].(type) {
+	case float64:
+		r.ValidateExitCode = int(code)
+	case int:
+		r.ValidateExitCode = code
+	}
+	r.OutputTail, _ = metadata[metadataOutputTail].(string)
+	r.Signature, _ = metadata[metadataSignature].(string)
+	if labels, ok := metadata[metadataLabels].(map[string]interface{}); ok {
+		for k, v := range labels {
+			r.Labels[k] = fmt.Sprint(v)
+		}
+	}
+	return r
+}
+
+// key for grouping failing runs into buckets, one per distinct bug
+func (r *Result) Bucket() string {
+	if r.Signature != "" {
+		return r.Signature
+	}
+	return fmt.Sprintf("(%s without signature)", r.Outcome)
+}
+
+// loads the result of the run
+func LoadResult(storage HistoryStorage, id int) (*Result, error) {
+	successful, err := storage.IsSuccessful(id)
+	if err != nil {
+		return nil, err
+	}
+	requiredTime, err := storage.GetRequiredTime(id)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := storage.GetResultMetadata(id)
+	if err != nil {
+		return nil, err
+	}
+	return resultFromMetadata(successful, requiredTime, metadata), nil
+}
@@ -0,0 +1,75 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package historystorage
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/osrg/namazu/nmz/historystorage/naive"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResult(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-result")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	naive.New(dir).CreateStorage()
+
+	// a storage instance is used for a single run
+	n := naive.New(dir)
+	n.Init()
+	n.CreateNewWorkingDir()
+	r := &Result{
+		Successful:       false,
+		RequiredTime:     time.Second,
+		Outcome:          OutcomeValidationFailure,
+		ValidateExitCode: 3,
+		OutputTail:       "assertion failed\n",
+		Labels:           map[string]string{"commit": "abc", "node": "n1"},
+		Signature:        "AssertionError at check",
+	}
+	assert.NoError(t, RecordResult(n, r))
+
+	// recorded by an old version
+	n = naive.New(dir)
+	n.Init()
+	n.CreateNewWorkingDir()
+	assert.NoError(t, n.RecordResult(true, time.Second, nil))
+
+	loaded, err := LoadResult(n, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, r, loaded)
+	assert.Equal(t, "commit=abc,node=n1", loaded.LabelsString())
+	assert.Equal(t, "AssertionError at check", loaded.Bucket())
+
+	loaded, err = LoadResult(n, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, OutcomePass, loaded.Outcome)
+	assert.Equal(t, -1, loaded.ValidateExitCode)
+	assert.Empty(t, loaded.Labels)
+	assert.Equal(t, "(pass without signature)", loaded.Bucket())
+}
+
+func TestParseOutcome(t *testing.T) {
+	o, err := ParseOutcome("hang")
+	assert.NoError(t, err)
+	assert.Equal(t, OutcomeHang, o)
+	_, err = ParseOutcome("flaky")
+	assert.Error(t, err)
+}
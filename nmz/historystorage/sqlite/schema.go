@@ -0,0 +1,249 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	naive "github.com/osrg/namazu/nmz/historystorage/naive"
+	. "github.com/osrg/namazu/nmz/signal"
+)
+
+// option and json columns are JSON texts, so they can be queried with json_extract() of the sqlite3 shell
+// (the driver linked to nmz is built without JSON1, but nmz itself does not use it), e.g.:
+//
+//	SELECT DISTINCT runs.id FROM runs
+//	  JOIN results ON results.run_id = runs.id
+//	  JOIN actions ON actions.run_id = runs.id
+//	  JOIN events ON events.run_id = runs.id AND events.uuid = actions.event_uuid
+//	WHERE actions.class = 'FilesystemFaultAction'
+//	  AND json_extract(events.option, '$.op') = 'pre-fsync'
+//	  AND json_extract(events.option, '$.path') = '/data/log'
+//	  AND results.outcome = 'validation_failure';
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS runs (
+	id INTEGER PRIMARY KEY,
+	dir TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	-- NULL until the trace is recorded
+	nr_actions INTEGER
+)`,
+	`CREATE TABLE IF NOT EXISTS events (
+	run_id INTEGER NOT NULL,
+	uuid TEXT NOT NULL,
+	class TEXT NOT NULL,
+	entity_id TEXT NOT NULL,
+	deferred INTEGER NOT NULL,
+	replay_hint TEXT NOT NULL,
+	option TEXT NOT NULL,
+	json TEXT NOT NULL,
+	PRIMARY KEY (run_id, uuid)
+)`,
+	`CREATE TABLE IF NOT EXISTS actions (
+	run_id INTEGER NOT NULL,
+	seq INTEGER NOT NULL,
+	uuid TEXT NOT NULL,
+	class TEXT NOT NULL,
+	entity_id TEXT NOT NULL,
+	event_uuid TEXT,
+	triggered_at TEXT,
+	-- naive.ActionSignature(), compared by Search()
+	signature TEXT NOT NULL,
+	option TEXT NOT NULL,
+	json TEXT NOT NULL,
+	PRIMARY KEY (run_id, seq)
+)`,
+	`CREATE INDEX IF NOT EXISTS actions_class ON actions (class)`,
+	`CREATE INDEX IF NOT EXISTS actions_signature ON actions (seq, signature)`,
+	// see historystorage.Result for the columns other than successful and required_time
+	`CREATE TABLE IF NOT EXISTS results (
+	run_id INTEGER PRIMARY KEY,
+	successful INTEGER NOT NULL,
+	required_time_ns INTEGER NOT NULL,
+	outcome TEXT,
+	validate_exit_code INTEGER,
+	signature TEXT,
+	metadata TEXT NOT NULL
+)`,
+	`CREATE TABLE IF NOT EXISTS labels (
+	run_id INTEGER NOT NULL,
+	key TEXT NOT NULL,
+	value TEXT NOT NULL,
+	PRIMARY KEY (run_id, key)
+)`,
+}
+
+const (
+	insertEvent = `INSERT OR IGNORE INTO events
+	(run_id, uuid, class, entity_id, deferred, replay_hint, option, json)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	insertAction = `INSERT OR REPLACE INTO actions
+	(run_id, seq, uuid, class, entity_id, event_uuid, triggered_at, signature, option, json)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	insertResult = `INSERT OR REPLACE INTO results
+	(run_id, successful, required_time_ns, outcome, validate_exit_code, signature, metadata)
+	VALUES (?, ?, ?, ?, ?, ?, ?)`
+)
+
+type eventRow struct {
+	uuid       string
+	class      string
+	entityID   string
+	deferred   bool
+	replayHint string
+	option     string
+	json       string
+}
+
+type actionRow struct {
+	seq       int
+	uuid      string
+	class     string
+	entityID  string
+	eventUUID sql.NullString
+	triggered sql.NullString
+	signature string
+	option    string
+	json      string
+}
+
+type resultRow struct {
+	successful       bool
+	requiredTime     time.Duration
+	outcome          sql.NullString
+	validateExitCode sql.NullInt64
+	signature        sql.NullString
+	labels           map[string]string
+	metadata         string
+}
+
+// returns the class and the JSON texts of the option and the whole signal
+func signalColumns(m map[string]interface{}) (string, string, string, error) {
+	class, ok := m["class"].(string)
+	if !ok {
+		return "", "", "", fmt.Errorf("no class in %v", m)
+	}
+	option := m["option"]
+	if option == nil {
+		option = map[string]interface{}{}
+	}
+	optionJS, err := json.Marshal(option)
+	if err != nil {
+		return "", "", "", err
+	}
+	js, err := json.Marshal(m)
+	if err != nil {
+		return "", "", "", err
+	}
+	return class, string(optionJS), string(js), nil
+}
+
+func newEventRow(evt Event) (eventRow, error) {
+	class, option, js, err := signalColumns(evt.JSONMap())
+	if err != nil {
+		return eventRow{}, err
+	}
+	return eventRow{
+		uuid:       evt.ID(),
+		class:      class,
+		entityID:   evt.EntityID(),
+		deferred:   evt.Deferred(),
+		replayHint: evt.ReplayHint(),
+		option:     option,
+		json:       js,
+	}, nil
+}
+
+func (r eventRow) args(runID int) []interface{} {
+	return []interface{}{runID, r.uuid, r.class, r.entityID, r.deferred, r.replayHint, r.option, r.json}
+}
+
+func newActionRow(seq int, act Action) (actionRow, error) {
+	m := act.JSONMap()
+	class, option, js, err := signalColumns(m)
+	if err != nil {
+		return actionRow{}, err
+	}
+	row := actionRow{
+		seq:       seq,
+		uuid:      act.ID(),
+		class:     class,
+		entityID:  act.EntityID(),
+		signature: naive.ActionSignature(act),
+		option:    option,
+		json:      js,
+	}
+	if eventUUID, ok := m["event_uuid"].(string); ok {
+		row.eventUUID = sql.NullString{String: eventUUID, Valid: true}
+	}
+	if t := act.TriggeredTime(); !t.IsZero() {
+		row.triggered = sql.NullString{String: t.UTC().Format(time.RFC3339Nano), Valid: true}
+	}
+	return row, nil
+}
+
+func (r actionRow) args(runID int) []interface{} {
+	return []interface{}{runID, r.seq, r.uuid, r.class, r.entityID, r.eventUUID, r.triggered, r.signature, r.option, r.json}
+}
+
+// metadata can be nil. the known keys are picked up from metadata (see historystorage.Result.Metadata()),
+// which is also stored as a JSON text.
+func newResultRow(successful bool, requiredTime time.Duration, metadata map[string]interface{}) (resultRow, error) {
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	js, err := json.Marshal(metadata)
+	if err != nil {
+		return resultRow{}, err
+	}
+	row := resultRow{
+		successful:   successful,
+		requiredTime: requiredTime,
+		labels:       map[string]string{},
+		metadata:     string(js),
+	}
+	if s, ok := metadata["outcome"].(string); ok && s != "" {
+		row.outcome = sql.NullString{String: s, Valid: true}
+	}
+	if s, ok := metadata["signature"].(string); ok && s != "" {
+		row.signature = sql.NullString{String: s, Valid: true}
+	}
+	// -1 means that validate was not run
+	switch code := metadata["validate_exit_code"].(type) {
+	case int:
+		row.validateExitCode = sql.NullInt64{Int64: int64(code), Valid: code >= 0}
+	case float64:
+		row.validateExitCode = sql.NullInt64{Int64: int64(code), Valid: code >= 0}
+	}
+	switch labels := metadata["labels"].(type) {
+	case map[string]string:
+		for k, v := range labels {
+			row.labels[k] = v
+		}
+	case map[string]interface{}:
+		for k, v := range labels {
+			row.labels[k] = fmt.Sprintf("%v", v)
+		}
+	}
+	return row, nil
+}
+
+func (r resultRow) args(runID int) []interface{} {
+	return []interface{}{runID, r.successful, int64(r.requiredTime), r.outcome, r.validateExitCode, r.signature, r.metadata}
+}
@@ -0,0 +1,346 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sqlite provides a history storage that mirrors runs, actions, events and results
+// into relational tables of a local SQLite database (<storage>/history.db),
+// so that the history can be queried with SQL.
+//
+// The SQLite driver (github.com/mattn/go-sqlite3) requires cgo, so this storage is not available in nmz.static.
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	log "github.com/cihub/seelog"
+	naive "github.com/osrg/namazu/nmz/historystorage/naive"
+	. "github.com/osrg/namazu/nmz/signal"
+	. "github.com/osrg/namazu/nmz/util/trace"
+)
+
+const (
+	driverName = "sqlite3"
+	// relative to the storage dir
+	DBPath = "history.db"
+	// WAL and busy timeout are needed for concurrent workers of "nmz campaign"
+	dsnParams = "?_busy_timeout=10000&_journal_mode=WAL"
+)
+
+// type that implements interface HistoryStorage
+//
+// Like MongoDB, the working dirs and the traces are still managed by Naive
+// (the tools and the replayable policy read them), while the results and Search() are queried from the tables.
+type SQLite struct {
+	Naive   *naive.Naive
+	dirPath string
+	DB      *sql.DB
+	// ID of the working dir created by CreateNewWorkingDir() (-1 if not created yet)
+	curID int
+}
+
+func driverAvailable() bool {
+	for _, d := range sql.Drivers() {
+		if d == driverName {
+			return true
+		}
+	}
+	return false
+}
+
+func New(dirPath string) (*SQLite, error) {
+	if !driverAvailable() {
+		return nil, fmt.Errorf("sqlite history storage is not available in this build of nmz (built with `-tags static`?)")
+	}
+	db, err := sql.Open(driverName, path.Join(dirPath, DBPath)+dsnParams)
+	if err != nil {
+		return nil, err
+	}
+	if err = createTables(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create tables in %s: %s", path.Join(dirPath, DBPath), err)
+	}
+	return &SQLite{
+		Naive:   naive.New(dirPath),
+		dirPath: dirPath,
+		DB:      db,
+		curID:   -1,
+	}, nil
+}
+
+func createTables(db *sql.DB) error {
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *SQLite) CreateStorage() error {
+	return this.Naive.CreateStorage()
+}
+
+func (this *SQLite) Init() {
+	this.Naive.Init()
+}
+
+func (this *SQLite) Close() {
+	this.Naive.Close()
+	this.DB.Close()
+}
+
+func (this *SQLite) Name() string {
+	return "sqlite"
+}
+
+func (this *SQLite) CreateNewWorkingDir() string {
+	d := this.Naive.CreateNewWorkingDir()
+	if _, err := fmt.Sscanf(path.Base(d), "%x", &this.curID); err != nil {
+		panic(log.Criticalf("unexpected working dir %s: %s", d, err))
+	}
+	// recorded here so that runs that crashed before recording the trace can be queried as well
+	_, err := this.DB.Exec("INSERT OR REPLACE INTO runs (id, dir, created_at) VALUES (?, ?, ?)",
+		this.curID, d, time.Now().UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		log.Errorf("failed to record run %d to %s: %s", this.curID, DBPath, err)
+	}
+	return d
+}
+
+func (this *SQLite) RecordNewTrace(newTrace *SingleTrace) {
+	this.Naive.RecordNewTrace(newTrace)
+	if err := this.recordTrace(newTrace); err != nil {
+		// not critical, as Naive has the trace
+		log.Errorf("failed to record trace %d to %s: %s", this.curID, DBPath, err)
+	}
+}
+
+func (this *SQLite) recordTrace(newTrace *SingleTrace) error {
+	tx, err := this.DB.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec("UPDATE runs SET nr_actions = ? WHERE id = ?", len(newTrace.ActionSequence), this.curID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for i, act := range newTrace.ActionSequence {
+		if evt := act.Event(); evt != nil {
+			row, err := newEventRow(evt)
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+			if _, err = tx.Exec(insertEvent, row.args(this.curID)...); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		row, err := newActionRow(i, act)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err = tx.Exec(insertAction, row.args(this.curID)...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (this *SQLite) RecordResult(successful bool, requiredTime time.Duration, metadata map[string]interface{}) error {
+	if err := this.Naive.RecordResult(successful, requiredTime, metadata); err != nil {
+		return err
+	}
+	row, err := newResultRow(successful, requiredTime, metadata)
+	if err != nil {
+		return err
+	}
+	tx, err := this.DB.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(insertResult, row.args(this.curID)...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM labels WHERE run_id = ?", this.curID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for k, v := range row.labels {
+		if _, err = tx.Exec("INSERT INTO labels (run_id, key, value) VALUES (?, ?, ?)", this.curID, k, v); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (this *SQLite) NrStoredHistories() int {
+	return this.Naive.NrStoredHistories()
+}
+
+func (this *SQLite) GetStoredHistory(id int) (*SingleTrace, error) {
+	return this.Naive.GetStoredHistory(id)
+}
+
+// converts sql.ErrNoRows so that os.IsNotExist() works as in Naive
+func notFound(err error, id int, name string) error {
+	if err == sql.ErrNoRows {
+		return &os.PathError{Op: "select", Path: fmt.Sprintf("%s %d", name, id), Err: os.ErrNotExist}
+	}
+	return err
+}
+
+func (this *SQLite) IsSuccessful(id int) (bool, error) {
+	var successful bool
+	err := this.DB.QueryRow("SELECT successful FROM results WHERE run_id = ?", id).Scan(&successful)
+	if err != nil {
+		return false, notFound(err, id, "result")
+	}
+	return successful, nil
+}
+
+func (this *SQLite) GetRequiredTime(id int) (time.Duration, error) {
+	var requiredTime int64
+	err := this.DB.QueryRow("SELECT required_time_ns FROM results WHERE run_id = ?", id).Scan(&requiredTime)
+	if err != nil {
+		return 0, notFound(err, id, "result")
+	}
+	return time.Duration(requiredTime), nil
+}
+
+func (this *SQLite) GetResultMetadata(id int) (map[string]interface{}, error) {
+	var js string
+	err := this.DB.QueryRow("SELECT metadata FROM results WHERE run_id = ?", id).Scan(&js)
+	if err != nil {
+		return nil, notFound(err, id, "result")
+	}
+	metadata := map[string]interface{}{}
+	if err = json.Unmarshal([]byte(js), &metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+func (this *SQLite) GetRecordedTime(id int) (time.Time, error) {
+	return this.Naive.GetRecordedTime(id)
+}
+
+func (this *SQLite) DeleteHistory(id int) error {
+	if err := this.Naive.DeleteHistory(id); err != nil {
+		return err
+	}
+	tx, err := this.DB.Begin()
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"labels", "results", "actions", "events"} {
+		if _, err = tx.Exec("DELETE FROM "+table+" WHERE run_id = ?", id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err = tx.Exec("DELETE FROM runs WHERE id = ?", id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// the rows are kept (they are small compared to the working dir)
+func (this *SQLite) CompactHistory(id int) error {
+	return this.Naive.CompactHistory(id)
+}
+
+// returns the IDs of the recorded runs whose actions match prefix, by narrowing down the candidates for each seq
+func (this *SQLite) Search(prefix []Action) []int {
+	matched, err := this.search(prefix)
+	if err != nil {
+		panic(log.Criticalf("failed to search traces: %s", err))
+	}
+	return matched
+}
+
+func (this *SQLite) search(prefix []Action) ([]int, error) {
+	if len(prefix) == 0 {
+		return queryIDs(this.DB.Query("SELECT id FROM runs WHERE nr_actions IS NOT NULL ORDER BY id"))
+	}
+	stmt, err := this.DB.Prepare("SELECT run_id FROM actions WHERE seq = ? AND signature = ? ORDER BY run_id")
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	var matched []int
+	for i, act := range prefix {
+		ids, err := queryIDs(stmt.Query(i, naive.ActionSignature(act)))
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			matched = ids
+		} else {
+			matched = intersectIDs(matched, ids)
+		}
+		if len(matched) == 0 {
+			break
+		}
+	}
+	return matched, nil
+}
+
+func queryIDs(rows *sql.Rows, err error) ([]int, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// a and b must be sorted
+func intersectIDs(a, b []int) []int {
+	ret := make([]int, 0)
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			ret = append(ret, a[i])
+			i++
+			j++
+		}
+	}
+	return ret
+}
+
+func (this *SQLite) SearchWithConverter(prefix []Action, converter func(actions []Action) []Action) []int {
+	return this.Naive.SearchWithConverter(prefix, converter)
+}
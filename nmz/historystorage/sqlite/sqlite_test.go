@@ -0,0 +1,155 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/osrg/namazu/nmz/signal"
+	. "github.com/osrg/namazu/nmz/util/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	RegisterKnownSignals()
+	os.Exit(m.Run())
+}
+
+func newTestFaultAction(t *testing.T) Action {
+	event, err := NewFilesystemEvent("entity-0", PreFsync, "/data/log", map[string]interface{}{})
+	assert.NoError(t, err)
+	action, err := NewFilesystemFaultAction(event)
+	assert.NoError(t, err)
+	return action
+}
+
+func TestNewActionRow(t *testing.T) {
+	action := newTestFaultAction(t)
+	row, err := newActionRow(3, action)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, row.seq)
+	assert.Equal(t, "FilesystemFaultAction", row.class)
+	assert.Equal(t, "entity-0", row.entityID)
+	assert.True(t, row.eventUUID.Valid)
+	assert.Equal(t, action.Event().ID(), row.eventUUID.String)
+	assert.False(t, row.triggered.Valid)
+
+	evtRow, err := newEventRow(action.Event())
+	assert.NoError(t, err)
+	assert.Equal(t, "FilesystemEvent", evtRow.class)
+	assert.True(t, evtRow.deferred)
+	var option map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(evtRow.option), &option))
+	assert.Equal(t, "/data/log", option["path"])
+}
+
+func TestNewResultRow(t *testing.T) {
+	row, err := newResultRow(false, time.Second, map[string]interface{}{
+		"outcome":            "validation_failure",
+		"validate_exit_code": 2,
+		"labels":             map[string]interface{}{"commit": "abc"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "validation_failure", row.outcome.String)
+	assert.Equal(t, int64(2), row.validateExitCode.Int64)
+	assert.True(t, row.validateExitCode.Valid)
+	assert.False(t, row.signature.Valid)
+	assert.Equal(t, map[string]string{"commit": "abc"}, row.labels)
+
+	// decoded from result.json, validate not run
+	row, err = newResultRow(true, time.Second, map[string]interface{}{"validate_exit_code": float64(-1)})
+	assert.NoError(t, err)
+	assert.False(t, row.validateExitCode.Valid)
+
+	row, err = newResultRow(true, time.Second, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", row.metadata)
+}
+
+func TestIntersectIDs(t *testing.T) {
+	assert.Equal(t, []int{2, 5}, intersectIDs([]int{1, 2, 3, 5}, []int{2, 4, 5, 6}))
+	assert.Equal(t, []int{}, intersectIDs([]int{1}, []int{}))
+}
+
+func TestSQLite(t *testing.T) {
+	if !driverAvailable() {
+		t.Skip("sqlite driver is not linked (static build)")
+	}
+	dir, err := ioutil.TempDir("", "test-sqlite")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	s, err := New(dir)
+	assert.NoError(t, err)
+	s.CreateStorage()
+	s.Close()
+
+	for i := 0; i < 2; i++ {
+		s, err = New(dir)
+		assert.NoError(t, err)
+		s.Init()
+		s.CreateNewWorkingDir()
+		s.RecordNewTrace(&SingleTrace{ActionSequence: []Action{newTestFaultAction(t)}})
+		outcome := "pass"
+		if i == 1 {
+			outcome = "validation_failure"
+		}
+		assert.NoError(t, s.RecordResult(i == 0, time.Second, map[string]interface{}{"outcome": outcome}))
+		s.Close()
+	}
+
+	s, err = New(dir)
+	assert.NoError(t, err)
+	defer s.Close()
+	var id int
+	var option string
+	err = s.DB.QueryRow(`SELECT DISTINCT runs.id, events.option FROM runs
+		JOIN results ON results.run_id = runs.id
+		JOIN actions ON actions.run_id = runs.id
+		JOIN events ON events.run_id = runs.id AND events.uuid = actions.event_uuid
+		WHERE actions.class = 'FilesystemFaultAction'
+		AND results.outcome = 'validation_failure'`).Scan(&id, &option)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, id)
+	assert.Contains(t, option, `"path":"/data/log"`)
+
+	successful, err := s.IsSuccessful(1)
+	assert.NoError(t, err)
+	assert.False(t, successful)
+	requiredTime, err := s.GetRequiredTime(0)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, requiredTime)
+	metadata, err := s.GetResultMetadata(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "validation_failure", metadata["outcome"])
+	_, err = s.IsSuccessful(2)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Equal(t, []int{0, 1}, s.Search([]Action{}))
+	assert.Equal(t, []int{0, 1}, s.Search([]Action{newTestFaultAction(t)}))
+	assert.Equal(t, []int{}, s.Search([]Action{newTestFaultAction(t), newTestFaultAction(t)}))
+
+	assert.NoError(t, s.DeleteHistory(1))
+	assert.Equal(t, []int{0}, s.Search([]Action{newTestFaultAction(t)}))
+	var nr int
+	assert.NoError(t, s.DB.QueryRow("SELECT COUNT(*) FROM actions").Scan(&nr))
+	assert.Equal(t, 1, nr)
+}
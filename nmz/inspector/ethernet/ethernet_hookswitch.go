@@ -26,6 +26,7 @@ import (
 	"github.com/osrg/namazu/nmz/inspector/ethernet/tcpwatcher"
 	"github.com/osrg/namazu/nmz/inspector/transceiver"
 	"github.com/osrg/namazu/nmz/signal"
+	"github.com/osrg/namazu/nmz/util/packet"
 	zmq "github.com/vaughan0/go-zmq"
 )
 
@@ -82,7 +83,7 @@ func (this *HookSwitchInspector) Serve() error {
 				log.Error(err)
 				continue
 			}
-			eth, ip, tcp := parseEthernetBytes(ethBytes)
+			eth, ip, tcp := packet.ParseEthernet(ethBytes)
 			// note: tcpwatcher is not thread-safe
 			if this.EnableTCPWatcher && this.tcpWatcher.IsTCPRetrans(ip, tcp) {
 				meta.Op = hookswitch.Drop
@@ -125,7 +126,7 @@ func (this *HookSwitchInspector) decodeZMQMessageBytes(msgBytes [][]byte) (*hook
 func (this *HookSwitchInspector) onHookSwitchMessage(meta hookswitch.HookSwitchMeta,
 	bytes []byte,
 	eth *layers.Ethernet, ip *layers.IPv4, tcp *layers.TCP) error {
-	srcEntityID, dstEntityID := makeEntityIDs(eth, ip, tcp)
+	srcEntityID, dstEntityID := packet.EntityIDs(eth, ip, tcp)
 	event, err := signal.NewPacketEvent(this.EntityID,
 		srcEntityID, dstEntityID, map[string]interface{}{
 			"bytes": bytes,
@@ -24,6 +24,7 @@ import (
 	"github.com/osrg/namazu/nmz/inspector/ethernet/tcpwatcher"
 	"github.com/osrg/namazu/nmz/inspector/transceiver"
 	"github.com/osrg/namazu/nmz/signal"
+	"github.com/osrg/namazu/nmz/util/packet"
 )
 
 // TODO: support user-written MapPacketToEventFunc
@@ -94,7 +95,7 @@ func packetBytes(nfp netfilter.NFPacket) []byte {
 
 func (this *NFQInspector) onPacket(nfp netfilter.NFPacket,
 	ip *layers.IPv4, tcp *layers.TCP) error {
-	srcEntityID, dstEntityID := makeEntityIDs(nil, ip, tcp)
+	srcEntityID, dstEntityID := packet.EntityIDs(nil, ip, tcp)
 	bytes := packetBytes(nfp)
 	event, err := signal.NewPacketEvent(this.EntityID,
 		srcEntityID, dstEntityID,
@@ -0,0 +1,100 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nmz
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/osrg/namazu/nmz/signal"
+)
+
+// The fault terms a failpoint can take
+const (
+	TermError = signal.FailpointTermError
+	TermPanic = signal.FailpointTermPanic
+	TermSleep = signal.FailpointTermSleep
+)
+
+// Returned by Failpoint when the orchestrator injects an error (FailpointErrorAction)
+type FailpointError struct {
+	Name string
+}
+
+func (this *FailpointError) Error() string {
+	return fmt.Sprintf("nmz: failpoint %s: injected error", this.Name)
+}
+
+// executes the action for the failpoint
+func evalFailpointAction(ctx context.Context, name string, action signal.Action) error {
+	switch a := action.(type) {
+	case *signal.FailpointErrorAction:
+		return &FailpointError{Name: name}
+	case *signal.FailpointPanicAction:
+		panic(fmt.Sprintf("nmz: failpoint %s: injected panic", name))
+	case *signal.FailpointSleepAction:
+		d, err := a.Duration()
+		if err != nil {
+			log.Warnf("failpoint %s: %s", name, err)
+			return nil
+		}
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+		}
+	}
+	return nil
+}
+
+func (this *inspector) failpoint(ctx context.Context, name string, terms []string) error {
+	event, err := signal.NewFailpointEvent(this.entityID, name, terms)
+	if err != nil {
+		// the testee is wrong
+		panic(err)
+	}
+	action, err := this.sendEvent(ctx, event)
+	if err != nil {
+		log.Warnf("failpoint %s: %s", name, err)
+		return nil
+	}
+	return evalFailpointAction(ctx, name, action)
+}
+
+// Evaluates the named failpoint (like gofail and pingcap/failpoint), and blocks until the orchestrator decides
+// whether the failpoint continues (returns nil), returns an error (*FailpointError), panics, or sleeps (and then returns nil).
+//
+// terms: the terms the failpoint can take (TermError, TermPanic, TermSleep). if empty, only TermError.
+//
+//	if err := nmz.Failpoint(ctx, "raftBeforeSave", nmz.TermError, nmz.TermSleep); err != nil {
+//		return err
+//	}
+//
+// Returns nil immediately if NMZ_ORCHESTRATOR_URL is not set.
+// Only injected errors are returned; the other errors (e.g. the orchestrator is unreachable) are logged,
+// and the failpoint continues.
+// Note that the PB transceiver ("pb://") does not support failpoints.
+func Failpoint(ctx context.Context, name string, terms ...string) error {
+	insp, err := getDefaultInspector()
+	if insp == nil {
+		if err != nil {
+			log.Warnf("failpoint %s: %s", name, err)
+		}
+		return nil
+	}
+	return insp.failpoint(ctx, name, terms)
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nmz
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/osrg/namazu/nmz/signal"
+	"github.com/stretchr/testify/assert"
+)
+
+// always sends the fault action for the term
+type faultTransceiver struct {
+	term  string
+	sleep time.Duration
+}
+
+func (this faultTransceiver) SendEvent(event signal.Event) (chan signal.Action, error) {
+	action, err := event.(*signal.FailpointEvent).FaultAction(this.term, this.sleep)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan signal.Action, 1)
+	ch <- action
+	return ch, nil
+}
+
+func (faultTransceiver) Start() {}
+
+func TestFailpointDisabled(t *testing.T) {
+	os.Unsetenv(EnvOrchestratorURL)
+	assert.NoError(t, Failpoint(context.Background(), "foo"))
+}
+
+func TestInspectorFailpoint(t *testing.T) {
+	insp, err := newInspector("local://", "_dummy_go_entity")
+	assert.NoError(t, err)
+	assert.NoError(t, insp.failpoint(context.Background(), "raftBeforeSave", []string{TermError}))
+
+	insp.trans = faultTransceiver{term: TermError}
+	err = insp.failpoint(context.Background(), "raftBeforeSave", nil)
+	assert.Equal(t, &FailpointError{Name: "raftBeforeSave"}, err)
+
+	insp.trans = faultTransceiver{term: TermPanic}
+	assert.Panics(t, func() {
+		insp.failpoint(context.Background(), "raftBeforeSave", []string{TermPanic})
+	})
+
+	insp.trans = faultTransceiver{term: TermSleep, sleep: 20 * time.Millisecond}
+	begin := time.Now()
+	assert.NoError(t, insp.failpoint(context.Background(), "raftBeforeSave", []string{TermSleep}))
+	assert.True(t, time.Since(begin) >= 20*time.Millisecond)
+
+	// the orchestrator is unreachable
+	insp.trans = blackholeTransceiver{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.NoError(t, insp.failpoint(ctx, "raftBeforeSave", nil))
+
+	assert.Panics(t, func() {
+		insp.failpoint(context.Background(), "raftBeforeSave", []string{"return(1)"})
+	})
+}
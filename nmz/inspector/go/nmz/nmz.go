@@ -0,0 +1,135 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package nmz is the inspector library for Go testees.
+//
+// The testee calls Hook at the interesting points (e.g. before sending a message),
+// and Hook blocks until the orchestrator accepts the event (GoFunctionEvent):
+//
+//	nmz.Hook(ctx, "raft.sendAppend", map[string]interface{}{"to": to, "index": index})
+//
+// Failpoint evaluates a named failpoint, and the orchestrator decides whether it continues,
+// returns an error, panics, or sleeps (FailpointEvent).
+//
+// Hook and Failpoint are no-ops unless the environment variable NMZ_ORCHESTRATOR_URL is set,
+// so they can be left in the production code.
+//
+//	NMZ_ORCHESTRATOR_URL: "http://localhost:10080/api/v3" (REST), "pb://localhost:10000" (ProtocolBuffers), or "local://" (in the same process)
+//	NMZ_ENTITY_ID: entity ID (default: the name of the executable)
+package nmz
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/osrg/namazu/nmz/inspector/transceiver"
+	"github.com/osrg/namazu/nmz/signal"
+)
+
+const (
+	EnvOrchestratorURL = "NMZ_ORCHESTRATOR_URL"
+	EnvEntityID        = "NMZ_ENTITY_ID"
+)
+
+// returned when the transceiver loses the connection before the action is received
+var ErrDisconnected = errors.New("lost the connection to the orchestrator")
+
+type inspector struct {
+	entityID string
+	trans    transceiver.Transceiver
+}
+
+func newInspector(orchestratorURL, entityID string) (*inspector, error) {
+	trans, err := transceiver.NewTransceiver(orchestratorURL, entityID)
+	if err != nil {
+		return nil, err
+	}
+	trans.Start()
+	return &inspector{entityID: entityID, trans: trans}, nil
+}
+
+// sends the event, and returns the action from the orchestrator.
+// if ctx is done before the action, returns ctx.Err() (the action is discarded).
+func (this *inspector) sendEvent(ctx context.Context, event signal.Event) (signal.Action, error) {
+	actionCh, err := this.trans.SendEvent(event)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case action, ok := <-actionCh:
+		if !ok {
+			return nil, ErrDisconnected
+		}
+		return action, nil
+	case <-ctx.Done():
+		// the transceiver blocks until someone receives the action
+		go func() { <-actionCh }()
+		return nil, ctx.Err()
+	}
+}
+
+func (this *inspector) hook(ctx context.Context, name string, params map[string]interface{}) (signal.Action, error) {
+	event, err := signal.NewGoFunctionEvent(this.entityID, name, params)
+	if err != nil {
+		return nil, err
+	}
+	return this.sendEvent(ctx, event)
+}
+
+var (
+	defaultInspector     *inspector
+	defaultInspectorErr  error
+	defaultInspectorOnce sync.Once
+)
+
+// returns nil (and nil error) if NMZ_ORCHESTRATOR_URL is not set
+func getDefaultInspector() (*inspector, error) {
+	defaultInspectorOnce.Do(func() {
+		orchestratorURL := os.Getenv(EnvOrchestratorURL)
+		if orchestratorURL == "" {
+			return
+		}
+		entityID := os.Getenv(EnvEntityID)
+		if entityID == "" {
+			entityID = filepath.Base(os.Args[0])
+		}
+		signal.RegisterKnownSignals()
+		defaultInspector, defaultInspectorErr = newInspector(orchestratorURL, entityID)
+	})
+	return defaultInspector, defaultInspectorErr
+}
+
+// Returns true if NMZ_ORCHESTRATOR_URL is set
+func Enabled() bool {
+	return os.Getenv(EnvOrchestratorURL) != ""
+}
+
+// Notifies the orchestrator that the function name is called with params,
+// and blocks until the orchestrator accepts it (or ctx is done).
+//
+// params should be serializable to JSON (e.g. string, numbers, bool).
+// Returns nil immediately if NMZ_ORCHESTRATOR_URL is not set.
+// The error is returned if the orchestrator is unreachable; the testee may ignore it.
+func Hook(ctx context.Context, name string, params map[string]interface{}) error {
+	insp, err := getDefaultInspector()
+	if insp == nil {
+		return err
+	}
+	_, err = insp.hook(ctx, name, params)
+	return err
+}
@@ -0,0 +1,97 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nmz
+
+import (
+	"context"
+	"flag"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/osrg/namazu/nmz/endpoint/local"
+	"github.com/osrg/namazu/nmz/signal"
+	logutil "github.com/osrg/namazu/nmz/util/log"
+	"github.com/osrg/namazu/nmz/util/mockorchestrator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	logutil.InitLog("", true)
+	signal.RegisterKnownSignals()
+	orcActionCh := make(chan signal.Action)
+	orcEventCh := local.SingletonLocalEndpoint.Start(orcActionCh)
+	defer local.SingletonLocalEndpoint.Shutdown()
+	mockOrc := mockorchestrator.NewMockOrchestrator(orcEventCh, orcActionCh)
+	mockOrc.Start()
+	defer mockOrc.Shutdown()
+	os.Exit(m.Run())
+}
+
+func TestHookDisabled(t *testing.T) {
+	os.Unsetenv(EnvOrchestratorURL)
+	assert.False(t, Enabled())
+	assert.NoError(t, Hook(context.Background(), "foo", nil))
+}
+
+func TestInspectorHook(t *testing.T) {
+	insp, err := newInspector("local://", "_dummy_go_entity")
+	assert.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		action, err := insp.hook(context.Background(), "raft.sendAppend", map[string]interface{}{"to": i})
+		assert.NoError(t, err)
+		assert.IsType(t, &signal.EventAcceptanceAction{}, action)
+		event := action.Event()
+		assert.Equal(t, "GoFunctionEvent", event.JSONMap()["class"])
+		assert.Equal(t, "_dummy_go_entity", event.EntityID())
+		assert.Equal(t, "raft.sendAppend", event.ReplayHint())
+	}
+}
+
+// never sends the action
+type blackholeTransceiver struct{}
+
+func (blackholeTransceiver) SendEvent(event signal.Event) (chan signal.Action, error) {
+	return make(chan signal.Action), nil
+}
+
+func (blackholeTransceiver) Start() {}
+
+func TestInspectorHookCanceled(t *testing.T) {
+	insp := &inspector{entityID: "_dummy_go_entity", trans: blackholeTransceiver{}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := insp.hook(ctx, "raft.sendAppend", nil)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+// closes the channel as if the connection is lost
+type disconnectedTransceiver struct{}
+
+func (disconnectedTransceiver) SendEvent(event signal.Event) (chan signal.Action, error) {
+	ch := make(chan signal.Action)
+	close(ch)
+	return ch, nil
+}
+
+func (disconnectedTransceiver) Start() {}
+
+func TestInspectorHookDisconnected(t *testing.T) {
+	insp := &inspector{entityID: "_dummy_go_entity", trans: disconnectedTransceiver{}}
+	_, err := insp.hook(context.Background(), "raft.sendAppend", nil)
+	assert.Equal(t, ErrDisconnected, err)
+}
@@ -0,0 +1,205 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logline provides the inspector that tails log files and syslog sockets,
+// and sends LogEvents for the lines that match the rules.
+package logline
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+
+	"github.com/osrg/namazu/nmz/inspector/transceiver"
+	"github.com/osrg/namazu/nmz/signal"
+)
+
+// the options set by the inspector. the capturing groups cannot use these names.
+var reservedOptions = map[string]bool{
+	"message":    true,
+	"rule":       true,
+	"src_entity": true,
+}
+
+// a named regexp.
+// the capturing groups of the regexp are set as the options of LogEvent.
+type Rule struct {
+	Name   string
+	Regexp *regexp.Regexp
+}
+
+// parses "name=regexp", e.g. `leader=became leader at term (?P<term>\d+)`
+func ParseRule(s string) (Rule, error) {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+		return Rule{}, fmt.Errorf("bad rule %s (should be name=regexp)", s)
+	}
+	re, err := regexp.Compile(kv[1])
+	if err != nil {
+		return Rule{}, fmt.Errorf("bad rule %s: %s", s, err)
+	}
+	for _, name := range re.SubexpNames() {
+		if reservedOptions[name] {
+			return Rule{}, fmt.Errorf("bad rule %s: group name %q is reserved", s, name)
+		}
+	}
+	return Rule{Name: kv[0], Regexp: re}, nil
+}
+
+// Returns the options for LogEvent if the line matches, or nil.
+//
+// the named groups are set as is, and the unnamed groups are set as "group1", "group2", ..
+func (this Rule) Match(line string) map[string]interface{} {
+	m := this.Regexp.FindStringSubmatch(line)
+	if m == nil {
+		return nil
+	}
+	opt := map[string]interface{}{
+		"rule": this.Name,
+	}
+	for i, name := range this.Regexp.SubexpNames() {
+		if i == 0 {
+			continue
+		}
+		if name == "" {
+			name = fmt.Sprintf("group%d", i)
+		}
+		opt[name] = m[i]
+	}
+	return opt
+}
+
+type logLine struct {
+	// file path, or the address of the syslog client
+	source string
+	text   string
+}
+
+type LogInspector struct {
+	OrchestratorURL string
+	EntityID        string
+	Rules           []Rule
+	// files to tail
+	Files []string
+	// syslog socket, e.g. "udp://:10514", "unixgram:///tmp/nmz-syslog.sock" (disabled if empty)
+	SyslogAddr string
+	// if true, the lines already in the files are also inspected
+	FromBeginning bool
+	// interval for polling the files
+	PollInterval time.Duration
+	notifier     transceiver.Notifier
+	stopCh       chan struct{}
+	// closed by Shutdown(), so that the unixgram socket file is removed before Shutdown() returns
+	syslogConn   net.PacketConn
+	syslogConnMu sync.Mutex
+}
+
+func NewLogInspector(orchestratorURL, entityID string, rules []Rule, files []string, syslogAddr string) (*LogInspector, error) {
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no rule")
+	}
+	if len(files) == 0 && syslogAddr == "" {
+		return nil, fmt.Errorf("no file or syslog socket to inspect")
+	}
+	return &LogInspector{
+		OrchestratorURL: orchestratorURL,
+		EntityID:        entityID,
+		Rules:           rules,
+		Files:           files,
+		SyslogAddr:      syslogAddr,
+		PollInterval:    100 * time.Millisecond,
+		stopCh:          make(chan struct{}),
+	}, nil
+}
+
+func (this *LogInspector) Serve() error {
+	log.Debugf("Initializing Log Inspector %#v", this)
+	if this.notifier == nil {
+		trans, err := transceiver.NewTransceiver(this.OrchestratorURL, this.EntityID)
+		if err != nil {
+			return err
+		}
+		notifier, ok := trans.(transceiver.Notifier)
+		if !ok {
+			return fmt.Errorf("the transceiver for %s does not support LogEvent", this.OrchestratorURL)
+		}
+		trans.Start()
+		this.notifier = notifier
+	}
+
+	lineCh := make(chan logLine)
+	if this.SyslogAddr != "" {
+		conn, err := listenSyslog(this.SyslogAddr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		this.syslogConnMu.Lock()
+		this.syslogConn = conn
+		this.syslogConnMu.Unlock()
+		log.Infof("Listening syslog on %s", this.SyslogAddr)
+		go serveSyslog(conn, this.stopCh, lineCh)
+	}
+	for _, path := range this.Files {
+		log.Infof("Tailing %s", path)
+		go tailFile(path, this.FromBeginning, this.PollInterval, this.stopCh, lineCh)
+	}
+
+	for {
+		select {
+		case l := <-lineCh:
+			if err := this.onLine(l.source, l.text); err != nil {
+				log.Error(err)
+			}
+		case <-this.stopCh:
+			log.Info("Shutting down..")
+			return nil
+		}
+	}
+}
+
+func (this *LogInspector) Shutdown() {
+	close(this.stopCh)
+	this.syslogConnMu.Lock()
+	defer this.syslogConnMu.Unlock()
+	if this.syslogConn != nil {
+		if err := this.syslogConn.Close(); err != nil {
+			log.Warnf("failed to close the syslog socket: %s", err)
+		}
+	}
+}
+
+// sends LogEvent if the line matches a rule (only the first matched rule is used)
+func (this *LogInspector) onLine(source, line string) error {
+	for _, rule := range this.Rules {
+		opt := rule.Match(line)
+		if opt == nil {
+			continue
+		}
+		opt["src_entity"] = source
+		event, err := signal.NewLogEvent(this.EntityID, line, opt)
+		if err != nil {
+			return err
+		}
+		log.Debugf("Sending %s", event)
+		return this.notifier.Notify(event)
+	}
+	return nil
+}
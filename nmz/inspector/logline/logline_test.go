@@ -0,0 +1,220 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logline
+
+import (
+	"flag"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/osrg/namazu/nmz/signal"
+	logutil "github.com/osrg/namazu/nmz/util/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	logutil.InitLog("", true)
+	signal.RegisterKnownSignals()
+	os.Exit(m.Run())
+}
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule(`leader=became leader at term (?P<term>\d+) \((\w+)\)`)
+	assert.NoError(t, err)
+	assert.Equal(t, "leader", rule.Name)
+	assert.Nil(t, rule.Match("became follower at term 3"))
+	assert.Equal(t, map[string]interface{}{
+		"rule":   "leader",
+		"term":   "3",
+		"group2": "raft",
+	}, rule.Match("2016/01/02 15:04:05 became leader at term 3 (raft)"))
+
+	for _, s := range []string{"leader", "=foo", "leader=", "leader=(", `leader=(?P<message>.*)`} {
+		_, err = ParseRule(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestParseSyslogMessage(t *testing.T) {
+	assert.Equal(t, []string{"Jan  2 15:04:05 zksrv1 zk: became leader"},
+		parseSyslogMessage([]byte("<30>Jan  2 15:04:05 zksrv1 zk: became leader\n")))
+	assert.Equal(t, []string{"foo", "bar"}, parseSyslogMessage([]byte("<30>foo\r\n<30>bar\x00")))
+	assert.Empty(t, parseSyslogMessage([]byte("<30>\n")))
+}
+
+func recvLine(t *testing.T, lineCh chan logLine) string {
+	select {
+	case l := <-lineCh:
+		return l.text
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out")
+	}
+	return ""
+}
+
+func appendFile(t *testing.T, path, s string) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	assert.NoError(t, err)
+	_, err = f.WriteString(s)
+	assert.NoError(t, err)
+	f.Close()
+}
+
+func TestTailFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-logline")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "zk.log")
+	appendFile(t, path, "old line\n")
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	lineCh := make(chan logLine)
+	go tailFile(path, false, 10*time.Millisecond, stopCh, lineCh)
+	// wait for the file to be opened
+	time.Sleep(100 * time.Millisecond)
+
+	appendFile(t, path, "line 1\nline ")
+	assert.Equal(t, "line 1", recvLine(t, lineCh))
+	time.Sleep(50 * time.Millisecond)
+	appendFile(t, path, "2\r\n")
+	assert.Equal(t, "line 2", recvLine(t, lineCh))
+
+	// rotated
+	assert.NoError(t, os.Rename(path, path+".1"))
+	appendFile(t, path, "line 3\n")
+	assert.Equal(t, "line 3", recvLine(t, lineCh))
+
+	// truncated
+	assert.NoError(t, ioutil.WriteFile(path, []byte("x\n"), 0644))
+	assert.Equal(t, "x", recvLine(t, lineCh))
+}
+
+// records the events
+type testNotifier struct {
+	eventCh chan signal.Event
+}
+
+func (this *testNotifier) Notify(event signal.Event) error {
+	this.eventCh <- event
+	return nil
+}
+
+func recvEvent(t *testing.T, eventCh chan signal.Event) map[string]interface{} {
+	select {
+	case event := <-eventCh:
+		assert.IsType(t, &signal.LogEvent{}, event)
+		assert.Equal(t, "_dummy_log_entity", event.EntityID())
+		assert.False(t, event.Deferred())
+		return event.JSONMap()["option"].(map[string]interface{})
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out")
+	}
+	return nil
+}
+
+func TestLogInspector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-logline")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "zk.log")
+	sockPath := filepath.Join(dir, "syslog.sock")
+
+	var rules []Rule
+	for _, s := range []string{`leader=became leader at term (?P<term>\d+)`, `error=ERROR (.*)`} {
+		rule, err := ParseRule(s)
+		assert.NoError(t, err)
+		rules = append(rules, rule)
+	}
+	_, err = NewLogInspector("local://", "_dummy_log_entity", rules, nil, "")
+	assert.Error(t, err)
+	insp, err := NewLogInspector("local://", "_dummy_log_entity", rules, []string{path}, "unixgram://"+sockPath)
+	assert.NoError(t, err)
+	insp.PollInterval = 10 * time.Millisecond
+	notifier := &testNotifier{eventCh: make(chan signal.Event)}
+	insp.notifier = notifier
+	go func() {
+		assert.NoError(t, insp.Serve())
+	}()
+	defer insp.Shutdown()
+	time.Sleep(100 * time.Millisecond)
+
+	appendFile(t, path, "not matched\nzksrv1 became leader at term 3\n")
+	assert.Equal(t, map[string]interface{}{
+		"message":    "zksrv1 became leader at term 3",
+		"rule":       "leader",
+		"term":       "3",
+		"src_entity": path,
+	}, recvEvent(t, notifier.eventCh))
+
+	conn, err := net.Dial("unixgram", sockPath)
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("<11>Jan  2 15:04:05 zksrv2 zk: ERROR disk full"))
+	assert.NoError(t, err)
+	opt := recvEvent(t, notifier.eventCh)
+	assert.Equal(t, "error", opt["rule"])
+	assert.Equal(t, "disk full", opt["group1"])
+	assert.Equal(t, "Jan  2 15:04:05 zksrv2 zk: ERROR disk full", opt["message"])
+}
+
+func TestLogInspectorRestartUnixgram(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-logline")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	sockPath := filepath.Join(dir, "syslog.sock")
+	rule, err := ParseRule(`error=ERROR (.*)`)
+	assert.NoError(t, err)
+
+	// stale socket left by a crashed inspector
+	stale, err := net.ListenPacket("unixgram", sockPath)
+	assert.NoError(t, err)
+	stale.Close()
+
+	for i := 0; i < 2; i++ {
+		insp, err := NewLogInspector("local://", "_dummy_log_entity", []Rule{rule}, nil, "unixgram://"+sockPath)
+		assert.NoError(t, err)
+		notifier := &testNotifier{eventCh: make(chan signal.Event)}
+		insp.notifier = notifier
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- insp.Serve()
+		}()
+
+		var conn net.Conn
+		for j := 0; j < 100; j++ {
+			if conn, err = net.Dial("unixgram", sockPath); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.NoError(t, err, "run %d", i)
+		_, err = conn.Write([]byte("<11>zk: ERROR disk full"))
+		assert.NoError(t, err)
+		assert.Equal(t, "disk full", recvEvent(t, notifier.eventCh)["group1"])
+		conn.Close()
+
+		insp.Shutdown()
+		_, err = os.Stat(sockPath)
+		assert.True(t, os.IsNotExist(err), "socket should be removed on Shutdown()")
+		assert.NoError(t, <-errCh)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logline
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	log "github.com/cihub/seelog"
+)
+
+// listens on "udp://host:port" or "unixgram:///path/to/socket"
+func listenSyslog(addr string) (net.PacketConn, error) {
+	kv := strings.SplitN(addr, "://", 2)
+	if len(kv) != 2 {
+		return nil, fmt.Errorf("bad syslog address %s (should be udp://host:port or unixgram:///path)", addr)
+	}
+	switch kv[0] {
+	case "udp", "udp4", "udp6":
+		return net.ListenPacket(kv[0], kv[1])
+	case "unixgram":
+		// left by the inspector which was not shut down
+		if fi, err := os.Lstat(kv[1]); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			log.Warnf("removing stale syslog socket %s", kv[1])
+			if err = os.Remove(kv[1]); err != nil {
+				return nil, err
+			}
+		}
+		conn, err := net.ListenPacket(kv[0], kv[1])
+		if err != nil {
+			return nil, err
+		}
+		return &unixgramConn{PacketConn: conn, path: kv[1]}, nil
+	}
+	return nil, fmt.Errorf("unsupported syslog network %s", kv[0])
+}
+
+// unlinks the socket file on Close(), which net.UnixConn does not do (unlike net.UnixListener)
+type unixgramConn struct {
+	net.PacketConn
+	path string
+	once sync.Once
+}
+
+func (this *unixgramConn) Close() error {
+	var err error
+	this.once.Do(func() {
+		err = this.PacketConn.Close()
+		if rerr := os.Remove(this.path); rerr != nil && err == nil {
+			err = rerr
+		}
+	})
+	return err
+}
+
+// "<PRI>" of RFC 3164 and RFC 5424
+var syslogPriRegexp = regexp.MustCompile(`^<\d{1,3}>`)
+
+// returns the lines in the syslog message, without "<PRI>"
+func parseSyslogMessage(b []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimRight(line, "\r\x00")
+		line = syslogPriRegexp.ReplaceAllString(line, "")
+		if line == "" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// receives the syslog messages from conn, and sends the lines to lineCh until conn is closed or stopCh is closed
+func serveSyslog(conn net.PacketConn, stopCh <-chan struct{}, lineCh chan<- logLine) {
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-stopCh:
+			default:
+				log.Errorf("failed to receive syslog message: %s", err)
+			}
+			return
+		}
+		source := "syslog"
+		if addr != nil && addr.String() != "" {
+			source = addr.String()
+		}
+		for _, line := range parseSyslogMessage(buf[:n]) {
+			select {
+			case lineCh <- logLine{source: source, text: line}:
+			case <-stopCh:
+				return
+			}
+		}
+	}
+}
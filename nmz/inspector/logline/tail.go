@@ -0,0 +1,108 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logline
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+// tails the file like `tail -F`, and sends the lines to lineCh until stopCh is closed.
+//
+// the file is reopened if it is rotated or truncated.
+// if the file does not exist yet (or fromBeginning is true), the file is read from the beginning.
+func tailFile(path string, fromBeginning bool, pollInterval time.Duration, stopCh <-chan struct{}, lineCh chan<- logLine) {
+	var (
+		f       *os.File
+		fi      os.FileInfo
+		r       *bufio.Reader
+		offset  int64
+		partial string
+	)
+	closeFile := func() {
+		if f != nil {
+			f.Close()
+			f = nil
+		}
+	}
+	defer closeFile()
+	send := func(text string) bool {
+		select {
+		case lineCh <- logLine{source: path, text: text}:
+			return true
+		case <-stopCh:
+			return false
+		}
+	}
+
+	first := true
+	for {
+		if f == nil {
+			var err error
+			if f, err = os.Open(path); err == nil {
+				offset = 0
+				if first && !fromBeginning {
+					if offset, err = f.Seek(0, io.SeekEnd); err != nil {
+						log.Warnf("failed to seek %s: %s", path, err)
+					}
+				}
+				fi, _ = f.Stat()
+				r = bufio.NewReader(f)
+				partial = ""
+			} else if !os.IsNotExist(err) {
+				log.Warnf("failed to open %s: %s", path, err)
+			}
+			// the file created (or rotated) later is read from the beginning
+			first = false
+		}
+
+		if f != nil {
+			for {
+				s, err := r.ReadString('\n')
+				offset += int64(len(s))
+				if err != nil {
+					// the line is not terminated yet
+					partial += s
+					break
+				}
+				if !send(partial + strings.TrimRight(s, "\r\n")) {
+					return
+				}
+				partial = ""
+			}
+			cur, err := os.Stat(path)
+			if err != nil || fi == nil || !os.SameFile(fi, cur) || cur.Size() < offset {
+				log.Debugf("%s is rotated or truncated", path)
+				if partial != "" && !send(partial) {
+					return
+				}
+				closeFile()
+				continue
+			}
+		}
+
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(pollInterval):
+		}
+	}
+}
@@ -39,6 +39,7 @@ func (this *LocalTransceiver) SendEvent(event Event) (chan Action, error) {
 	this.mMutex.Lock()
 	// put ch to m BEFORE sending, otherwise race may occur
 	this.m[event.ID()] = ch
+	observeSentEvent(event, len(this.m))
 	this.mMutex.Unlock()
 	go func() {
 		localep.SingletonLocalEndpoint.InspectorEventCh <- event
@@ -46,6 +47,18 @@ func (this *LocalTransceiver) SendEvent(event Event) (chan Action, error) {
 	return ch, nil
 }
 
+// implements Notifier
+func (this *LocalTransceiver) Notify(event Event) error {
+	if event.Deferred() {
+		return fmt.Errorf("Notify() is not for a deferred event %s", event)
+	}
+	this.mMutex.Lock()
+	observeSentEvent(event, len(this.m))
+	this.mMutex.Unlock()
+	localep.SingletonLocalEndpoint.InspectorEventCh <- event
+	return nil
+}
+
 func (this *LocalTransceiver) onAction(action Action) error {
 	event := action.Event()
 	if event == nil {
@@ -58,6 +71,7 @@ func (this *LocalTransceiver) onAction(action Action) error {
 		return fmt.Errorf("No channel found for action %s (event id=%s)", action, event.ID())
 	}
 	delete(this.m, event.ID())
+	observeReceivedAction(action, len(this.m))
 	// Namazu doesn't guarantee any determinism,
 	// but can we make this more deterministic?
 	go func() {
@@ -0,0 +1,43 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transceiver
+
+import (
+	. "github.com/osrg/namazu/nmz/signal"
+	"github.com/osrg/namazu/nmz/util/metrics"
+	signalutil "github.com/osrg/namazu/nmz/util/signal"
+)
+
+var (
+	sentEventsTotal = metrics.NewCounterVec("nmz_inspector_events_sent_total",
+		"Number of events sent from the inspector to the orchestrator.", "class", "entity")
+	receivedActionsTotal = metrics.NewCounterVec("nmz_inspector_actions_received_total",
+		"Number of actions received by the inspector.", "class", "entity")
+	waitingEvents = metrics.NewGaugeVec("nmz_inspector_waiting_events",
+		"Number of events waiting for actions in the inspector.", "entity")
+)
+
+// must be called with the lock for m held
+func observeSentEvent(event Event, waiting int) {
+	sentEventsTotal.Inc(signalutil.EventClass(event), event.EntityID())
+	waitingEvents.Set(float64(waiting), event.EntityID())
+}
+
+// must be called with the lock for m held
+func observeReceivedAction(action Action, waiting int) {
+	receivedActionsTotal.Inc(signalutil.ActionClass(action), action.EntityID())
+	waitingEvents.Set(float64(waiting), action.EntityID())
+}
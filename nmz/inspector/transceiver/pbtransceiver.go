@@ -0,0 +1,207 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transceiver
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/cihub/seelog"
+	"github.com/golang/protobuf/proto"
+	. "github.com/osrg/namazu/nmz/signal"
+	pbutil "github.com/osrg/namazu/nmz/util/pb"
+)
+
+// builds the PB request message for the function event (e.g. GoFunctionEvent)
+//
+// the PB protocol has no field for the language, so the params are sent as JavaSpecificFields
+// (and the orchestrator receives the event as a JavaFunctionEvent)
+func pbRequestMessage(event Event, msgID int32) (*pbutil.InspectorMsgReq, error) {
+	opt, _ := event.JSONMap()["option"].(map[string]interface{})
+	functionName, ok := opt["function_name"].(string)
+	if !ok {
+		return nil, fmt.Errorf("PB transceiver supports only function events, got %s", event)
+	}
+	eventType := pbutil.InspectorMsgReq_Event_FUNC_CALL
+	pbEvent := &pbutil.InspectorMsgReq_Event{
+		Type:     &eventType,
+		FuncCall: &pbutil.InspectorMsgReq_Event_FuncCall{Name: proto.String(functionName)},
+	}
+	if opt["function_event_type"] == "return" {
+		eventType = pbutil.InspectorMsgReq_Event_FUNC_RETURN
+		pbEvent.FuncCall = nil
+		pbEvent.FuncReturn = &pbutil.InspectorMsgReq_Event_FuncReturn{Name: proto.String(functionName)}
+	}
+
+	params, _ := opt["params"].(map[string]interface{})
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pbParams := make([]*pbutil.InspectorMsgReq_JavaSpecificFields_Params, 0, len(names))
+	for _, name := range names {
+		pbParams = append(pbParams, &pbutil.InspectorMsgReq_JavaSpecificFields_Params{
+			Name:  proto.String(name),
+			Value: proto.String(fmt.Sprintf("%v", params[name])),
+		})
+	}
+
+	reqType := pbutil.InspectorMsgReq_EVENT
+	return &pbutil.InspectorMsgReq{
+		EntityId:              proto.String(event.EntityID()),
+		Type:                  &reqType,
+		Pid:                   proto.Int32(int32(os.Getpid())),
+		Tid:                   proto.Int32(0),
+		MsgId:                 proto.Int32(msgID),
+		Event:                 pbEvent,
+		HasJavaSpecificFields: proto.Int32(1),
+		JavaSpecificFields: &pbutil.InspectorMsgReq_JavaSpecificFields{
+			ThreadName:           proto.String(""),
+			NrStackTraceElements: proto.Int32(0),
+			NrParams:             proto.Int32(int32(len(pbParams))),
+			Params:               pbParams,
+		},
+	}, nil
+}
+
+// transceiver for the ProtocolBuffers endpoint ("pbPort" in the config).
+//
+// orchestratorURL is like "pb://localhost:10000".
+// Note that the PB endpoint does not support fault actions, so the action is always EventAcceptanceAction.
+type PBTransceiver struct {
+	OrchestratorURL string
+	EntityID        string
+	conn            net.Conn
+	sendMutex       sync.Mutex
+	nextMsgID       int32
+	m               map[int32]chan Action // key: msg id
+	events          map[int32]Event       // key: msg id
+	mMutex          sync.Mutex
+	// set when the connection is lost (protected by mMutex)
+	connErr error
+}
+
+func NewPBTransceiver(orchestratorURL string, entityID string) (Transceiver, error) {
+	addr := strings.TrimPrefix(orchestratorURL, "pb://")
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	t := PBTransceiver{
+		OrchestratorURL: orchestratorURL,
+		EntityID:        entityID,
+		conn:            conn,
+		m:               make(map[int32]chan Action),
+		events:          make(map[int32]Event),
+		mMutex:          sync.Mutex{},
+	}
+	return &t, nil
+}
+
+func (this *PBTransceiver) SendEvent(event Event) (chan Action, error) {
+	if event.EntityID() != this.EntityID {
+		return nil, fmt.Errorf("bad entity id for event %s (want %s)", event, this.EntityID)
+	}
+	this.sendMutex.Lock()
+	defer this.sendMutex.Unlock()
+	msgID := this.nextMsgID
+	req, err := pbRequestMessage(event, msgID)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan Action)
+	this.mMutex.Lock()
+	if this.connErr != nil {
+		this.mMutex.Unlock()
+		return nil, this.connErr
+	}
+	// put ch to m BEFORE calling SendMsg(), otherwise race may occur
+	this.m[msgID] = ch
+	this.events[msgID] = event
+	this.mMutex.Unlock()
+	if err = pbutil.SendMsg(this.conn, req); err != nil {
+		this.mMutex.Lock()
+		delete(this.m, msgID)
+		delete(this.events, msgID)
+		this.mMutex.Unlock()
+		return nil, err
+	}
+	this.nextMsgID++
+	this.mMutex.Lock()
+	observeSentEvent(event, len(this.m))
+	this.mMutex.Unlock()
+	return ch, nil
+}
+
+func (this *PBTransceiver) onResponse(rsp *pbutil.InspectorMsgRsp) error {
+	if rsp.GetRes() != pbutil.InspectorMsgRsp_ACK {
+		return fmt.Errorf("unexpected response %s", rsp)
+	}
+	this.mMutex.Lock()
+	defer this.mMutex.Unlock()
+	actionChan, ok := this.m[rsp.GetMsgId()]
+	if !ok {
+		return fmt.Errorf("No channel found for response %s", rsp)
+	}
+	event := this.events[rsp.GetMsgId()]
+	delete(this.m, rsp.GetMsgId())
+	delete(this.events, rsp.GetMsgId())
+	action, err := NewEventAcceptanceAction(event)
+	if err != nil {
+		return err
+	}
+	observeReceivedAction(action, len(this.m))
+	go func() {
+		actionChan <- action
+	}()
+	return nil
+}
+
+func (this *PBTransceiver) routine() {
+	for {
+		rsp := &pbutil.InspectorMsgRsp{}
+		if err := pbutil.RecvMsg(this.conn, rsp); err != nil {
+			this.disconnect(fmt.Errorf("lost the connection to %s: %s", this.OrchestratorURL, err))
+			return
+		}
+		if err := this.onResponse(rsp); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// fails the pending and future SendEvent() calls with err
+func (this *PBTransceiver) disconnect(err error) {
+	log.Error(err)
+	this.conn.Close()
+	this.mMutex.Lock()
+	defer this.mMutex.Unlock()
+	this.connErr = err
+	for msgID, actionChan := range this.m {
+		close(actionChan)
+		delete(this.m, msgID)
+		delete(this.events, msgID)
+	}
+}
+
+func (this *PBTransceiver) Start() {
+	go this.routine()
+}
@@ -0,0 +1,105 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transceiver
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	pbep "github.com/osrg/namazu/nmz/endpoint/pb"
+	"github.com/osrg/namazu/nmz/signal"
+	"github.com/osrg/namazu/nmz/util/mockorchestrator"
+	pbutil "github.com/osrg/namazu/nmz/util/pb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPBRequestMessage(t *testing.T) {
+	event, err := signal.NewGoFunctionEvent("dummy", "raft.sendAppend", map[string]interface{}{"to": 2, "index": 42})
+	assert.NoError(t, err)
+	req, err := pbRequestMessage(event, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "dummy", req.GetEntityId())
+	assert.Equal(t, int32(3), req.GetMsgId())
+	assert.Equal(t, "raft.sendAppend", req.GetEvent().GetFuncCall().GetName())
+	params := req.GetJavaSpecificFields().GetParams()
+	assert.Len(t, params, 2)
+	assert.Equal(t, "index", params[0].GetName())
+	assert.Equal(t, "42", params[0].GetValue())
+
+	packetEvent, err := signal.NewPacketEvent("dummy", "dummy", "dummy", map[string]interface{}{})
+	assert.NoError(t, err)
+	_, err = pbRequestMessage(packetEvent, 4)
+	assert.Error(t, err)
+}
+
+func TestPBTransceiver(t *testing.T) {
+	ep := pbep.NewPBEndpoint()
+	actionCh := make(chan signal.Action)
+	eventCh := ep.Start(0, actionCh)
+	mockOrc := mockorchestrator.NewMockOrchestrator(eventCh, actionCh)
+	mockOrc.Start()
+	defer mockOrc.Shutdown()
+
+	trans, err := NewTransceiver(fmt.Sprintf("pb://localhost:%d", ep.ActualPort), "_dummy_pb_entity")
+	assert.NoError(t, err)
+	assert.IsType(t, &PBTransceiver{}, trans)
+	trans.Start()
+	for i := 0; i < 10; i++ {
+		event, err := signal.NewGoFunctionEvent("_dummy_pb_entity", fmt.Sprintf("func-%d", i), nil)
+		assert.NoError(t, err)
+		ch, err := trans.SendEvent(event)
+		assert.NoError(t, err)
+		action := <-ch
+		assert.IsType(t, &signal.EventAcceptanceAction{}, action)
+		assert.Equal(t, event.ID(), action.Event().ID())
+	}
+
+	event, err := signal.NewGoFunctionEvent("_another_entity", "func", nil)
+	assert.NoError(t, err)
+	_, err = trans.SendEvent(event)
+	assert.Error(t, err)
+}
+
+func TestPBTransceiverDisconnected(t *testing.T) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		// the orchestrator goes away without responding to the first event
+		pbutil.RecvMsg(conn, &pbutil.InspectorMsgReq{})
+		conn.Close()
+	}()
+
+	trans, err := NewTransceiver("pb://"+ln.Addr().String(), "_dummy_pb_entity")
+	assert.NoError(t, err)
+	trans.Start()
+	event, err := signal.NewGoFunctionEvent("_dummy_pb_entity", "func", nil)
+	assert.NoError(t, err)
+	ch, err := trans.SendEvent(event)
+	assert.NoError(t, err)
+	_, ok := <-ch
+	assert.False(t, ok, "pending channel should be closed")
+
+	event, err = signal.NewGoFunctionEvent("_dummy_pb_entity", "func", nil)
+	assert.NoError(t, err)
+	_, err = trans.SendEvent(event)
+	assert.Error(t, err)
+}
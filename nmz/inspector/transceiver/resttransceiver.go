@@ -132,9 +132,29 @@ func (this *RESTTransceiver) SendEvent(event Event) (chan Action, error) {
 		this.mMutex.Unlock()
 		return nil, err
 	}
+	this.mMutex.Lock()
+	observeSentEvent(event, len(this.m))
+	this.mMutex.Unlock()
 	return ch, nil
 }
 
+// implements Notifier
+func (this *RESTTransceiver) Notify(event Event) error {
+	if event.EntityID() != this.EntityID {
+		return fmt.Errorf("bad entity id for event %s (want %s)", event, this.EntityID)
+	}
+	if event.Deferred() {
+		return fmt.Errorf("Notify() is not for a deferred event %s", event)
+	}
+	if err := sendEvent(this.Client, this.OrchestratorURL, event); err != nil {
+		return err
+	}
+	this.mMutex.Lock()
+	observeSentEvent(event, len(this.m))
+	this.mMutex.Unlock()
+	return nil
+}
+
 func (this *RESTTransceiver) onAction(action Action) error {
 	event := action.Event()
 	if event == nil {
@@ -147,6 +167,7 @@ func (this *RESTTransceiver) onAction(action Action) error {
 		return fmt.Errorf("No channel found for action %s (event id=%s)", action, event.ID())
 	}
 	delete(this.m, event.ID())
+	observeReceivedAction(action, len(this.m))
 	// Namazu doesn't guarantee any determinism,
 	// but can we make this more deterministic?
 	go func() {
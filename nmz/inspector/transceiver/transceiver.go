@@ -24,11 +24,19 @@ import (
 )
 
 type Transceiver interface {
+	// the returned channel is closed without any action if the transceiver loses the connection
 	SendEvent(event signal.Event) (chan signal.Action, error)
 	Start()
 	// TODO: there should be also "Shutdown()" (especially for testing)
 }
 
+// Sends non-deferred events (e.g. LogEvent), for which no action is sent back.
+//
+// implemented by the local and REST transceivers
+type Notifier interface {
+	Notify(event signal.Event) error
+}
+
 func NewTransceiver(orchestratorURL string, entityID string) (Transceiver, error) {
 	if strings.HasPrefix(orchestratorURL, "local://") {
 		if entityID != "" {
@@ -37,6 +45,8 @@ func NewTransceiver(orchestratorURL string, entityID string) (Transceiver, error
 		return &SingletonLocalTransceiver, nil
 	} else if strings.HasPrefix(orchestratorURL, "http://") {
 		return NewRESTTransceiver(orchestratorURL, entityID)
+	} else if strings.HasPrefix(orchestratorURL, "pb://") {
+		return NewPBTransceiver(orchestratorURL, entityID)
 	} else {
 		return nil, fmt.Errorf("strange orchestrator url: %s", orchestratorURL)
 	}
@@ -0,0 +1,56 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orchestrator
+
+import (
+	"runtime"
+
+	. "github.com/osrg/namazu/nmz/signal"
+	"github.com/osrg/namazu/nmz/util/metrics"
+	signalutil "github.com/osrg/namazu/nmz/util/signal"
+)
+
+var (
+	eventsTotal = metrics.NewCounterVec("nmz_events_total",
+		"Number of events received by the orchestrator.", "class", "entity")
+	actionsTotal = metrics.NewCounterVec("nmz_actions_total",
+		"Number of actions triggered by the orchestrator.", "class", "entity")
+	faultsTotal = metrics.NewCounterVec("nmz_faults_total",
+		"Number of fault actions triggered by the orchestrator.", "class", "entity")
+	actionLatency = metrics.NewHistogram("nmz_action_latency_seconds",
+		"Time from the arrival of an event to the triggering of its action.", metrics.DefaultLatencyBuckets)
+)
+
+func init() {
+	metrics.NewGaugeFunc("nmz_goroutines", "Number of goroutines.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+}
+
+func observeEvent(event Event) {
+	eventsTotal.Inc(signalutil.EventClass(event), event.EntityID())
+}
+
+func observeAction(action Action) {
+	class := signalutil.ActionClass(action)
+	actionsTotal.Inc(class, action.EntityID())
+	if signalutil.IsFaultAction(action) {
+		faultsTotal.Inc(class, action.EntityID())
+	}
+	if event := action.Event(); event != nil {
+		actionLatency.Observe(action.TriggeredTime().Sub(event.ArrivedTime()).Seconds())
+	}
+}
@@ -23,7 +23,11 @@
 package orchestrator
 
 import (
+	"fmt"
 	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	log "github.com/cihub/seelog"
@@ -44,11 +48,18 @@ type Orchestrator struct {
 	collectTrace bool
 	// action sequence (can be so large)
 	actionSequence []Action
+	// deferred events that are not handled by any action yet (key: event UUID)
+	pendingEvents   map[string]Event
+	pendingEventsMu sync.Mutex
+	// last maxRecentActions actions (for inspection via controlCh)
+	recentActions   []Action
+	recentActionsMu sync.Mutex
 	// communication channels
 	endpointEventCh    chan Event
 	endpointActionCh   chan Action
 	policyActionCh     chan Action
 	dumbPolicyActionCh chan Action
+	forcedActionCh     chan Action
 	controlCh          chan Control
 	// orchestrator control channels
 	stopEventRCh     chan struct{}
@@ -63,14 +74,17 @@ func NewOrchestrator(cfg Config, policy ExplorePolicy, collectTrace bool) *Orche
 	orc := Orchestrator{
 		cfg:            cfg,
 		policy:         policy,
-		dumbPolicy:     dumb.New(),
+		dumbPolicy:     dumb.NewWithQueueOwner("orchestrator-disabled"),
 		collectTrace:   collectTrace,
 		actionSequence: make([]Action, 0),
+		pendingEvents:  make(map[string]Event),
+		recentActions:  make([]Action, 0),
 		// endpoint makes this
 		endpointEventCh:  nil,
 		endpointActionCh: make(chan Action),
 		// policy makes this
 		policyActionCh:   nil,
+		forcedActionCh:   make(chan Action),
 		stopEventRCh:     make(chan struct{}),
 		stoppedEventRCh:  make(chan struct{}),
 		stopActionRCh:    make(chan struct{}),
@@ -81,7 +95,16 @@ func NewOrchestrator(cfg Config, policy ExplorePolicy, collectTrace bool) *Orche
 	return &orc
 }
 
+// the number of actions kept for ControlGetRecentActions
+const maxRecentActions = 128
+
 func (orc *Orchestrator) handleEvent(event Event) {
+	observeEvent(event)
+	if event.Deferred() {
+		orc.pendingEventsMu.Lock()
+		orc.pendingEvents[event.ID()] = event
+		orc.pendingEventsMu.Unlock()
+	}
 	if orc.enabled {
 		log.Debugf("Orchestrator handling event %s", event)
 		orc.policy.QueueEvent(event)
@@ -93,8 +116,41 @@ func (orc *Orchestrator) handleEvent(event Event) {
 	}
 }
 
+// removes the event of the action from pendingEvents.
+// returns false if the event is deferred but no longer pending (e.g. forcibly released via controlCh).
+func (orc *Orchestrator) resolvePendingEvent(action Action) bool {
+	event := action.Event()
+	if event == nil || !event.Deferred() {
+		return true
+	}
+	orc.pendingEventsMu.Lock()
+	defer orc.pendingEventsMu.Unlock()
+	if _, ok := orc.pendingEvents[event.ID()]; !ok {
+		return false
+	}
+	delete(orc.pendingEvents, event.ID())
+	return true
+}
+
+func (orc *Orchestrator) recordRecentAction(action Action) {
+	orc.recentActionsMu.Lock()
+	orc.recentActions = append(orc.recentActions, action)
+	if len(orc.recentActions) > maxRecentActions {
+		orc.recentActions = orc.recentActions[len(orc.recentActions)-maxRecentActions:]
+	}
+	orc.recentActionsMu.Unlock()
+}
+
 func (orc *Orchestrator) handleAction(action Action) {
 	log.Debugf("Orchestrator handling action %s", action)
+	if !orc.resolvePendingEvent(action) {
+		log.Warnf("Orchestrator ignoring action %s, as its event has been already handled", action)
+		return
+	}
+	orc.executeAction(action)
+}
+
+func (orc *Orchestrator) executeAction(action Action) {
 	var err error
 	orcSideOnly := false
 	orcSide, orcSideOk := action.(OrchestratorSideAction)
@@ -117,6 +173,8 @@ func (orc *Orchestrator) handleAction(action Action) {
 	if orc.collectTrace {
 		orc.actionSequence = append(orc.actionSequence, action)
 	}
+	orc.recordRecentAction(action)
+	observeAction(action)
 	log.Debugf("Orchestrator handled action %s", action)
 }
 
@@ -172,6 +230,9 @@ func (orc *Orchestrator) actionRoutine() {
 			} else {
 				orc.dumbPolicyActionCh = nil
 			}
+		case action := <-orc.forcedActionCh:
+			// the event has been already removed from pendingEvents by forceEvent()
+			orc.executeAction(action)
 		case <-orc.stopActionRCh:
 			return
 		}
@@ -182,26 +243,161 @@ func (orc *Orchestrator) controlRoutine() {
 	for {
 		select {
 		case control := <-orc.controlCh:
-			switch control.Op {
-			case ControlEnableOrchestration:
-				if orc.enabled {
-					log.Warnf("orchestrator is already enabled")
-				}
-				orc.enabled = true
-				log.Infof("enabled orchestration")
-			case ControlDisableOrchestration:
-				if !orc.enabled {
-					log.Warnf("orchestrator is already disabled")
-				}
-				orc.enabled = false
-				log.Infof("disabled orchestration")
-			default:
-				log.Errorf("unkonown opcode of control: %d", control.Op)
+			result := orc.handleControl(control)
+			if result.Err != nil {
+				log.Errorf("control %d failed: %s", control.Op, result.Err)
+			}
+			if control.ResultCh != nil {
+				control.ResultCh <- result
 			}
 		}
 	}
 }
 
+func (orc *Orchestrator) handleControl(control Control) ControlResult {
+	switch control.Op {
+	case ControlEnableOrchestration:
+		if orc.enabled {
+			log.Warnf("orchestrator is already enabled")
+		}
+		orc.enabled = true
+		log.Infof("enabled orchestration")
+	case ControlDisableOrchestration:
+		if !orc.enabled {
+			log.Warnf("orchestrator is already disabled")
+		}
+		orc.enabled = false
+		log.Infof("disabled orchestration")
+	case ControlGetPendingEvents:
+		return ControlResult{Value: orc.pendingEventsPerEntity()}
+	case ControlGetRecentActions:
+		orc.recentActionsMu.Lock()
+		actions := make([]map[string]interface{}, 0, len(orc.recentActions))
+		for _, action := range orc.recentActions {
+			actions = append(actions, action.JSONMap())
+		}
+		orc.recentActionsMu.Unlock()
+		return ControlResult{Value: actions}
+	case ControlGetEntities:
+		return ControlResult{Value: endpoint.EntityEndpointTypes()}
+	case ControlGetPolicyConfig:
+		return ControlResult{Value: orc.policyConfig()}
+	case ControlReleaseEvent, ControlFaultEvent:
+		action, err := orc.forceEvent(control.Op, control.Arg)
+		if err != nil {
+			return ControlResult{Err: err}
+		}
+		return ControlResult{Value: action.JSONMap()}
+	case ControlReloadPolicyConfig:
+		param, ok := control.Arg.(map[string]interface{})
+		if !ok {
+			return ControlResult{Err: ControlArgError{Err: fmt.Errorf("bad explorePolicyParam %#v", control.Arg)}}
+		}
+		// the policies lock their parameters in LoadConfig(), so it can be called while they are running
+		orc.cfg.Set("explorePolicyParam", orc.mergePolicyParam(param))
+		if err := orc.policy.LoadConfig(orc.cfg); err != nil {
+			return ControlResult{Err: ControlArgError{Err: err}}
+		}
+		log.Infof("reloaded explorePolicyParam: %#v", param)
+		return ControlResult{Value: orc.policyConfig()}
+	default:
+		return ControlResult{Err: fmt.Errorf("unknown opcode of control: %d", control.Op)}
+	}
+	return ControlResult{}
+}
+
+func (orc *Orchestrator) pendingEventsPerEntity() map[string][]map[string]interface{} {
+	orc.pendingEventsMu.Lock()
+	events := make([]Event, 0, len(orc.pendingEvents))
+	for _, event := range orc.pendingEvents {
+		events = append(events, event)
+	}
+	orc.pendingEventsMu.Unlock()
+	sort.Sort(eventsByArrivedTime(events))
+	m := make(map[string][]map[string]interface{})
+	for _, event := range events {
+		m[event.EntityID()] = append(m[event.EntityID()], event.JSONMap())
+	}
+	return m
+}
+
+// returns the current explorePolicyParam updated with param.
+// the keys are lower-cased, as the config keys are case-insensitive.
+func (orc *Orchestrator) mergePolicyParam(param map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{})
+	for k, v := range orc.cfg.GetStringMap("explorePolicyParam") {
+		merged[strings.ToLower(k)] = v
+	}
+	for k, v := range param {
+		merged[strings.ToLower(k)] = v
+	}
+	return merged
+}
+
+func (orc *Orchestrator) policyConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"explorePolicy":      orc.policy.Name(),
+		"explorePolicyParam": orc.cfg.Get("explorePolicyParam"),
+	}
+}
+
+// Determines the action for a pending event regardless of the policy.
+// The action which the policy determines later will be ignored.
+func (orc *Orchestrator) forceEvent(op int, arg interface{}) (Action, error) {
+	eventID, ok := arg.(string)
+	if !ok {
+		return nil, ControlArgError{Err: fmt.Errorf("bad event UUID %#v", arg)}
+	}
+	// claimed here, so that the action of the policy is ignored even if it is handled before the forced one
+	orc.pendingEventsMu.Lock()
+	event, ok := orc.pendingEvents[eventID]
+	delete(orc.pendingEvents, eventID)
+	orc.pendingEventsMu.Unlock()
+	if !ok {
+		return nil, ControlNotFoundError{Err: fmt.Errorf("no pending event %s", eventID)}
+	}
+	action, err := orc.forcedAction(op, event)
+	if err != nil {
+		// not claimed
+		orc.pendingEventsMu.Lock()
+		orc.pendingEvents[eventID] = event
+		orc.pendingEventsMu.Unlock()
+		return nil, err
+	}
+	log.Infof("forcibly determined action %s for event %s", action, event)
+	if h, ok := orc.policy.(ForcedEventHandler); ok {
+		h.EventForced(event)
+	}
+	select {
+	case orc.forcedActionCh <- action:
+	case <-orc.stoppedActionRCh:
+		return nil, fmt.Errorf("orchestrator is shutting down")
+	}
+	return action, nil
+}
+
+func (orc *Orchestrator) forcedAction(op int, event Event) (Action, error) {
+	var action Action
+	var err error
+	if op == ControlFaultEvent {
+		action, err = event.DefaultFaultAction()
+		if err == nil && action == nil {
+			err = ControlArgError{Err: fmt.Errorf("event %s has no fault action", event.ID())}
+		}
+	} else {
+		action, err = event.DefaultAction()
+	}
+	return action, err
+}
+
+type eventsByArrivedTime []Event
+
+func (s eventsByArrivedTime) Len() int      { return len(s) }
+func (s eventsByArrivedTime) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s eventsByArrivedTime) Less(i, j int) bool {
+	return s[i].ArrivedTime().Before(s[j].ArrivedTime())
+}
+
 // Stops the orchestrator routine.
 // Returns action trace if configured to do so.
 func (orc *Orchestrator) Shutdown() *SingleTrace {
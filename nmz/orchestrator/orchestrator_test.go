@@ -25,6 +25,9 @@ import (
 
 	localep "github.com/osrg/namazu/nmz/endpoint/local"
 	"github.com/osrg/namazu/nmz/explorepolicy"
+	"github.com/osrg/namazu/nmz/explorepolicy/dumb"
+	"github.com/osrg/namazu/nmz/explorepolicy/manual"
+	"github.com/osrg/namazu/nmz/explorepolicy/random"
 	"github.com/osrg/namazu/nmz/signal"
 	"github.com/osrg/namazu/nmz/util/config"
 	logutil "github.com/osrg/namazu/nmz/util/log"
@@ -169,3 +172,107 @@ func testOrchestratorWithPacketEvent(t *testing.T, n, entities int, concurrent b
 		}
 	}
 }
+
+func TestOrchestratorControlReleaseEvent(t *testing.T) {
+	// dumb policy with long interval, so that events remain pending
+	cfg, err := config.NewFromString("{\"explorePolicy\":\"dumb\", \"explorePolicyParam\":{\"interval\":\"1h\"}}", "json")
+	assert.NoError(t, err)
+	policy, err := explorepolicy.CreatePolicy(cfg.GetString("explorePolicy"))
+	assert.NoError(t, err)
+	assert.NoError(t, policy.LoadConfig(cfg))
+	oc := NewOrchestrator(cfg, policy, true)
+	oc.Start()
+	ep := localep.SingletonLocalEndpoint
+
+	event := testutil.NewPacketEvent(t, "entity-0", 0)
+	ep.InspectorEventCh <- event
+	var pending map[string][]map[string]interface{}
+	for i := 0; i < 100 && len(pending) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		result := oc.handleControl(signal.Control{Op: signal.ControlGetPendingEvents})
+		assert.NoError(t, result.Err)
+		pending = result.Value.(map[string][]map[string]interface{})
+	}
+	assert.Len(t, pending["entity-0"], 1)
+
+	result := oc.handleControl(signal.Control{Op: signal.ControlFaultEvent, Arg: event.ID()})
+	assert.NoError(t, result.Err)
+	action := <-ep.InspectorActionCh
+	assert.IsType(t, &signal.PacketFaultAction{}, action)
+	assert.Equal(t, event.ID(), action.Event().ID())
+	// the late action of the policy is ignored
+	policyAction, err := event.DefaultAction()
+	assert.NoError(t, err)
+	oc.handleAction(policyAction)
+
+	// the event is no longer pending
+	result = oc.handleControl(signal.Control{Op: signal.ControlReleaseEvent, Arg: event.ID()})
+	assert.Error(t, result.Err)
+	result = oc.handleControl(signal.Control{Op: signal.ControlGetPendingEvents})
+	assert.Empty(t, result.Value)
+	result = oc.handleControl(signal.Control{Op: signal.ControlGetRecentActions})
+	assert.Len(t, result.Value, 1)
+
+	result = oc.handleControl(signal.Control{Op: signal.ControlReloadPolicyConfig,
+		Arg: map[string]interface{}{"interval": "10ms"}})
+	assert.NoError(t, result.Err)
+	assert.Equal(t, 10*time.Millisecond, policy.(*dumb.Dumb).Interval)
+
+	trace := oc.Shutdown()
+	assert.Equal(t, 1, len(trace.ActionSequence))
+}
+
+func TestOrchestratorControlReloadPolicyConfigMerges(t *testing.T) {
+	cfg, err := config.NewFromString(`{"explorePolicy":"random",
+"explorePolicyParam":{"minInterval":"10ms", "maxInterval":"30ms", "prioritizedEntities":["foo", "bar"]}}`, "json")
+	assert.NoError(t, err)
+	policy, err := explorepolicy.CreatePolicy(cfg.GetString("explorePolicy"))
+	assert.NoError(t, err)
+	assert.NoError(t, policy.LoadConfig(cfg))
+	oc := NewOrchestrator(cfg, policy, false)
+	r := policy.(*random.Random)
+
+	result := oc.handleControl(signal.Control{Op: signal.ControlReloadPolicyConfig,
+		Arg: map[string]interface{}{"faultActionProbability": 0.5}})
+	assert.NoError(t, result.Err)
+	assert.Equal(t, 0.5, r.FaultActionProbability)
+	assert.Equal(t, 10*time.Millisecond, r.MinInterval)
+	assert.Equal(t, 30*time.Millisecond, r.MaxInterval)
+	assert.Equal(t, map[string]bool{"foo": true, "bar": true}, r.PrioritizedEntities)
+	param := result.Value.(map[string]interface{})["explorePolicyParam"].(map[string]interface{})
+	assert.Equal(t, "30ms", param["maxinterval"])
+	assert.Equal(t, 0.5, param["faultactionprobability"])
+
+	result = oc.handleControl(signal.Control{Op: signal.ControlReloadPolicyConfig,
+		Arg: map[string]interface{}{"prioritizedEntities": []interface{}{"baz"}}})
+	assert.NoError(t, result.Err)
+	assert.Equal(t, map[string]bool{"baz": true}, r.PrioritizedEntities)
+	assert.Equal(t, 0.5, r.FaultActionProbability)
+}
+
+func TestOrchestratorControlReleaseEventDroppedFromManualPolicy(t *testing.T) {
+	cfg, err := config.NewFromString("{\"explorePolicy\":\"manual\"}", "json")
+	assert.NoError(t, err)
+	policy := manual.New()
+	oc := NewOrchestrator(cfg, policy, true)
+	oc.Start()
+	ep := localep.SingletonLocalEndpoint
+
+	event := testutil.NewPacketEvent(t, "entity-0", 0)
+	ep.InspectorEventCh <- event
+	for i := 0; i < 100 && len(policy.PendingEvents()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Len(t, policy.PendingEvents(), 1)
+
+	result := oc.handleControl(signal.Control{Op: signal.ControlReleaseEvent, Arg: event.ID()})
+	assert.NoError(t, result.Err)
+	action := <-ep.InspectorActionCh
+	assert.Equal(t, event.ID(), action.Event().ID())
+	assert.Empty(t, policy.PendingEvents())
+	_, err = policy.Release(event.ID())
+	assert.Error(t, err)
+
+	trace := oc.Shutdown()
+	assert.Equal(t, 1, len(trace.ActionSequence))
+}
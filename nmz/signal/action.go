@@ -43,6 +43,11 @@ func (this *BasicAction) SetTriggeredTime(triggeredTime time.Time) {
 	this.Triggered = triggeredTime
 }
 
+// sets the cause event (e.g. when loading a trace)
+func (this *BasicAction) SetEvent(event Event) {
+	this.CauseEvent = event
+}
+
 // implements Action
 //
 // if only event_uuid is known, return a dummy empty event (NopEvent).
@@ -0,0 +1,100 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+func initFailpointAction(action *BasicAction, class string, event Event) error {
+	action.InitSignal()
+	if !event.Deferred() {
+		return fmt.Errorf("cannot instantiate %s for a non-deferred event %#v", class, event)
+	}
+	fpEvent, isFailpointEvent := event.(*FailpointEvent)
+	if !isFailpointEvent {
+		return fmt.Errorf("event %s is not FailpointEvent", event)
+	}
+	action.SetID(uuid.NewV4().String())
+	action.SetEntityID(event.EntityID())
+	action.SetType("action")
+	action.SetClass(class)
+	action.Set("event_uuid", event.ID())
+	action.SetOption(map[string]interface{}{
+		"failpoint": fpEvent.Failpoint(),
+	})
+	action.CauseEvent = event
+	return nil
+}
+
+// implements Action
+//
+// the failpoint returns an error
+type FailpointErrorAction struct {
+	BasicAction
+}
+
+func NewFailpointErrorAction(event Event) (Action, error) {
+	action := &FailpointErrorAction{}
+	if err := initFailpointAction(&action.BasicAction, "FailpointErrorAction", event); err != nil {
+		return nil, err
+	}
+	return action, nil
+}
+
+// implements Action
+//
+// the failpoint panics
+type FailpointPanicAction struct {
+	BasicAction
+}
+
+func NewFailpointPanicAction(event Event) (Action, error) {
+	action := &FailpointPanicAction{}
+	if err := initFailpointAction(&action.BasicAction, "FailpointPanicAction", event); err != nil {
+		return nil, err
+	}
+	return action, nil
+}
+
+// implements Action
+//
+// the failpoint sleeps for the duration, and then continues
+type FailpointSleepAction struct {
+	BasicAction
+}
+
+func NewFailpointSleepAction(event Event, duration time.Duration) (Action, error) {
+	action := &FailpointSleepAction{}
+	if err := initFailpointAction(&action.BasicAction, "FailpointSleepAction", event); err != nil {
+		return nil, err
+	}
+	// string, so that the duration survives JSON
+	action.Option()["duration"] = duration.String()
+	return action, nil
+}
+
+// Returns the sleep duration
+func (this *FailpointSleepAction) Duration() (time.Duration, error) {
+	s, ok := this.Option()["duration"].(string)
+	if !ok {
+		return 0, fmt.Errorf("no duration in %s", this)
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,117 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// the fault terms a failpoint can take (besides continuing, i.e. EventAcceptanceAction)
+const (
+	FailpointTermError = "error"
+	FailpointTermPanic = "panic"
+	FailpointTermSleep = "sleep"
+)
+
+// the sleep duration of DefaultFaultAction() for a failpoint that can take only FailpointTermSleep
+const DefaultFailpointSleep = time.Second
+
+// implements Event
+//
+// made when a named failpoint (gofail/failpoint style) in a Go testee is evaluated.
+// the orchestrator decides whether the failpoint continues, returns an error, panics, or sleeps.
+type FailpointEvent struct {
+	BasicEvent
+}
+
+// terms: the fault terms the failpoint can take (e.g. FailpointTermError). if empty, only FailpointTermError.
+func NewFailpointEvent(entityID string, name string, terms []string) (Event, error) {
+	if len(terms) == 0 {
+		terms = []string{FailpointTermError}
+	}
+	for _, term := range terms {
+		switch term {
+		case FailpointTermError, FailpointTermPanic, FailpointTermSleep:
+		default:
+			return nil, fmt.Errorf("unknown failpoint term %q", term)
+		}
+	}
+	event := &FailpointEvent{}
+	event.InitSignal()
+	event.SetID(uuid.NewV4().String())
+	event.SetEntityID(entityID)
+	event.SetType("event")
+	event.SetClass("FailpointEvent")
+	event.SetDeferred(true)
+	event.SetReplayHint(name)
+	event.SetOption(map[string]interface{}{
+		"failpoint": name,
+		"terms":     terms,
+	})
+	return event, nil
+}
+
+// Returns the name of the failpoint
+func (this *FailpointEvent) Failpoint() string {
+	name, _ := this.Option()["failpoint"].(string)
+	return name
+}
+
+// Returns the fault terms the failpoint can take
+func (this *FailpointEvent) Terms() []string {
+	switch terms := this.Option()["terms"].(type) {
+	case []string:
+		return terms
+	case []interface{}:
+		// decoded from JSON
+		s := make([]string, 0, len(terms))
+		for _, term := range terms {
+			if str, ok := term.(string); ok {
+				s = append(s, str)
+			}
+		}
+		return s
+	}
+	return nil
+}
+
+// Returns the fault action for the term.
+// sleep is used only for FailpointTermSleep.
+func (this *FailpointEvent) FaultAction(term string, sleep time.Duration) (Action, error) {
+	switch term {
+	case FailpointTermError:
+		return NewFailpointErrorAction(this)
+	case FailpointTermPanic:
+		return NewFailpointPanicAction(this)
+	case FailpointTermSleep:
+		return NewFailpointSleepAction(this, sleep)
+	}
+	return nil, fmt.Errorf("unknown failpoint term %q", term)
+}
+
+// implements Event
+//
+// returns the fault action for the first term
+func (this *FailpointEvent) DefaultFaultAction() (Action, error) {
+	terms := this.Terms()
+	if len(terms) == 0 {
+		return NewFailpointErrorAction(this)
+	}
+	return this.FaultAction(terms[0], DefaultFailpointSleep)
+}
@@ -0,0 +1,106 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFailpointEvent(t *testing.T) {
+	event, err := NewFailpointEvent("foo", "raftBeforeSave",
+		[]string{FailpointTermSleep, FailpointTermError, FailpointTermPanic})
+	assert.NoError(t, err)
+	fpEvent := event.(*FailpointEvent)
+	assert.Equal(t, "raftBeforeSave", fpEvent.Failpoint())
+	assert.Equal(t, "raftBeforeSave", event.ReplayHint())
+	assert.Equal(t, []string{"sleep", "error", "panic"}, fpEvent.Terms())
+
+	action := testDeferredEventDefaultAction(t, event)
+	assert.IsType(t, &EventAcceptanceAction{}, action)
+	testGOBAction(t, action, event)
+
+	faultAction := testDeferredEventDefaultFaultAction(t, event)
+	assert.IsType(t, &FailpointSleepAction{}, faultAction)
+	duration, err := faultAction.(*FailpointSleepAction).Duration()
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultFailpointSleep, duration)
+	testGOBAction(t, faultAction, event)
+
+	errorAction, err := fpEvent.FaultAction(FailpointTermError, 0)
+	assert.NoError(t, err)
+	assert.IsType(t, &FailpointErrorAction{}, errorAction)
+	assert.Equal(t, "raftBeforeSave", errorAction.JSONMap()["option"].(map[string]interface{})["failpoint"])
+	panicAction, err := fpEvent.FaultAction(FailpointTermPanic, 0)
+	assert.NoError(t, err)
+	assert.IsType(t, &FailpointPanicAction{}, panicAction)
+	_, err = fpEvent.FaultAction("off", 0)
+	assert.Error(t, err)
+
+	_, err = NewFailpointEvent("foo", "raftBeforeSave", []string{"return(1)"})
+	assert.Error(t, err)
+
+	event, err = NewFailpointEvent("foo", "raftBeforeSave", nil)
+	assert.NoError(t, err)
+	faultAction = testDeferredEventDefaultFaultAction(t, event)
+	assert.IsType(t, &FailpointErrorAction{}, faultAction)
+}
+
+func TestNewFailpointEventFromJSONString(t *testing.T) {
+	s := `
+{
+    "type": "event",
+    "class": "FailpointEvent",
+    "entity": "foo",
+    "uuid": "0d4e2f7a-3a41-4b6e-8a34-1f0f9f2c6e11",
+    "deferred": true,
+    "option": {
+        "failpoint": "raftBeforeSave",
+        "terms": ["panic", "sleep"]
+    }
+}`
+	signal, err := NewSignalFromJSONString(s, time.Now())
+	assert.NoError(t, err)
+	event, ok := signal.(*FailpointEvent)
+	assert.True(t, ok, "%#v", signal)
+	assert.Equal(t, []string{"panic", "sleep"}, event.Terms())
+	faultAction := testDeferredEventDefaultFaultAction(t, event)
+	assert.IsType(t, &FailpointPanicAction{}, faultAction)
+}
+
+func TestNewFailpointSleepActionFromJSONString(t *testing.T) {
+	s := `
+{
+    "type": "action",
+    "class": "FailpointSleepAction",
+    "entity": "foo",
+    "uuid": "5b0c8d7e-1c2f-4a7d-9e3b-2f6a8c4d1e90",
+    "event_uuid": "0d4e2f7a-3a41-4b6e-8a34-1f0f9f2c6e11",
+    "option": {
+        "failpoint": "raftBeforeSave",
+        "duration": "250ms"
+    }
+}`
+	signal, err := NewSignalFromJSONString(s, time.Now())
+	assert.NoError(t, err)
+	action, ok := signal.(*FailpointSleepAction)
+	assert.True(t, ok, "%#v", signal)
+	duration, err := action.Duration()
+	assert.NoError(t, err)
+	assert.Equal(t, 250*time.Millisecond, duration)
+}
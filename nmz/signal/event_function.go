@@ -127,3 +127,33 @@ func NewJavaFunctionEventFromPB(msg pb.InspectorMsgReq, arrivedTime time.Time) (
 	event.SetOption(opt)
 	return &event, nil
 }
+
+// implements Event
+//
+// made by the inspector library for Go testees (nmz/inspector/go/nmz)
+type GoFunctionEvent struct {
+	BasicEvent
+}
+
+// params should be serializable to JSON (e.g. string, numbers, bool)
+func NewGoFunctionEvent(entityID string, functionName string, params map[string]interface{}) (Event, error) {
+	event := &GoFunctionEvent{}
+	event.InitSignal()
+	event.SetID(uuid.NewV4().String())
+	event.SetEntityID(entityID)
+	event.SetType("event")
+	event.SetClass("GoFunctionEvent")
+	event.SetDeferred(true)
+	// the function name is deterministic, while the params are not always
+	event.SetReplayHint(functionName)
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	opt := map[string]interface{}{
+		"function_name":       functionName,
+		"function_event_type": "call",
+		"params":              params,
+	}
+	event.SetOption(opt)
+	return event, nil
+}
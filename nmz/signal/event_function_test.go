@@ -105,3 +105,44 @@ func TestNewJavaFunctionEventFromPB2(t *testing.T) {
 	assert.NotNil(t, pbRspMsg, "pbRspMsg should not be nil, action=%#v", action)
 	t.Logf("pbRspMsg: %s", pbRspMsg)
 }
+
+func TestNewGoFunctionEvent(t *testing.T) {
+	event, err := NewGoFunctionEvent("dummy3", "raft.sendAppend", map[string]interface{}{"to": 2})
+	assert.NoError(t, err)
+	assert.IsType(t, &GoFunctionEvent{}, event)
+	assert.Equal(t, "dummy3", event.EntityID())
+	assert.Equal(t, "raft.sendAppend", event.ReplayHint())
+	opt := event.JSONMap()["option"].(map[string]interface{})
+	assert.Equal(t, "raft.sendAppend", opt["function_name"])
+	assert.Equal(t, "call", opt["function_event_type"])
+	assert.Equal(t, 2, opt["params"].(map[string]interface{})["to"])
+
+	action := testDeferredEventDefaultAction(t, event)
+	assert.IsType(t, &EventAcceptanceAction{}, action)
+	testGOBAction(t, action, event)
+	faultAction, err := event.DefaultFaultAction()
+	assert.NoError(t, err)
+	assert.Nil(t, faultAction)
+}
+
+func TestNewGoFunctionEventFromJSONString(t *testing.T) {
+	s := `
+{
+    "type": "event",
+    "class": "GoFunctionEvent",
+    "entity": "dummy4",
+    "uuid": "9f4e6c8a-6b6a-4f0e-9a2e-4f5a7c2d0b1e",
+    "deferred": true,
+    "option": {
+        "function_name": "raft.sendAppend",
+        "function_event_type": "call",
+        "params": {"to": 2}
+    }
+}`
+	signal, err := NewSignalFromJSONString(s, time.Now())
+	assert.NoError(t, err)
+	event, ok := signal.(*GoFunctionEvent)
+	assert.True(t, ok, "%#v", signal)
+	assert.Equal(t, "dummy4", event.EntityID())
+	testDeferredEventDefaultAction(t, event)
+}
@@ -15,9 +15,32 @@
 
 package signal
 
+import "github.com/satori/go.uuid"
+
 // implements Event
+//
+// not deferred (DefaultAction() is NopAction, executed only on the orchestrator side)
 type LogEvent struct {
 	BasicEvent
 }
 
-// TODO: NewLogEvent()
+// message: the log line
+//
+// m: arbitrary options (e.g. the captured groups of the regexp)
+func NewLogEvent(entityID string, message string, m map[string]interface{}) (Event, error) {
+	event := &LogEvent{}
+	event.InitSignal()
+	event.SetID(uuid.NewV4().String())
+	event.SetEntityID(entityID)
+	event.SetType("event")
+	event.SetClass("LogEvent")
+	event.SetDeferred(false)
+	opt := map[string]interface{}{
+		"message": message,
+	}
+	for k, v := range m {
+		opt[k] = v
+	}
+	event.SetOption(opt)
+	return event, nil
+}
@@ -54,3 +54,21 @@ func TestNewLogEventFromJSONString(t *testing.T) {
 	testNonDeferredEventDefaultAction(t, logEvent)
 	testNonDeferredEventDefaultFaultAction(t, logEvent)
 }
+
+func TestNewLogEvent(t *testing.T) {
+	event, err := NewLogEvent("foo", "became leader at term 3", map[string]interface{}{
+		"rule": "leader",
+		"term": "3",
+	})
+	assert.NoError(t, err)
+	assert.IsType(t, &LogEvent{}, event)
+	assert.Equal(t, "foo", event.EntityID())
+	assert.False(t, event.Deferred())
+	assert.Equal(t, map[string]interface{}{
+		"message": "became leader at term 3",
+		"rule":    "leader",
+		"term":    "3",
+	}, event.JSONMap()["option"])
+	testNonDeferredEventDefaultAction(t, event)
+	testNonDeferredEventDefaultFaultAction(t, event)
+}
@@ -63,10 +63,52 @@ type Action interface {
 const (
 	ControlEnableOrchestration = iota
 	ControlDisableOrchestration
+	// Arg: none, Result: map[string][]map[string]interface{} (entity ID -> event JSON maps)
+	ControlGetPendingEvents
+	// Arg: none, Result: []map[string]interface{} (action JSON maps)
+	ControlGetRecentActions
+	// Arg: none, Result: map[string]string (entity ID -> endpoint type)
+	ControlGetEntities
+	// Arg: none, Result: map[string]interface{}
+	ControlGetPolicyConfig
+	// Arg: event UUID string, Result: action JSON map
+	ControlReleaseEvent
+	// Arg: event UUID string, Result: action JSON map
+	ControlFaultEvent
+	// Arg: map[string]interface{} (new "explorePolicyParam"), Result: map[string]interface{}
+	ControlReloadPolicyConfig
 )
 
 type Control struct {
 	Op int
+	// operand of Op (can be nil)
+	Arg interface{}
+	// if non-nil, the orchestrator sends the result to this channel
+	ResultCh chan ControlResult
+}
+
+type ControlResult struct {
+	Value interface{}
+	Err   error
+}
+
+// ControlResult.Err for a bad Control.Arg (e.g. a bad explorePolicyParam).
+// Endpoints report it as a client error, rather than as a failure of the orchestrator.
+type ControlArgError struct {
+	Err error
+}
+
+func (e ControlArgError) Error() string {
+	return e.Err.Error()
+}
+
+// ControlResult.Err for a Control.Arg that refers to nothing (e.g. the UUID of an event which is not pending)
+type ControlNotFoundError struct {
+	Err error
+}
+
+func (e ControlNotFoundError) Error() string {
+	return e.Err.Error()
 }
 
 type OrchestratorSideAction interface {
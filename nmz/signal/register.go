@@ -22,6 +22,8 @@ func RegisterKnownSignals() {
 	RegisterSignalClass("LogEvent", &LogEvent{})
 	RegisterSignalClass("FilesystemEvent", &FilesystemEvent{})
 	RegisterSignalClass("ProcSetEvent", &ProcSetEvent{})
+	RegisterSignalClass("GoFunctionEvent", &GoFunctionEvent{})
+	RegisterSignalClass("FailpointEvent", &FailpointEvent{})
 
 	// PB events
 	RegisterSignalClass("CFunctionEvent", &CFunctionEvent{})
@@ -34,4 +36,7 @@ func RegisterKnownSignals() {
 	RegisterSignalClass("PacketFaultAction", &PacketFaultAction{})
 	RegisterSignalClass("FilesystemFaultAction", &FilesystemFaultAction{})
 	RegisterSignalClass("ProcSetSchedAction", &ProcSetSchedAction{})
+	RegisterSignalClass("FailpointErrorAction", &FailpointErrorAction{})
+	RegisterSignalClass("FailpointPanicAction", &FailpointPanicAction{})
+	RegisterSignalClass("FailpointSleepAction", &FailpointSleepAction{})
 }
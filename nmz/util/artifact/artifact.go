@@ -0,0 +1,190 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package artifact provides collection of the artifacts (e.g. logs and core dumps of the testee) of a run
+package artifact
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/cihub/seelog"
+)
+
+// name of the file that lists the collected artifacts (in the destination dir)
+const ManifestFileName = "manifest.json"
+
+type Config struct {
+	// glob patterns. relative patterns are resolved against BaseDir.
+	// directories are collected recursively.
+	Patterns []string
+	BaseDir  string
+	// if positive, only the last MaxFileSize bytes of a larger file are collected
+	MaxFileSize int64
+	// if positive, files are skipped after MaxTotalSize bytes are collected
+	MaxTotalSize int64
+	// if true, files are gzipped (".gz" is appended to the names)
+	Compress bool
+}
+
+// collected (or skipped) artifact
+type Entry struct {
+	Path string `json:"path"`
+	// relative to the destination dir. empty if skipped.
+	Dest string `json:"dest,omitempty"`
+	Size int64  `json:"size"`
+	// number of the collected bytes (before compression)
+	Collected int64 `json:"collected"`
+	Truncated bool  `json:"truncated,omitempty"`
+	// reason why the file is skipped
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// path of the artifact in the destination dir
+func (this *Config) destPath(path string) string {
+	rel, err := filepath.Rel(this.BaseDir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = strings.TrimPrefix(path, string(filepath.Separator))
+	}
+	if this.Compress {
+		rel += ".gz"
+	}
+	return rel
+}
+
+// returns the regular files matched by the patterns
+func (this *Config) matchedFiles(destDir string) ([]string, error) {
+	seen := make(map[string]bool)
+	files := make([]string, 0)
+	for _, pattern := range this.Patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(this.BaseDir, pattern)
+		}
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern %s: %s", pattern, err)
+		}
+		for _, p := range paths {
+			err = filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					log.Warnf("skipping artifact %s: %s", path, err)
+					return nil
+				}
+				if info.IsDir() && path == destDir {
+					// do not collect the artifacts collected
+					return filepath.SkipDir
+				}
+				if !info.Mode().IsRegular() || seen[path] {
+					return nil
+				}
+				seen[path] = true
+				files = append(files, path)
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// copies at most size bytes from offset, even if the file is still growing.
+// returns the number of the copied bytes, which can be less than size if the file has been truncated.
+func (this *Config) copyFile(path, destPath string, offset, size int64) (int64, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	if _, err = src.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if err = os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return 0, err
+	}
+	dst, err := os.Create(destPath)
+	if err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+	if !this.Compress {
+		n, err := io.CopyN(dst, src, size)
+		if err == io.EOF {
+			err = nil
+		}
+		return n, err
+	}
+	gz := gzip.NewWriter(dst)
+	n, err := io.CopyN(gz, src, size)
+	if err != nil && err != io.EOF {
+		return n, err
+	}
+	return n, gz.Close()
+}
+
+// copies the artifacts to destDir, and writes the manifest.
+// failures of individual files are recorded in the manifest rather than returned.
+func Collect(cfg *Config, destDir string) ([]*Entry, error) {
+	files, err := cfg.matchedFiles(destDir)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*Entry, 0, len(files))
+	total := int64(0)
+	for _, path := range files {
+		entry := &Entry{Path: path}
+		entries = append(entries, entry)
+		info, err := os.Stat(path)
+		if err != nil {
+			entry.Skipped = err.Error()
+			continue
+		}
+		entry.Size = info.Size()
+		size := entry.Size
+		if cfg.MaxFileSize > 0 && size > cfg.MaxFileSize {
+			size = cfg.MaxFileSize
+			entry.Truncated = true
+		}
+		if cfg.MaxTotalSize > 0 && total+size > cfg.MaxTotalSize {
+			entry.Skipped = fmt.Sprintf("total size exceeds %d bytes", cfg.MaxTotalSize)
+			continue
+		}
+		dest := cfg.destPath(path)
+		// keep the tail (the most recent part of logs)
+		n, err := cfg.copyFile(path, filepath.Join(destDir, dest), entry.Size-size, size)
+		if err != nil {
+			entry.Skipped = err.Error()
+			continue
+		}
+		entry.Dest = dest
+		entry.Collected = n
+		total += n
+	}
+	if len(entries) == 0 {
+		return entries, nil
+	}
+	js, err := json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return entries, err
+	}
+	return entries, ioutil.WriteFile(filepath.Join(destDir, ManifestFileName), js, 0644)
+}
@@ -0,0 +1,109 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func TestCollect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-artifact")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	base := filepath.Join(dir, "storage")
+	dest := filepath.Join(base, "00000000", "artifacts")
+	writeTestFile(t, filepath.Join(base, "materials", "n1", "logs", "a.log"), "0123456789")
+	writeTestFile(t, filepath.Join(base, "materials", "n2", "logs", "b.log"), strings.Repeat("x", 4))
+	writeTestFile(t, filepath.Join(base, "materials", "n2", "logs", "c.log"), strings.Repeat("y", 4))
+	writeTestFile(t, filepath.Join(dir, "core.42"), "core")
+
+	cfg := &Config{
+		Patterns:     []string{"materials/*/logs/*.log", filepath.Join(dir, "core.*"), "00000000"},
+		BaseDir:      base,
+		MaxFileSize:  4,
+		MaxTotalSize: 12,
+	}
+	entries, err := Collect(cfg, dest)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 4)
+
+	// the last 4 bytes
+	assert.True(t, entries[0].Truncated)
+	b, err := ioutil.ReadFile(filepath.Join(dest, "materials", "n1", "logs", "a.log"))
+	assert.NoError(t, err)
+	assert.Equal(t, "6789", string(b))
+
+	assert.Equal(t, "materials/n2/logs/b.log", entries[1].Dest)
+	assert.Equal(t, int64(4), entries[2].Collected)
+	// outside of the base dir
+	assert.Equal(t, "", entries[3].Dest)
+	assert.Contains(t, entries[3].Skipped, "total size")
+
+	_, err = os.Stat(filepath.Join(dest, ManifestFileName))
+	assert.NoError(t, err)
+
+	// collect again, with compression
+	dest2 := filepath.Join(base, "00000001", "artifacts")
+	cfg.Compress = true
+	cfg.MaxTotalSize = 0
+	entries, err = Collect(cfg, dest2)
+	assert.NoError(t, err)
+	// the artifacts collected in 00000000 (and its manifest) are also matched
+	assert.Len(t, entries, 8)
+	core := filepath.Join(dest2, strings.TrimPrefix(dir, "/"), "core.42.gz")
+	f, err := os.Open(core)
+	assert.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	b, err = ioutil.ReadAll(gz)
+	assert.NoError(t, err)
+	assert.Equal(t, "core", string(b))
+}
+
+func TestCopyFileOfGrowingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-artifact")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.log")
+	// the file has grown since its size was checked
+	writeTestFile(t, path, "0123456789abcdef")
+
+	cfg := &Config{}
+	n, err := cfg.copyFile(path, filepath.Join(dir, "dest", "a.log"), 6, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+	b, err := ioutil.ReadFile(filepath.Join(dir, "dest", "a.log"))
+	assert.NoError(t, err)
+	assert.Equal(t, "6789", string(b))
+
+	// the file has been truncated
+	n, err = cfg.copyFile(path, filepath.Join(dir, "dest", "b.log"), 12, 8)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+}
@@ -0,0 +1,116 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+// time to wait for the output after the command exited.
+// background processes started by the command can hold the output.
+const captureGracePeriod = 3 * time.Second
+
+type capturedStream struct {
+	path string
+	w    *os.File // write end of the pipe passed to the command
+	done chan struct{}
+}
+
+// captures stdout and stderr of a command into files,
+// while still writing them to the original Stdout and Stderr of the command.
+//
+// unlike setting io.MultiWriter to Stdout, waiting for the command does not block
+// when background processes started by the command inherit the output.
+type OutputCapture struct {
+	streams []*capturedStream
+}
+
+// path can be empty for streaming to orig only
+func startStream(path string, orig io.Writer) (*capturedStream, error) {
+	var f *os.File
+	var err error
+	if path != "" {
+		if f, err = os.Create(path); err != nil {
+			return nil, err
+		}
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		if f != nil {
+			f.Close()
+		}
+		return nil, err
+	}
+	s := &capturedStream{path: path, w: w, done: make(chan struct{})}
+	dsts := make([]io.Writer, 0, 2)
+	if orig != nil {
+		dsts = append(dsts, orig)
+	}
+	if f != nil {
+		dsts = append(dsts, f)
+	}
+	go func() {
+		defer close(s.done)
+		io.Copy(io.MultiWriter(dsts...), r)
+		r.Close()
+		if f != nil {
+			f.Close()
+		}
+	}()
+	return s, nil
+}
+
+// must be called before starting the command.
+// an empty path skips writing the file, while the output is still written to the original Stdout or Stderr
+// (e.g. io.MultiWriter with a TailBuffer) without blocking.
+func CaptureOutput(c *exec.Cmd, stdoutPath, stderrPath string) (*OutputCapture, error) {
+	stdout, err := startStream(stdoutPath, c.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := startStream(stderrPath, c.Stderr)
+	if err != nil {
+		stdout.w.Close()
+		return nil, err
+	}
+	c.Stdout = stdout.w
+	c.Stderr = stderr.w
+	return &OutputCapture{streams: []*capturedStream{stdout, stderr}}, nil
+}
+
+// must be called after the command exited (or failed to start).
+func (this *OutputCapture) Close() {
+	for _, s := range this.streams {
+		s.w.Close()
+	}
+	deadline := time.Now().Add(captureGracePeriod)
+	for _, s := range this.streams {
+		select {
+		case <-s.done:
+		case <-time.After(deadline.Sub(time.Now())):
+			name := s.path
+			if name == "" {
+				name = "the output"
+			}
+			log.Warnf("%s is still open (by a background process?)", name)
+		}
+	}
+}
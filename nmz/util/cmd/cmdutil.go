@@ -26,6 +26,8 @@ import (
 type CmdFactory struct {
 	workingDir   string
 	materialsDir string
+	// additional environment variables ("NAME=value")
+	envs []string
 }
 
 // set NMZ_WORKING_DIR
@@ -46,6 +48,11 @@ func (this *CmdFactory) GetMaterialsDir() string {
 	return this.materialsDir
 }
 
+// adds an environment variable passed to the commands
+func (this *CmdFactory) SetEnv(name, value string) {
+	this.envs = append(this.envs, name+"="+value)
+}
+
 func (this *CmdFactory) CreateCmd(scriptPath string) *exec.Cmd {
 	cmd := exec.Command("sh", "-c", scriptPath)
 
@@ -65,6 +72,7 @@ func (this *CmdFactory) CreateCmd(scriptPath string) *exec.Cmd {
 	} else {
 		log.Warnf("MaterialsDir is empty")
 	}
+	cmd.Env = append(cmd.Env, this.envs...)
 	return cmd
 }
 
@@ -16,7 +16,13 @@
 package cmd
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -26,6 +32,70 @@ func TestCmdFactory(t *testing.T) {
 	// there shouldn't any access to the file, actually
 	f.SetWorkingDir("/tmp/dummy1")
 	f.SetMaterialsDir("/tmp/dummy2")
+	f.SetEnv("NMZ_REST_PORT", "10080")
 	cmd := f.CreateCmd("echo 42")
 	assert.Contains(t, cmd.Env, "NMZ_WORKING_DIR=/tmp/dummy1")
+	assert.Contains(t, cmd.Env, "NMZ_REST_PORT=10080")
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := NewTailBuffer(8)
+	b.Write([]byte("hello, "))
+	assert.Equal(t, "hello, ", b.String())
+	n, err := b.Write([]byte("world"))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, "o, world", b.String())
+	b.Write([]byte("0123456789"))
+	assert.Equal(t, "23456789", b.String())
+}
+
+func TestCaptureOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-cmd")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	stdoutPath, stderrPath := path.Join(dir, "stdout"), path.Join(dir, "stderr")
+
+	var orig bytes.Buffer
+	c := exec.Command("sh", "-c", "echo out; echo err >&2; (sleep 60 > /dev/null 2>&1 &)")
+	c.Stdout = &orig
+	oc, err := CaptureOutput(c, stdoutPath, stderrPath)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Run())
+	oc.Close()
+
+	b, err := ioutil.ReadFile(stdoutPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "out\n", string(b))
+	b, err = ioutil.ReadFile(stderrPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "err\n", string(b))
+	assert.Equal(t, "out\n", orig.String())
+}
+
+func TestCaptureOutputWithoutFiles(t *testing.T) {
+	stdout, stderr := NewTailBuffer(4), NewTailBuffer(4)
+	c := exec.Command("sh", "-c", "echo out; echo err >&2; (sleep 60 &)")
+	c.Stdout, c.Stderr = stdout, stderr
+	oc, err := CaptureOutput(c, "", "")
+	assert.NoError(t, err)
+	assert.NoError(t, c.Run())
+	oc.Close()
+	assert.Equal(t, "out\n", stdout.String())
+	assert.Equal(t, "err\n", stderr.String())
+}
+
+func TestCaptureOutputWithBackgroundProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-cmd")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// the background process holds both of stdout and stderr
+	c := exec.Command("sh", "-c", "echo out; (sleep 60 &)")
+	oc, err := CaptureOutput(c, path.Join(dir, "stdout"), path.Join(dir, "stderr"))
+	assert.NoError(t, err)
+	assert.NoError(t, c.Run())
+	start := time.Now()
+	oc.Close()
+	assert.True(t, time.Since(start) < 2*captureGracePeriod)
 }
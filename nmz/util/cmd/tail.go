@@ -0,0 +1,52 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"sync"
+)
+
+// io.Writer that keeps only the last size bytes written.
+// it is safe to use as both of Stdout and Stderr of a command.
+type TailBuffer struct {
+	size int
+	buf  []byte
+	mu   sync.Mutex
+}
+
+func NewTailBuffer(size int) *TailBuffer {
+	return &TailBuffer{size: size}
+}
+
+func (this *TailBuffer) Write(p []byte) (int, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	n := len(p)
+	if len(p) > this.size {
+		p = p[len(p)-this.size:]
+	}
+	this.buf = append(this.buf, p...)
+	if over := len(this.buf) - this.size; over > 0 {
+		this.buf = append(this.buf[:0], this.buf[over:]...)
+	}
+	return n, nil
+}
+
+func (this *TailBuffer) String() string {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return string(this.buf)
+}
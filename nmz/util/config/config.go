@@ -55,6 +55,66 @@ func New() Config {
 	// e.g. "validate.sh"
 	cfg.SetDefault("validate", "")
 
+	// Used for "run" command.
+	// if positive, the run script is regarded as hung when it does not finish within this duration.
+	// then the stacks are dumped (see hangDump), the process group is killed, and the run is recorded as "hang".
+	// e.g. "10m"
+	cfg.SetDefault("runTimeout", time.Duration(0))
+
+	// Used for "run" command.
+	// script for dumping the stacks of the hung processes (NMZ_HANG_PGID is set).
+	// if empty, SIGQUIT is sent to the process group of the run script (JVM and Go dump the stacks).
+	// e.g. "dump.sh"
+	cfg.SetDefault("hangDump", "")
+
+	// Used for "run" command.
+	// time to wait for the stack dumps before killing the process group
+	cfg.SetDefault("hangDumpWait", 5*time.Second)
+
+	// Used for "run" command.
+	// regexp for extracting the failure signature from the output of the validate script and failureSignatureFiles.
+	// if the regexp has submatches, they are joined. if empty or not matched, the exception and the top stack frames are used.
+	// e.g. "(assertion \\w+ failed)"
+	cfg.SetDefault("failureSignatureRegexp", "")
+
+	// Used for "run" command.
+	// number of the stack frames in the failure signature
+	cfg.SetDefault("failureSignatureFrames", 3)
+
+	// Used for "run" command.
+	// glob patterns of the log files used for extracting the failure signature.
+	// relative patterns are resolved against the storage dir (as "artifacts" are).
+	// e.g. ["materials/*/logs/*.log"]
+	cfg.SetDefault("failureSignatureFiles", []string{})
+
+	// Used for "run" command.
+	// if true, stdout and stderr of the run, validate, and clean scripts are also written to
+	// "run.stdout", "run.stderr", "validate.stdout", .. in the working dir.
+	// disabled by default, as the scripts which leave daemons holding stdout delay "nmz run" (see arch.md).
+	cfg.SetDefault("captureOutput", false)
+
+	// Used for "run" command.
+	// glob patterns of the artifacts (e.g. logs and core dumps) copied to "artifacts" in the working dir,
+	// before the clean script is executed. relative patterns are resolved against the storage dir.
+	// e.g. ["materials/*/logs/*.log", "/var/crash/core.*"]
+	cfg.SetDefault("artifacts", []string{})
+
+	// Used for "run" command.
+	// if positive, only the last artifactMaxFileSize bytes of a larger artifact are copied
+	cfg.SetDefault("artifactMaxFileSize", 64*1024*1024)
+
+	// Used for "run" command.
+	// if positive, artifacts are skipped after artifactMaxTotalSize bytes are copied
+	cfg.SetDefault("artifactMaxTotalSize", 256*1024*1024)
+
+	// Used for "run" command.
+	// if true, artifacts are gzipped
+	cfg.SetDefault("artifactCompress", true)
+
+	// Used for "run" command.
+	// if true, artifacts are collected only when the run failed
+	cfg.SetDefault("artifactsOnFailureOnly", false)
+
 	// Used for something deprecated?
 	// if true, skip clean.sh when validate.sh failed.
 	// "container" command ignores this.
@@ -65,6 +125,30 @@ func New() Config {
 	// Used for "run" command
 	cfg.SetDefault("storageType", "naive")
 
+	// Used when storageType is "mongodb"
+	// e.g. "mongodb://db1,db2/namazu?replicaSet=rs0"
+	cfg.SetDefault("mongodbURI", "mongodb://localhost/namazu")
+	// if non-empty, these override the ones in mongodbURI.
+	// if mongodbPassword is empty, $NMZ_MONGODB_PASSWORD is used.
+	cfg.SetDefault("mongodbDatabase", "")
+	cfg.SetDefault("mongodbUsername", "")
+	cfg.SetDefault("mongodbPassword", "")
+	cfg.SetDefault("mongodbAuthSource", "")
+	// prefix of the collection names ("action", "event", "trace", "result")
+	cfg.SetDefault("mongodbCollectionPrefix", "")
+	cfg.SetDefault("mongodbTimeout", 10*time.Second)
+
+	// Used for "run" command
+	// if true, the trace is also exported as OTLP-JSON ("trace.otlp.json" in the working dir),
+	// which can be loaded into Jaeger and other trace viewers.
+	cfg.SetDefault("exportOTLPTrace", false)
+
+	// Used for "run" command
+	// if true, the packets inspected by the Ethernet inspectors are written to "packets.pcapng" in the working dir,
+	// with comments on what was done to each packet (accepted or dropped, and the injected delay).
+	// nothing is written if no packet was inspected.
+	cfg.SetDefault("exportPcapng", true)
+
 	///// INSPECTOR HANDLER ENDPOINT
 	// "container" command ignores these values.
 	// Used for PB inspector handler (used by Java and C inspector)
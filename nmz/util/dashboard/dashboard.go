@@ -0,0 +1,173 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dashboard provides the embedded web UI for live experiments and stored histories
+//
+// The live UI polls the control API of the REST endpoint (see doc/arch.md).
+// The storage UI reads result.json and actions/*.{action,event}.json written by the naive history storage.
+package dashboard
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/osrg/namazu/nmz/historystorage"
+	"github.com/osrg/namazu/nmz/historystorage/naive"
+	restutil "github.com/osrg/namazu/nmz/util/rest"
+)
+
+type pageParams struct {
+	// "live" or "storage"
+	Mode    string
+	APIRoot string
+	Title   string
+}
+
+var pageTemplate = template.Must(template.New("dashboard").Parse(pageHTML))
+
+func writePage(w http.ResponseWriter, params pageParams) {
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	if err := pageTemplate.Execute(w, params); err != nil {
+		restutil.WriteError(w, err)
+	}
+}
+
+// Returns the handler for the live experiment.
+//
+// The handler is expected to be served on the same server as the REST endpoint,
+// as it uses the control API under restutil.APIRoot.
+func NewLiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writePage(w, pageParams{
+			Mode:    "live",
+			APIRoot: restutil.APIRoot,
+			Title:   fmt.Sprintf("live experiment (pid=%d)", os.Getpid()),
+		})
+	})
+}
+
+type storageHandler struct {
+	dir string
+	// loaded on the first request, and reused (e.g. not to dial mongodb for every request)
+	storage historystorage.HistoryStorage
+	// serializes the requests using storage
+	mu sync.Mutex
+}
+
+// Returns the handler for the history storage located at dir
+func NewStorageHandler(dir string) http.Handler {
+	h := &storageHandler{dir: dir}
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/", h.rootOnGet).Methods("GET")
+	router.HandleFunc("/api/runs", h.runsOnGet).Methods("GET")
+	router.HandleFunc("/api/runs/{id}/actions", h.actionsOnGet).Methods("GET")
+	return router
+}
+
+func (h *storageHandler) rootOnGet(w http.ResponseWriter, r *http.Request) {
+	writePage(w, pageParams{
+		Mode:    "storage",
+		APIRoot: "/api",
+		Title:   h.dir,
+	})
+}
+
+// JSON for a run
+type run struct {
+	ID             int    `json:"id"`
+	Successful     bool   `json:"successful"`
+	RequiredTime   string `json:"required_time"`
+	RequiredTimeMS int64  `json:"required_time_ms"`
+	// non-empty if the result is broken
+	Error string `json:"error,omitempty"`
+}
+
+// should be called with h.mu held
+func (h *storageHandler) loadStorage() (historystorage.HistoryStorage, error) {
+	if h.storage == nil {
+		storage, err := historystorage.LoadStorage(h.dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load storage %s: %s", h.dir, err)
+		}
+		h.storage = storage
+	}
+	// re-read every time, so that the runs in progress are shown
+	h.storage.Init()
+	return h.storage, nil
+}
+
+func (h *storageHandler) runsOnGet(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	storage, err := h.loadStorage()
+	if err != nil {
+		restutil.WriteError(w, err)
+		return
+	}
+	nrStored := storage.NrStoredHistories()
+	runs := make([]run, 0, nrStored)
+	for i := 0; i < nrStored; i++ {
+		x := run{ID: i}
+		successful, err := storage.IsSuccessful(i)
+		if os.IsNotExist(err) {
+			// deleted by "nmz tools gc", or still in progress
+			continue
+		}
+		if err != nil {
+			x.Error = err.Error()
+			runs = append(runs, x)
+			continue
+		}
+		requiredTime, err := storage.GetRequiredTime(i)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			x.Error = err.Error()
+			runs = append(runs, x)
+			continue
+		}
+		x.Successful = successful
+		x.RequiredTime = requiredTime.String()
+		x.RequiredTimeMS = int64(requiredTime) / 1000000
+		runs = append(runs, x)
+	}
+	if err := restutil.WriteJSON(w, runs); err != nil {
+		restutil.WriteError(w, err)
+	}
+}
+
+func (h *storageHandler) actionsOnGet(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		restutil.WriteError(w, err)
+		return
+	}
+	// the actions can be compacted by "nmz tools gc"
+	actions, err := naive.ReadActionJSONs(path.Join(h.dir, fmt.Sprintf("%08x", id)))
+	if err != nil {
+		restutil.WriteError(w, err)
+		return
+	}
+	if err := restutil.WriteJSON(w, actions); err != nil {
+		restutil.WriteError(w, err)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashboard
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/osrg/namazu/nmz/signal"
+	logutil "github.com/osrg/namazu/nmz/util/log"
+	testutil "github.com/osrg/namazu/nmz/util/test"
+	. "github.com/osrg/namazu/nmz/util/trace"
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	logutil.InitLog("", true)
+	signal.RegisterKnownSignals()
+	os.Exit(m.Run())
+}
+
+func newNaiveStorageWithRun(t *testing.T, successful bool) string {
+	dir := testutil.NewNaiveStorage(t, "test-dashboard")
+	recordRun(t, dir, successful)
+	return dir
+}
+
+func recordRun(t *testing.T, dir string, successful bool) {
+	event := testutil.NewPacketEvent(t, "entity-0", 0)
+	action, err := event.DefaultFaultAction()
+	assert.NoError(t, err)
+	storage := testutil.NewNaiveRun(t, dir, &SingleTrace{ActionSequence: []signal.Action{action}})
+	assert.NoError(t, storage.RecordResult(successful, 42*time.Millisecond, nil))
+}
+
+func TestStorageHandler(t *testing.T) {
+	dir := newNaiveStorageWithRun(t, false)
+	defer os.RemoveAll(dir)
+	srv := httptest.NewServer(NewStorageHandler(dir))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/")
+	assert.NoError(t, err)
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), "Namazu Dashboard")
+
+	res, err = http.Get(srv.URL + "/api/runs")
+	assert.NoError(t, err)
+	var runs []run
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&runs))
+	res.Body.Close()
+	assert.Len(t, runs, 1)
+	assert.False(t, runs[0].Successful)
+	assert.Equal(t, int64(42), runs[0].RequiredTimeMS)
+
+	res, err = http.Get(srv.URL + "/api/runs/0/actions")
+	assert.NoError(t, err)
+	var actions []map[string]interface{}
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&actions))
+	res.Body.Close()
+	assert.Len(t, actions, 1)
+	assert.Equal(t, "PacketFaultAction", actions[0]["class"])
+	assert.Equal(t, "PacketEvent", actions[0]["event"].(map[string]interface{})["class"])
+
+	// the loaded storage is reused, but the new runs are shown (except the runs in progress)
+	recordRun(t, dir, true)
+	testutil.NewNaiveRun(t, dir, nil)
+	res, err = http.Get(srv.URL + "/api/runs")
+	assert.NoError(t, err)
+	runs = nil
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&runs))
+	res.Body.Close()
+	assert.Len(t, runs, 2)
+	assert.True(t, runs[1].Successful)
+}
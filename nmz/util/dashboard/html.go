@@ -0,0 +1,232 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashboard
+
+// pageHTML is a html/template for both the live UI and the storage UI.
+// it does not depend on any external resources, so that it works in an isolated testbed.
+const pageHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Namazu Dashboard: {{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 6px; font-size: small; vertical-align: top; }
+th { background: #eee; }
+tr.clickable:hover, td.clickable:hover { background: #def; cursor: pointer; }
+.pass { color: #080; }
+.fail { color: #c00; font-weight: bold; }
+.fault { background: #fdd; }
+.subtitle { color: #666; }
+pre { background: #f8f8f8; border: 1px solid #ccc; padding: 0.5em; }
+</style>
+</head>
+<body>
+<h1>Namazu Dashboard</h1>
+<p class="subtitle">{{.Title}}</p>
+<div id="live" hidden>
+  <h2>Pending events</h2>
+  <table id="pending"></table>
+  <h2>Recent actions</h2>
+  <div id="live-timeline"></div>
+</div>
+<div id="storage" hidden>
+  <h2>Runs</h2>
+  <p id="runs-summary"></p>
+  <table id="runs"></table>
+  <h2 id="run-title"></h2>
+  <div id="run-timeline"></div>
+</div>
+<pre id="detail" hidden></pre>
+<script>
+var mode = {{.Mode}};
+var apiRoot = {{.APIRoot}};
+
+function request(method, url, cb) {
+  var xhr = new XMLHttpRequest();
+  xhr.open(method, url);
+  xhr.onload = function() {
+    if (xhr.status != 200) {
+      showDetail(method + " " + url + ": " + xhr.status + " " + xhr.responseText);
+      return;
+    }
+    cb(JSON.parse(xhr.responseText));
+  };
+  xhr.send();
+}
+
+function cell(row, tag, text, cls) {
+  var c = document.createElement(tag);
+  c.textContent = text;
+  if (cls) {
+    c.className = cls;
+  }
+  row.appendChild(c);
+  return c;
+}
+
+function clear(node) {
+  while (node.firstChild) {
+    node.removeChild(node.firstChild);
+  }
+}
+
+function showDetail(v) {
+  var detail = document.getElementById("detail");
+  detail.textContent = typeof v == "string" ? v : JSON.stringify(v, null, 2);
+  detail.hidden = false;
+}
+
+function hex8(i) {
+  return ("0000000" + i.toString(16)).slice(-8);
+}
+
+function summarizeOption(opt) {
+  if (!opt) {
+    return "";
+  }
+  return Object.keys(opt).sort().map(function(k) {
+    var v = JSON.stringify(opt[k]);
+    if (v.length > 32) {
+      v = v.slice(0, 32) + "...";
+    }
+    return k + "=" + v;
+  }).join(" ");
+}
+
+// one column per entity, one row per action (in the order of the trace)
+function renderTimeline(container, actions) {
+  clear(container);
+  var entities = [];
+  actions.forEach(function(a) {
+    if (entities.indexOf(a.entity) < 0) {
+      entities.push(a.entity);
+    }
+  });
+  var table = document.createElement("table");
+  var header = document.createElement("tr");
+  cell(header, "th", "#");
+  entities.forEach(function(e) { cell(header, "th", e); });
+  table.appendChild(header);
+  actions.forEach(function(a, i) {
+    var row = document.createElement("tr");
+    cell(row, "td", i);
+    entities.forEach(function(e) {
+      if (e != a.entity) {
+        cell(row, "td", "");
+        return;
+      }
+      var text = a.class;
+      if (a.event) {
+        text += " for " + a.event.class + " " + summarizeOption(a.event.option);
+      }
+      var isFault = a.class.indexOf("Fault") >= 0;
+      var c = cell(row, "td", text, "clickable" + (isFault ? " fault" : ""));
+      c.onclick = function() { showDetail(a); };
+    });
+    table.appendChild(row);
+  });
+  container.appendChild(table);
+}
+
+function refreshLive() {
+  request("GET", apiRoot + "/control/events", function(perEntity) {
+    var table = document.getElementById("pending");
+    clear(table);
+    var header = document.createElement("tr");
+    ["entity", "class", "option", ""].forEach(function(h) { cell(header, "th", h); });
+    table.appendChild(header);
+    Object.keys(perEntity).sort().forEach(function(entity) {
+      perEntity[entity].forEach(function(ev) {
+        var row = document.createElement("tr");
+        cell(row, "td", entity);
+        cell(row, "td", ev.class);
+        cell(row, "td", summarizeOption(ev.option), "clickable").onclick = function() { showDetail(ev); };
+        var buttons = cell(row, "td", "");
+        ["release", "fault"].forEach(function(op) {
+          var b = document.createElement("button");
+          b.textContent = op;
+          b.onclick = function() {
+            request("POST", apiRoot + "/control/events/" + ev.uuid + "?op=" + op, refreshLive);
+          };
+          buttons.appendChild(b);
+        });
+        table.appendChild(row);
+      });
+    });
+  });
+  request("GET", apiRoot + "/control/actions", function(actions) {
+    renderTimeline(document.getElementById("live-timeline"), actions);
+  });
+}
+
+function showRun(id) {
+  document.getElementById("run-title").textContent = "Run " + hex8(id);
+  request("GET", apiRoot + "/runs/" + id + "/actions", function(actions) {
+    renderTimeline(document.getElementById("run-timeline"), actions);
+  });
+}
+
+function refreshStorage() {
+  request("GET", apiRoot + "/runs", function(runs) {
+    var table = document.getElementById("runs");
+    clear(table);
+    var header = document.createElement("tr");
+    ["id", "result", "required time"].forEach(function(h) { cell(header, "th", h); });
+    table.appendChild(header);
+    var failed = 0, finished = 0, totalMS = 0;
+    runs.forEach(function(r) {
+      var row = document.createElement("tr");
+      row.className = "clickable";
+      row.onclick = function() { showRun(r.id); };
+      cell(row, "td", hex8(r.id));
+      if (r.error) {
+        cell(row, "td", "-");
+        cell(row, "td", r.error);
+      } else {
+        finished++;
+        totalMS += r.required_time_ms;
+        if (!r.successful) {
+          failed++;
+        }
+        cell(row, "td", r.successful ? "pass" : "fail", r.successful ? "pass" : "fail");
+        cell(row, "td", r.required_time);
+      }
+      table.appendChild(row);
+    });
+    var summary = runs.length + " runs, " + failed + " failed";
+    if (finished > 0) {
+      summary += " (" + (100.0 * failed / finished).toFixed(1) + "%), average " +
+        (totalMS / finished / 1000).toFixed(3) + "s";
+    }
+    document.getElementById("runs-summary").textContent = summary;
+  });
+}
+
+if (mode == "live") {
+  document.getElementById("live").hidden = false;
+  refreshLive();
+  setInterval(refreshLive, 1000);
+} else {
+  document.getElementById("storage").hidden = false;
+  refreshStorage();
+  setInterval(refreshStorage, 5000);
+}
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,289 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics provides minimal Prometheus-compatible metrics.
+//
+// Metrics are exposed in the Prometheus text format (version 0.0.4), so that
+// a Prometheus server can scrape `/metrics` of the REST endpoint without any client library.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type metric interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	registered   = make(map[string]metric)
+	registeredMu sync.RWMutex
+)
+
+func register(m metric) {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	if _, ok := registered[m.name()]; ok {
+		panic(fmt.Errorf("metric %s has been already registered", m.name()))
+	}
+	registered[m.name()] = m
+}
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, +1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return fmt.Sprintf("%g", v)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		fmt.Fprintf(&buf, "%s=\"%s\"", name, labelValueReplacer.Replace(values[i]))
+	}
+	buf.WriteString("}")
+	return buf.String()
+}
+
+// Vec is a counter or a gauge, partitioned by labels
+type Vec struct {
+	metricName string
+	help       string
+	typ        string
+	labelNames []string
+	mu         sync.Mutex
+	// key: label values joined with "\x00"
+	values      map[string]float64
+	labelValues map[string][]string
+}
+
+func newVec(name, help, typ string, labelNames []string) *Vec {
+	v := &Vec{
+		metricName:  name,
+		help:        help,
+		typ:         typ,
+		labelNames:  labelNames,
+		values:      make(map[string]float64),
+		labelValues: make(map[string][]string),
+	}
+	register(v)
+	return v
+}
+
+// Registers a new counter
+func NewCounterVec(name, help string, labelNames ...string) *Vec {
+	return newVec(name, help, "counter", labelNames)
+}
+
+// Registers a new gauge
+func NewGaugeVec(name, help string, labelNames ...string) *Vec {
+	return newVec(name, help, "gauge", labelNames)
+}
+
+func (v *Vec) name() string {
+	return v.metricName
+}
+
+func (v *Vec) update(f func(old float64) float64, labelValues []string) {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Errorf("metric %s: expected %d label values, got %d", v.metricName, len(v.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\x00")
+	v.mu.Lock()
+	v.values[key] = f(v.values[key])
+	if _, ok := v.labelValues[key]; !ok {
+		v.labelValues[key] = append([]string{}, labelValues...)
+	}
+	v.mu.Unlock()
+}
+
+// Adds delta. (For counters, delta must not be negative.)
+func (v *Vec) Add(delta float64, labelValues ...string) {
+	if v.typ == "counter" && delta < 0 {
+		panic(fmt.Errorf("counter %s cannot decrease", v.metricName))
+	}
+	v.update(func(old float64) float64 { return old + delta }, labelValues)
+}
+
+func (v *Vec) Inc(labelValues ...string) {
+	v.Add(1, labelValues...)
+}
+
+// Sets the value (only for gauges)
+func (v *Vec) Set(value float64, labelValues ...string) {
+	if v.typ != "gauge" {
+		panic(fmt.Errorf("%s %s cannot be set", v.typ, v.metricName))
+	}
+	v.update(func(float64) float64 { return value }, labelValues)
+}
+
+// Returns the current value (mainly for testing)
+func (v *Vec) Value(labelValues ...string) float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.values[strings.Join(labelValues, "\x00")]
+}
+
+func (v *Vec) write(w io.Writer) {
+	writeHeader(w, v.metricName, v.help, v.typ)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", v.metricName, formatLabels(v.labelNames, v.labelValues[k]), formatValue(v.values[k]))
+	}
+}
+
+// gaugeFunc is evaluated on every scrape
+type gaugeFunc struct {
+	metricName string
+	help       string
+	fn         func() float64
+}
+
+// Registers a new gauge whose value is determined by fn on every scrape
+func NewGaugeFunc(name, help string, fn func() float64) {
+	register(&gaugeFunc{metricName: name, help: help, fn: fn})
+}
+
+func (g *gaugeFunc) name() string {
+	return g.metricName
+}
+
+func (g *gaugeFunc) write(w io.Writer) {
+	writeHeader(w, g.metricName, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.metricName, formatValue(g.fn()))
+}
+
+// Histogram counts observed values in cumulative buckets
+type Histogram struct {
+	metricName string
+	help       string
+	// upper bounds (sorted, excluding +Inf)
+	buckets []float64
+	mu      sync.Mutex
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+// Default buckets for latencies in seconds (1ms .. 60s)
+var DefaultLatencyBuckets = []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30, 60}
+
+// Registers a new histogram
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	b := append([]float64{}, buckets...)
+	sort.Float64s(b)
+	h := &Histogram{
+		metricName: name,
+		help:       help,
+		buckets:    b,
+		counts:     make([]uint64, len(b)),
+	}
+	register(h)
+	return h
+}
+
+func (h *Histogram) name() string {
+	return h.metricName
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// Returns the number of observations (mainly for testing)
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+func (h *Histogram) write(w io.Writer) {
+	writeHeader(w, h.metricName, h.help, "histogram")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, upper := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.metricName, formatValue(upper), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.metricName, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.metricName, formatValue(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.metricName, h.count)
+}
+
+// Writes all the registered metrics in the Prometheus text format
+func WriteText(w io.Writer) {
+	registeredMu.RLock()
+	names := make([]string, 0, len(registered))
+	for name := range registered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ms := make([]metric, 0, len(names))
+	for _, name := range names {
+		ms = append(ms, registered[name])
+	}
+	registeredMu.RUnlock()
+	for _, m := range ms {
+		m.write(w)
+	}
+}
+
+// Returns the handler for `/metrics`
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteText(w)
+	})
+}
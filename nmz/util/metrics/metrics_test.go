@@ -0,0 +1,65 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"testing"
+
+	logutil "github.com/osrg/namazu/nmz/util/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	logutil.InitLog("", true)
+	os.Exit(m.Run())
+}
+
+func TestWriteText(t *testing.T) {
+	c := NewCounterVec("test_events_total", "Events.", "class", "entity")
+	c.Inc("PacketEvent", "zksrv1")
+	c.Inc("PacketEvent", "zksrv1")
+	c.Inc("PacketEvent", "with\"quote")
+	assert.Equal(t, 2.0, c.Value("PacketEvent", "zksrv1"))
+	assert.Panics(t, func() { c.Add(-1, "PacketEvent", "zksrv1") })
+	assert.Panics(t, func() { c.Inc("PacketEvent") })
+
+	g := NewGaugeVec("test_queue_items", "Items.")
+	g.Set(3)
+	NewGaugeFunc("test_goroutines", "Goroutines.", func() float64 { return 42 })
+	h := NewHistogram("test_latency_seconds", "Latency.", []float64{1, 0.1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(5)
+	assert.Panics(t, func() { NewGaugeVec("test_queue_items", "Duplicated.") })
+
+	var buf bytes.Buffer
+	WriteText(&buf)
+	s := buf.String()
+	t.Logf("%s", s)
+	assert.Contains(t, s, "# TYPE test_events_total counter\n")
+	assert.Contains(t, s, "test_events_total{class=\"PacketEvent\",entity=\"zksrv1\"} 2\n")
+	assert.Contains(t, s, "test_events_total{class=\"PacketEvent\",entity=\"with\\\"quote\"} 1\n")
+	assert.Contains(t, s, "test_queue_items 3\n")
+	assert.Contains(t, s, "test_goroutines 42\n")
+	assert.Contains(t, s, "test_latency_seconds_bucket{le=\"0.1\"} 1\n")
+	assert.Contains(t, s, "test_latency_seconds_bucket{le=\"1\"} 2\n")
+	assert.Contains(t, s, "test_latency_seconds_bucket{le=\"+Inf\"} 3\n")
+	assert.Contains(t, s, "test_latency_seconds_count 3\n")
+}
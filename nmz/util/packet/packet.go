@@ -13,7 +13,8 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package ethernet
+// Package packet provides helpers for parsing Ethernet frames, shared by the Ethernet inspectors and the pcap importer
+package packet
 
 import (
 	"fmt"
@@ -22,7 +23,8 @@ import (
 	"github.com/google/gopacket/layers"
 )
 
-func makeEntityIDs(eth *layers.Ethernet, ip *layers.IPv4, tcp *layers.TCP) (string, string) {
+// returns the entity IDs of the source and the destination ("entity-<ip>:<port>")
+func EntityIDs(eth *layers.Ethernet, ip *layers.IPv4, tcp *layers.TCP) (string, string) {
 	srcEntityID := "_namazu_unknown_entity"
 	dstEntityID := "_namazu_unknown_entity"
 	if ip != nil && tcp != nil {
@@ -32,7 +34,8 @@ func makeEntityIDs(eth *layers.Ethernet, ip *layers.IPv4, tcp *layers.TCP) (stri
 	return srcEntityID, dstEntityID
 }
 
-func parseEthernetBytes(b []byte) (eth *layers.Ethernet, ip *layers.IPv4, tcp *layers.TCP) {
+// the layers not found are nil
+func ParseEthernet(b []byte) (eth *layers.Ethernet, ip *layers.IPv4, tcp *layers.TCP) {
 	packet := gopacket.NewPacket(b, layers.LayerTypeEthernet, gopacket.Default)
 	if layer := packet.Layer(layers.LayerTypeEthernet); layer != nil {
 		eth, _ = layer.(*layers.Ethernet)
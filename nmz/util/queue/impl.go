@@ -22,8 +22,12 @@ import (
 
 	log "github.com/cihub/seelog"
 	"github.com/eapache/channels"
+	"github.com/osrg/namazu/nmz/util/metrics"
 )
 
+var queuedItems = metrics.NewGaugeVec("nmz_queue_items",
+	"Number of items in the time-bounded queues of explore policies.", "owner")
+
 // implements TimeBoundedQueueItem
 type BasicTBQueueItem struct {
 	value        interface{}
@@ -63,12 +67,16 @@ func (this *BasicTBQueueItem) MaxDuration() time.Duration {
 
 // implements TimeBoundedQueue
 type BasicTBQueue struct {
+	// label of the metrics (e.g. the policy name)
+	owner              string
 	dequeueChan        chan TimeBoundedQueueItem
 	fixedDurationQueue *channels.InfiniteChannel
 }
 
-func NewBasicTBQueue() TimeBoundedQueue {
+// owner is used as the label of nmz_queue_items
+func NewBasicTBQueue(owner string) TimeBoundedQueue {
 	q := &BasicTBQueue{
+		owner:              owner,
 		dequeueChan:        make(chan TimeBoundedQueueItem),
 		fixedDurationQueue: channels.NewInfiniteChannel(),
 	}
@@ -84,6 +92,7 @@ func NewBasicTBQueue() TimeBoundedQueue {
 				}
 				<-time.After(item.MaxDuration())
 				q.dequeueChan <- item.(TimeBoundedQueueItem)
+				queuedItems.Add(-1, q.owner)
 			}
 		}
 	}()
@@ -114,6 +123,7 @@ func (this *BasicTBQueue) Enqueue(item_ TimeBoundedQueueItem) error {
 		return fmt.Errorf("bad item %s", item_)
 	}
 	item.enqueuedTime = time.Now()
+	queuedItems.Add(1, this.owner)
 	if item.minDuration == item.maxDuration {
 		// we need this to ensure enqueuing order
 		this.fixedDurationQueue.In() <- item
@@ -122,6 +132,7 @@ func (this *BasicTBQueue) Enqueue(item_ TimeBoundedQueueItem) error {
 			duration := determineDuration(item.minDuration, item.maxDuration)
 			<-time.After(duration)
 			this.dequeueChan <- item
+			queuedItems.Add(-1, this.owner)
 		}()
 	}
 	return nil
@@ -27,7 +27,7 @@ func TestTimeBoundedQueueWithoutDurations(t *testing.T) {
 	// for type assertion testing, declare var explicitly here
 	var queue TimeBoundedQueue
 	t.Logf("%s: Creating queue", time.Now())
-	queue = NewBasicTBQueue()
+	queue = NewBasicTBQueue("test")
 	deqCh := queue.GetDequeueChan()
 	t.Logf("%s: Created queue: %#v", time.Now(), queue)
 	for i := 0; i < 3; i++ {
@@ -49,7 +49,7 @@ func TestTimeBoundedQueueWithoutDurations(t *testing.T) {
 }
 
 func TestTimeBoundedQueueWithFixedDuration(t *testing.T) {
-	queue := NewBasicTBQueue()
+	queue := NewBasicTBQueue("test")
 	deqCh := queue.GetDequeueChan()
 	for i := 0; i < 3; i++ {
 		item, err := NewBasicTBQueueItem(42+i, time.Duration(10*time.Millisecond), time.Duration(10*time.Millisecond))
@@ -65,7 +65,7 @@ func TestTimeBoundedQueueWithFixedDuration(t *testing.T) {
 }
 
 func TestTimeBoundedQueueWithSeveralDurationsConcurrent(t *testing.T) {
-	queue := NewBasicTBQueue()
+	queue := NewBasicTBQueue("test")
 	deqCh := queue.GetDequeueChan()
 
 	durations := map[int][]time.Duration{
@@ -109,3 +109,12 @@ func TestTimeBoundedQueueWithSeveralDurationsConcurrent(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestTimeBoundedQueueMetrics(t *testing.T) {
+	queue := NewBasicTBQueue("test-metrics")
+	item, err := NewBasicTBQueueItem(42, time.Hour, time.Hour)
+	assert.NoError(t, err)
+	assert.NoError(t, queue.Enqueue(item))
+	assert.Equal(t, 1.0, queuedItems.Value("test-metrics"))
+	assert.Equal(t, 0.0, queuedItems.Value("test-metrics-other"))
+}
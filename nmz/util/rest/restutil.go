@@ -26,10 +26,15 @@ import (
 // Namazu REST API Root string
 const APIRoot = "/api/v3"
 
-// Write err to both of stdout and w
+// Write err to both of stdout and w, with status 500
 func WriteError(w http.ResponseWriter, err error) {
-	log.Errorf("this error will be also written to http: %s", err)
-	http.Error(w, err.Error(), http.StatusInternalServerError)
+	WriteErrorWithStatus(w, err, http.StatusInternalServerError)
+}
+
+// Write err to both of stdout and w, with the status code (e.g. http.StatusBadRequest)
+func WriteErrorWithStatus(w http.ResponseWriter, err error, code int) {
+	log.Errorf("this error will be also written to http (%d): %s", code, err)
+	http.Error(w, err.Error(), code)
 	w.(http.Flusher).Flush()
 }
 
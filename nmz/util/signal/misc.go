@@ -16,7 +16,11 @@
 // can we remove this?
 package signal
 
-import . "github.com/osrg/namazu/nmz/signal"
+import (
+	"reflect"
+
+	. "github.com/osrg/namazu/nmz/signal"
+)
 
 // can we remove this?
 func AreActionsSliceEqual(a, b []Action) bool {
@@ -33,3 +37,34 @@ func AreActionsSliceEqual(a, b []Action) bool {
 	}
 	return true
 }
+
+func signalClass(jsonMap map[string]interface{}, value interface{}) string {
+	if class, ok := jsonMap["class"].(string); ok {
+		return class
+	}
+	t := reflect.TypeOf(value)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// Returns the class name of the event (e.g. "PacketEvent")
+func EventClass(event Event) string {
+	return signalClass(event.JSONMap(), event)
+}
+
+// Returns the class name of the action (e.g. "PacketFaultAction")
+func ActionClass(action Action) string {
+	return signalClass(action.JSONMap(), action)
+}
+
+// Returns true if the action injects a fault rather than accepting the event
+func IsFaultAction(action Action) bool {
+	switch action.(type) {
+	case *PacketFaultAction, *FilesystemFaultAction, *ShellAction,
+		*FailpointErrorAction, *FailpointPanicAction, *FailpointSleepAction:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package signature provides extraction of failure signatures from the output and the logs of failing runs.
+//
+// A signature identifies a bug rather than a run, so that failing runs can be grouped into buckets.
+// e.g. "java.lang.IllegalStateException at org.example.Foo.bar, org.example.Foo.baz"
+package signature
+
+import (
+	"regexp"
+	"strings"
+)
+
+// default number of the stack frames in a signature
+const DefaultNrFrames = 3
+
+var (
+	// "Exception in thread "main" java.lang.IllegalStateException: boom", "Caused by: java.io.IOException"
+	javaExceptionRegexp = regexp.MustCompile(`(?:^|\s)((?:[A-Za-z_$][\w$]*\.)+[A-Z][\w$]*(?:Exception|Error|Throwable))(?::|$)`)
+	// "	at org.example.Foo.bar(Foo.java:42)"
+	javaFrameRegexp = regexp.MustCompile(`^\s+at\s+([\w$.<>/]+)\(`)
+
+	pythonTracebackRegexp = regexp.MustCompile(`^Traceback \(most recent call last\):`)
+	// "  File "foo.py", line 42, in bar"
+	pythonFrameRegexp = regexp.MustCompile(`^\s+File "[^"]*", line \d+, in (\S+)`)
+	// "ValueError: boom"
+	pythonExceptionRegexp = regexp.MustCompile(`^([A-Za-z_][\w.]*(?:Error|Exception|Exit|Interrupt|Warning))(?::|$)`)
+
+	// "panic: runtime error: index out of range"
+	goPanicRegexp = regexp.MustCompile(`^panic: (.*)`)
+	// "main.foo(0x2a, ...)", "github.com/example/pkg.(*T).M(...)"
+	goFrameRegexp = regexp.MustCompile(`^([\w./*()-]+)\(.*\)$`)
+
+	// time-dependent or run-dependent tokens in a message
+	numberRegexp = regexp.MustCompile(`0x[0-9a-fA-F]+|\d+`)
+)
+
+type Extractor struct {
+	// if non-nil, the first match is used as the signature (the submatches joined with " ", if any).
+	// if it does not match, the stack traces are used.
+	Regexp *regexp.Regexp
+	// number of the stack frames in a signature
+	NrFrames int
+}
+
+func NewExtractor() *Extractor {
+	return &Extractor{NrFrames: DefaultNrFrames}
+}
+
+// returns an empty string if no signature is found
+func (e *Extractor) Extract(text string) string {
+	if e.Regexp != nil {
+		if s := e.extractRegexp(text); s != "" {
+			return s
+		}
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if m := goPanicRegexp.FindStringSubmatch(line); m != nil {
+			return e.goSignature(m[1], lines[i+1:])
+		}
+		if pythonTracebackRegexp.MatchString(line) {
+			if s := e.pythonSignature(lines[i+1:]); s != "" {
+				return s
+			}
+			continue
+		}
+		if m := javaExceptionRegexp.FindStringSubmatch(line); m != nil {
+			return e.javaSignature(m[1], lines[i+1:])
+		}
+	}
+	return ""
+}
+
+func (e *Extractor) extractRegexp(text string) string {
+	m := e.Regexp.FindStringSubmatch(text)
+	if m == nil {
+		return ""
+	}
+	if len(m) == 1 {
+		return strings.TrimSpace(m[0])
+	}
+	groups := make([]string, 0, len(m)-1)
+	for _, g := range m[1:] {
+		if g != "" {
+			groups = append(groups, g)
+		}
+	}
+	return strings.Join(groups, " ")
+}
+
+func (e *Extractor) format(class string, frames []string) string {
+	if len(frames) == 0 {
+		return class
+	}
+	return class + " at " + strings.Join(frames, ", ")
+}
+
+func (e *Extractor) javaSignature(class string, lines []string) string {
+	frames := make([]string, 0, e.NrFrames)
+	for _, line := range lines {
+		if len(frames) >= e.NrFrames {
+			break
+		}
+		m := javaFrameRegexp.FindStringSubmatch(line)
+		if m == nil {
+			break
+		}
+		frames = append(frames, m[1])
+	}
+	return e.format(class, frames)
+}
+
+func (e *Extractor) pythonSignature(lines []string) string {
+	// most recent call last
+	frames := make([]string, 0)
+	for _, line := range lines {
+		if m := pythonFrameRegexp.FindStringSubmatch(line); m != nil {
+			frames = append(frames, m[1])
+			continue
+		}
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			// source line of the frame
+			continue
+		}
+		m := pythonExceptionRegexp.FindStringSubmatch(line)
+		if m == nil {
+			return ""
+		}
+		top := make([]string, 0, e.NrFrames)
+		for i := len(frames) - 1; i >= 0 && len(top) < e.NrFrames; i-- {
+			top = append(top, frames[i])
+		}
+		return e.format(m[1], top)
+	}
+	return ""
+}
+
+func (e *Extractor) goSignature(message string, lines []string) string {
+	class := "panic: " + numberRegexp.ReplaceAllString(strings.TrimSpace(message), "N")
+	frames := make([]string, 0, e.NrFrames)
+	inGoroutine := false
+	for _, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, "goroutine ") {
+			if inGoroutine {
+				break
+			}
+			inGoroutine = true
+			continue
+		}
+		if !inGoroutine || strings.HasPrefix(line, "\t") {
+			continue
+		}
+		if line == "" {
+			if len(frames) > 0 {
+				break
+			}
+			continue
+		}
+		m := goFrameRegexp.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if strings.HasPrefix(m[1], "panic") || strings.HasPrefix(m[1], "runtime.") {
+			// the frames of the panic itself
+			continue
+		}
+		frames = append(frames, m[1])
+		if len(frames) >= e.NrFrames {
+			break
+		}
+	}
+	return e.format(class, frames)
+}
@@ -0,0 +1,74 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signature
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const javaOutput = `checking the cluster
+Exception in thread "main" java.lang.IllegalStateException: leader not found (term=42)
+	at org.example.Cluster.leader(Cluster.java:120)
+	at org.example.Cluster.write(Cluster.java:80)
+	at org.example.Client.put(Client.java:33)
+	at org.example.Main.main(Main.java:12)
+`
+
+const pythonOutput = `Traceback (most recent call last):
+  File "validate.py", line 30, in <module>
+    main()
+  File "validate.py", line 25, in main
+    check(nodes)
+  File "validate.py", line 12, in check
+    raise AssertionError("inconsistent: %d" % n)
+AssertionError: inconsistent: 3
+`
+
+const goOutput = `panic: runtime error: index out of range [5] with length 3
+
+goroutine 1 [running]:
+main.lookup(...)
+	/src/main.go:20
+main.main()
+	/src/main.go:12 +0x1d
+exit status 2
+`
+
+func TestExtract(t *testing.T) {
+	e := NewExtractor()
+	assert.Equal(t, "java.lang.IllegalStateException at org.example.Cluster.leader, org.example.Cluster.write, org.example.Client.put", e.Extract(javaOutput))
+	assert.Equal(t, "AssertionError at check, main, <module>", e.Extract(pythonOutput))
+	assert.Equal(t, "panic: runtime error: index out of range [N] with length N at main.lookup, main.main", e.Extract(goOutput))
+	assert.Equal(t, "", e.Extract("validation failed\n"))
+
+	e.NrFrames = 1
+	assert.Equal(t, "java.lang.IllegalStateException at org.example.Cluster.leader", e.Extract(javaOutput))
+}
+
+func TestExtractRegexp(t *testing.T) {
+	e := NewExtractor()
+	e.Regexp = regexp.MustCompile(`(inconsistent|leader not found)`)
+	assert.Equal(t, "leader not found", e.Extract(javaOutput))
+	assert.Equal(t, "inconsistent", e.Extract(pythonOutput))
+	// falls back to the stack traces
+	assert.Equal(t, "panic: runtime error: index out of range [N] with length N at main.lookup, main.main", e.Extract(goOutput))
+
+	e.Regexp = regexp.MustCompile(`checking \w+`)
+	assert.Equal(t, "checking the", e.Extract(javaOutput))
+}
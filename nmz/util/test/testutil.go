@@ -16,9 +16,14 @@
 package test
 
 import (
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/osrg/namazu/nmz/historystorage/naive"
 	"github.com/osrg/namazu/nmz/signal"
+	. "github.com/osrg/namazu/nmz/util/trace"
 	"github.com/stretchr/testify/assert"
-	"testing"
 )
 
 // used only for testing
@@ -36,3 +41,29 @@ func NewPacketEvent(t *testing.T, entityID string, value int) signal.Event {
 	assert.NoError(t, err)
 	return event
 }
+
+// used only for testing.
+// creates a naive history storage in a temporary dir, which can be loaded with historystorage.LoadStorage().
+// the caller should remove the dir.
+func NewNaiveStorage(t *testing.T, prefix string) string {
+	dir, err := ioutil.TempDir("", prefix)
+	assert.NoError(t, err)
+	// historystorage.StorageTOMLConfigPath (not imported, as historystorage uses this package in its tests)
+	err = ioutil.WriteFile(path.Join(dir, "config.toml"), []byte("storageType = \"naive\"\n"), 0644)
+	assert.NoError(t, err)
+	assert.NoError(t, naive.New(dir).CreateStorage())
+	return dir
+}
+
+// used only for testing.
+// starts a new run in the naive history storage, and records trace if non-nil.
+// the caller should record the result to the returned storage.
+func NewNaiveRun(t *testing.T, dir string, trace *SingleTrace) *naive.Naive {
+	n := naive.New(dir)
+	n.Init()
+	n.CreateNewWorkingDir()
+	if trace != nil {
+		n.RecordNewTrace(trace)
+	}
+	return n
+}
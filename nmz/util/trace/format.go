@@ -0,0 +1,258 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"bufio"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/osrg/namazu/nmz/signal"
+)
+
+// Trace file format (see doc/arch.md)
+//
+// A trace is encoded in JSON Lines. The first line is the header, and each following line is an action:
+//
+//	{"format":"nmz-trace","version":1,"nr_actions":2}
+//	{"action":{"class":"PacketFaultAction",...},"triggered_time":"...","event":{"class":"PacketEvent",...}}
+//	...
+//
+// Unlike the legacy gob encoding, it does not depend on the registration and the layouts of the Go types of the signals,
+// so that old traces can be read after the signal types change, and non-Go tools can read traces.
+const (
+	TraceFormatName = "nmz-trace"
+	// incremented on incompatible changes. readers reject traces with newer versions.
+	TraceFormatVersion = 1
+)
+
+type TraceFormat string
+
+const (
+	TraceFormatJSONL TraceFormat = "jsonl"
+	// legacy (written before the JSONL format was introduced)
+	TraceFormatGob TraceFormat = "gob"
+)
+
+func ParseTraceFormat(s string) (TraceFormat, error) {
+	switch f := TraceFormat(s); f {
+	case TraceFormatJSONL, TraceFormatGob:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown trace format %q (should be %s or %s)", s, TraceFormatJSONL, TraceFormatGob)
+	}
+}
+
+type traceHeader struct {
+	Format    string `json:"format"`
+	Version   int    `json:"version"`
+	NrActions int    `json:"nr_actions"`
+}
+
+// times are omitted if zero
+type traceRecord struct {
+	Action           json.RawMessage `json:"action"`
+	ArrivedTime      *time.Time      `json:"arrived_time,omitempty"`
+	TriggeredTime    *time.Time      `json:"triggered_time,omitempty"`
+	Event            json.RawMessage `json:"event,omitempty"`
+	EventArrivedTime *time.Time      `json:"event_arrived_time,omitempty"`
+}
+
+// implemented by signal.BasicAction
+type eventSetter interface {
+	SetEvent(signal.Event)
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func timeOrZero(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+func EncodeTrace(w io.Writer, trace *SingleTrace, format TraceFormat) error {
+	switch format {
+	case TraceFormatJSONL:
+		return encodeJSONL(w, trace)
+	case TraceFormatGob:
+		return gob.NewEncoder(w).Encode(trace)
+	default:
+		return fmt.Errorf("unknown trace format %q", format)
+	}
+}
+
+func encodeJSONL(w io.Writer, trace *SingleTrace) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	header := traceHeader{
+		Format:    TraceFormatName,
+		Version:   TraceFormatVersion,
+		NrActions: len(trace.ActionSequence),
+	}
+	if err := enc.Encode(&header); err != nil {
+		return err
+	}
+	for i, act := range trace.ActionSequence {
+		actJSON, err := json.Marshal(act.JSONMap())
+		if err != nil {
+			return fmt.Errorf("failed to encode action %d: %s", i, err)
+		}
+		rec := traceRecord{
+			Action:        actJSON,
+			ArrivedTime:   timeOrNil(act.ArrivedTime()),
+			TriggeredTime: timeOrNil(act.TriggeredTime()),
+		}
+		if evt := act.Event(); evt != nil {
+			if rec.Event, err = json.Marshal(evt.JSONMap()); err != nil {
+				return fmt.Errorf("failed to encode the event of action %d: %s", i, err)
+			}
+			rec.EventArrivedTime = timeOrNil(evt.ArrivedTime())
+		}
+		if err = enc.Encode(&rec); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// decodes a trace in either format (a JSONL trace starts with '{')
+func DecodeTrace(r io.Reader) (*SingleTrace, TraceFormat, error) {
+	br := bufio.NewReader(r)
+	b, err := br.Peek(1)
+	if err != nil {
+		return nil, "", err
+	}
+	if b[0] == '{' {
+		trace, err := decodeJSONL(br)
+		return trace, TraceFormatJSONL, err
+	}
+	var trace SingleTrace
+	if err = gob.NewDecoder(br).Decode(&trace); err != nil {
+		return nil, TraceFormatGob, err
+	}
+	return &trace, TraceFormatGob, nil
+}
+
+func decodeJSONL(r io.Reader) (*SingleTrace, error) {
+	dec := json.NewDecoder(r)
+	var header traceHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("bad trace header: %s", err)
+	}
+	if header.Format != TraceFormatName {
+		return nil, fmt.Errorf("not a %s file (format: %q)", TraceFormatName, header.Format)
+	}
+	if header.Version < 1 || header.Version > TraceFormatVersion {
+		return nil, fmt.Errorf("unsupported trace format version %d (supported: 1-%d)", header.Version, TraceFormatVersion)
+	}
+	trace := &SingleTrace{ActionSequence: make([]signal.Action, 0, header.NrActions)}
+	for {
+		var rec traceRecord
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad record %d: %s", len(trace.ActionSequence), err)
+		}
+		act, err := decodeRecord(&rec)
+		if err != nil {
+			return nil, fmt.Errorf("bad record %d: %s", len(trace.ActionSequence), err)
+		}
+		trace.ActionSequence = append(trace.ActionSequence, act)
+	}
+	if len(trace.ActionSequence) != header.NrActions {
+		return nil, fmt.Errorf("truncated trace (%d of %d actions)", len(trace.ActionSequence), header.NrActions)
+	}
+	return trace, nil
+}
+
+func decodeRecord(rec *traceRecord) (signal.Action, error) {
+	if len(rec.Action) == 0 {
+		return nil, fmt.Errorf("no action")
+	}
+	sig, err := signal.NewSignalFromJSONString(string(rec.Action), timeOrZero(rec.ArrivedTime))
+	if err != nil {
+		return nil, err
+	}
+	act, ok := sig.(signal.Action)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an action", sig)
+	}
+	act.SetTriggeredTime(timeOrZero(rec.TriggeredTime))
+	if len(rec.Event) == 0 {
+		return act, nil
+	}
+	sig, err = signal.NewSignalFromJSONString(string(rec.Event), timeOrZero(rec.EventArrivedTime))
+	if err != nil {
+		return nil, err
+	}
+	evt, ok := sig.(signal.Event)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an event", sig)
+	}
+	setter, ok := act.(eventSetter)
+	if !ok {
+		return nil, fmt.Errorf("cannot set the event to %s", act)
+	}
+	setter.SetEvent(evt)
+	return act, nil
+}
+
+func LoadTraceFile(path string) (*SingleTrace, TraceFormat, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	return DecodeTrace(f)
+}
+
+// the file is replaced atomically
+func SaveTraceFile(path string, trace *SingleTrace, format TraceFormat) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if err = EncodeTrace(tmp, trace, format); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	// TempFile creates the file with 0600
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,125 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/osrg/namazu/nmz/signal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	signal.RegisterKnownSignals()
+	os.Exit(m.Run())
+}
+
+func newTestTrace(t *testing.T) *SingleTrace {
+	now := time.Now()
+	event, err := signal.NewFilesystemEvent("zksrv1", signal.PreFsync, "/data/log", map[string]interface{}{})
+	assert.NoError(t, err)
+	event.(*signal.FilesystemEvent).SetArrivedTime(now)
+	fault, err := signal.NewFilesystemFaultAction(event)
+	assert.NoError(t, err)
+	fault.SetTriggeredTime(now.Add(42 * time.Millisecond))
+	shell, err := signal.NewShellAction("true", map[string]interface{}{"value": 1})
+	assert.NoError(t, err)
+	return &SingleTrace{ActionSequence: []signal.Action{fault, shell}}
+}
+
+func assertSameTrace(t *testing.T, expected, actual *SingleTrace) {
+	assert.Len(t, actual.ActionSequence, len(expected.ActionSequence))
+	for i, act := range expected.ActionSequence {
+		got := actual.ActionSequence[i]
+		assert.Equal(t, act.ID(), got.ID())
+		assert.Equal(t, act.JSONMap()["class"], got.JSONMap()["class"])
+		assert.True(t, act.TriggeredTime().Equal(got.TriggeredTime()))
+		if act.Event() == nil {
+			assert.Nil(t, got.Event())
+			continue
+		}
+		assert.Equal(t, act.Event().ID(), got.Event().ID())
+		assert.Equal(t, act.Event().ReplayHint(), got.Event().ReplayHint())
+		assert.True(t, act.Event().ArrivedTime().Equal(got.Event().ArrivedTime()))
+	}
+}
+
+func TestJSONLTrace(t *testing.T) {
+	trace := newTestTrace(t)
+	var buf bytes.Buffer
+	assert.NoError(t, EncodeTrace(&buf, trace, TraceFormatJSONL))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Equal(t, `{"format":"nmz-trace","version":1,"nr_actions":2}`, lines[0])
+
+	decoded, format, err := DecodeTrace(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, TraceFormatJSONL, format)
+	assertSameTrace(t, trace, decoded)
+	option := decoded.ActionSequence[0].Event().JSONMap()["option"].(map[string]interface{})
+	assert.Equal(t, "pre-fsync", option["op"])
+
+	// decoded traces are stable
+	var buf2 bytes.Buffer
+	assert.NoError(t, EncodeTrace(&buf2, decoded, TraceFormatJSONL))
+	decoded2, _, err := DecodeTrace(&buf2)
+	assert.NoError(t, err)
+	assert.True(t, decoded.Equals(decoded2))
+}
+
+func TestBadJSONLTrace(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, EncodeTrace(&buf, newTestTrace(t), TraceFormatJSONL))
+	lines := strings.SplitAfter(buf.String(), "\n")
+
+	_, _, err := DecodeTrace(strings.NewReader(lines[0] + lines[1]))
+	assert.Error(t, err, "truncated")
+
+	_, _, err = DecodeTrace(strings.NewReader(`{"format":"nmz-trace","version":42,"nr_actions":0}`))
+	assert.Error(t, err, "newer version")
+
+	_, _, err = DecodeTrace(strings.NewReader(`{"format":"foo","version":1,"nr_actions":0}`))
+	assert.Error(t, err, "not a trace")
+}
+
+func TestLegacyGobTrace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-trace")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	trace := newTestTrace(t)
+
+	gobPath := path.Join(dir, "history.gob")
+	assert.NoError(t, SaveTraceFile(gobPath, trace, TraceFormatGob))
+	decoded, format, err := LoadTraceFile(gobPath)
+	assert.NoError(t, err)
+	assert.Equal(t, TraceFormatGob, format)
+	assert.True(t, trace.Equals(decoded))
+
+	jsonlPath := path.Join(dir, "history")
+	assert.NoError(t, SaveTraceFile(jsonlPath, decoded, TraceFormatJSONL))
+	decoded, format, err = LoadTraceFile(jsonlPath)
+	assert.NoError(t, err)
+	assert.Equal(t, TraceFormatJSONL, format)
+	assertSameTrace(t, trace, decoded)
+}
@@ -0,0 +1,270 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/osrg/namazu/nmz/signal"
+	signalutil "github.com/osrg/namazu/nmz/util/signal"
+)
+
+// OTLP-JSON (OpenTelemetry protocol, JSON encoding) structures.
+// Only the subset needed for exporting traces is implemented, so that we do not need any OpenTelemetry library.
+// See https://github.com/open-telemetry/opentelemetry-proto
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"` // int64 is encoded as a string
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpLink struct {
+	TraceID string `json:"traceId"`
+	SpanID  string `json:"spanId"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Links             []otlpLink     `json:"links,omitempty"`
+	Status            *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTracesData struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusCodeError  = 2
+)
+
+func otlpString(k, v string) otlpKeyValue {
+	return otlpKeyValue{Key: k, Value: otlpAnyValue{StringValue: &v}}
+}
+
+func otlpBool(k string, v bool) otlpKeyValue {
+	return otlpKeyValue{Key: k, Value: otlpAnyValue{BoolValue: &v}}
+}
+
+func otlpInt(k string, v int64) otlpKeyValue {
+	s := strconv.FormatInt(v, 10)
+	return otlpKeyValue{Key: k, Value: otlpAnyValue{IntValue: &s}}
+}
+
+func otlpValue(k string, v interface{}) otlpKeyValue {
+	switch x := v.(type) {
+	case string:
+		return otlpString(k, x)
+	case bool:
+		return otlpBool(k, x)
+	case int:
+		return otlpInt(k, int64(x))
+	case int64:
+		return otlpInt(k, x)
+	case float64:
+		return otlpKeyValue{Key: k, Value: otlpAnyValue{DoubleValue: &x}}
+	default:
+		return otlpString(k, fmt.Sprintf("%v", x))
+	}
+}
+
+// flattens the "option" of the signal to attributes (sorted by key)
+func otlpOptionAttributes(prefix string, jsonMap map[string]interface{}) []otlpKeyValue {
+	option, ok := jsonMap["option"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	keys := make([]string, 0, len(option))
+	for k := range option {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, otlpValue(prefix+k, option[k]))
+	}
+	return attrs
+}
+
+func otlpID(s string, size int) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:size])
+}
+
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// derived from the action IDs and the time of the first action, so that it is unique to the run
+// and stable across the exports (an empty trace has no span, so its trace ID is never used)
+func (this *SingleTrace) otlpTraceID() string {
+	h := sha1.New()
+	if len(this.ActionSequence) > 0 {
+		io.WriteString(h, otlpTime(this.ActionSequence[0].TriggeredTime()))
+	}
+	for _, act := range this.ActionSequence {
+		io.WriteString(h, act.ID())
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// Returns the event span and the action span.
+// The event span covers the time the event was deferred (i.e. the injected delay),
+// and the action span is a child of the event span (and also linked to it).
+// If the action has no event, eventSpan is nil.
+func otlpSpans(traceID string, action signal.Action) (eventSpan *otlpSpan, actionSpan otlpSpan) {
+	triggered := action.TriggeredTime()
+	actionSpan = otlpSpan{
+		TraceID:           traceID,
+		SpanID:            otlpID(action.ID(), 8),
+		Name:              signalutil.ActionClass(action),
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: otlpTime(triggered),
+		EndTimeUnixNano:   otlpTime(triggered),
+		Attributes: []otlpKeyValue{
+			otlpString("nmz.action.uuid", action.ID()),
+			otlpString("nmz.action.class", signalutil.ActionClass(action)),
+			otlpString("nmz.entity", action.EntityID()),
+			otlpBool("nmz.fault", signalutil.IsFaultAction(action)),
+		},
+	}
+	actionSpan.Attributes = append(actionSpan.Attributes, otlpOptionAttributes("nmz.action.option.", action.JSONMap())...)
+	if signalutil.IsFaultAction(action) {
+		actionSpan.Status = &otlpStatus{Code: otlpStatusCodeError, Message: "fault injected"}
+	}
+
+	event := action.Event()
+	if event == nil {
+		return nil, actionSpan
+	}
+	arrived := event.ArrivedTime()
+	if arrived.IsZero() || arrived.After(triggered) {
+		arrived = triggered
+	}
+	delay := triggered.Sub(arrived)
+	eventSpan = &otlpSpan{
+		TraceID:           traceID,
+		SpanID:            otlpID(event.ID(), 8),
+		Name:              signalutil.EventClass(event),
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: otlpTime(arrived),
+		EndTimeUnixNano:   otlpTime(triggered),
+		Attributes: []otlpKeyValue{
+			otlpString("nmz.event.uuid", event.ID()),
+			otlpString("nmz.event.class", signalutil.EventClass(event)),
+			otlpString("nmz.entity", event.EntityID()),
+			otlpBool("nmz.event.deferred", event.Deferred()),
+			otlpString("nmz.event.replay_hint", event.ReplayHint()),
+			otlpInt("nmz.delay_ns", int64(delay)),
+			otlpString("nmz.action.class", signalutil.ActionClass(action)),
+			otlpBool("nmz.fault", signalutil.IsFaultAction(action)),
+		},
+	}
+	eventSpan.Attributes = append(eventSpan.Attributes, otlpOptionAttributes("nmz.event.option.", event.JSONMap())...)
+	actionSpan.ParentSpanID = eventSpan.SpanID
+	actionSpan.Links = []otlpLink{{TraceID: traceID, SpanID: eventSpan.SpanID}}
+	actionSpan.Attributes = append(actionSpan.Attributes,
+		otlpString("nmz.event.uuid", event.ID()),
+		otlpInt("nmz.delay_ns", int64(delay)))
+	return eventSpan, actionSpan
+}
+
+// Writes the trace as OTLP-JSON, which can be loaded into Jaeger and other trace viewers.
+//
+// Each entity is exported as a separate service ("service.name").
+// For each action, a span for the event (from its arrival to the action) and a span for the action are exported.
+func (this *SingleTrace) WriteOTLPJSON(w io.Writer) error {
+	traceID := this.otlpTraceID()
+	spansPerEntity := make(map[string][]otlpSpan)
+	for _, act := range this.ActionSequence {
+		eventSpan, actionSpan := otlpSpans(traceID, act)
+		if eventSpan != nil {
+			entityID := act.Event().EntityID()
+			spansPerEntity[entityID] = append(spansPerEntity[entityID], *eventSpan)
+		}
+		spansPerEntity[act.EntityID()] = append(spansPerEntity[act.EntityID()], actionSpan)
+	}
+
+	entities := make([]string, 0, len(spansPerEntity))
+	for entityID := range spansPerEntity {
+		entities = append(entities, entityID)
+	}
+	sort.Strings(entities)
+
+	data := otlpTracesData{ResourceSpans: make([]otlpResourceSpans, 0, len(entities))}
+	for _, entityID := range entities {
+		data.ResourceSpans = append(data.ResourceSpans, otlpResourceSpans{
+			Resource: otlpResource{
+				Attributes: []otlpKeyValue{
+					otlpString("service.name", entityID),
+					otlpString("service.namespace", "namazu"),
+				},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "github.com/osrg/namazu"},
+				Spans: spansPerEntity[entityID],
+			}},
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
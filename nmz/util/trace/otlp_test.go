@@ -0,0 +1,66 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/osrg/namazu/nmz/signal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteOTLPJSON(t *testing.T) {
+	now := time.Now()
+	event, err := signal.NewPacketEvent("zksrv1", "zksrv1", "zksrv2", map[string]interface{}{})
+	assert.NoError(t, err)
+	event.(*signal.PacketEvent).SetArrivedTime(now)
+	action, err := signal.NewPacketFaultAction(event)
+	assert.NoError(t, err)
+	action.SetTriggeredTime(now.Add(42 * time.Millisecond))
+	trace := &SingleTrace{ActionSequence: []signal.Action{action}}
+
+	var buf bytes.Buffer
+	assert.NoError(t, trace.WriteOTLPJSON(&buf))
+	t.Logf("%s", buf.String())
+
+	var data otlpTracesData
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &data))
+	assert.Len(t, data.ResourceSpans, 1)
+	assert.Equal(t, "zksrv1", *data.ResourceSpans[0].Resource.Attributes[0].Value.StringValue)
+	spans := data.ResourceSpans[0].ScopeSpans[0].Spans
+	assert.Len(t, spans, 2)
+	eventSpan, actionSpan := spans[0], spans[1]
+	assert.Equal(t, "PacketEvent", eventSpan.Name)
+	assert.Equal(t, "PacketFaultAction", actionSpan.Name)
+	assert.Len(t, eventSpan.TraceID, 32)
+	assert.Len(t, eventSpan.SpanID, 16)
+	assert.Equal(t, eventSpan.TraceID, actionSpan.TraceID)
+	assert.Equal(t, trace.otlpTraceID(), eventSpan.TraceID)
+	assert.Equal(t, eventSpan.SpanID, actionSpan.ParentSpanID)
+	assert.Equal(t, eventSpan.SpanID, actionSpan.Links[0].SpanID)
+	assert.Equal(t, otlpStatusCodeError, actionSpan.Status.Code)
+
+	attrs := make(map[string]otlpAnyValue)
+	for _, kv := range eventSpan.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	assert.Equal(t, "42000000", *attrs["nmz.delay_ns"].IntValue)
+	assert.True(t, *attrs["nmz.fault"].BoolValue)
+	assert.Equal(t, "zksrv2", *attrs["nmz.event.option.dst_entity"].StringValue)
+}
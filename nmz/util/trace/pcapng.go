@@ -0,0 +1,209 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/osrg/namazu/nmz/signal"
+	signalutil "github.com/osrg/namazu/nmz/util/signal"
+)
+
+// pcapng (https://github.com/pcapng/pcapng) block types and options.
+// Only the blocks needed for exporting packets are implemented, so that we do not need libpcap.
+const (
+	pcapngBlockTypeSHB = 0x0A0D0D0A
+	pcapngBlockTypeIDB = 0x00000001
+	pcapngBlockTypeEPB = 0x00000006
+
+	pcapngByteOrderMagic = 0x1A2B3C4D
+
+	pcapngOptEndOfOpt    = 0
+	pcapngOptComment     = 1
+	pcapngOptShbUserAppl = 4
+	pcapngOptIfTsresol   = 9
+
+	pcapngLinkTypeEthernet = 1
+	pcapngSnapLen          = 0 // no limit
+)
+
+// a packet inspected by the Ethernet inspectors, and what nmz did to it
+type pcapngPacket struct {
+	bytes  []byte
+	action signal.Action
+	event  signal.Event
+}
+
+type pcapngPacketsByArrivedTime []pcapngPacket
+
+func (p pcapngPacketsByArrivedTime) Len() int      { return len(p) }
+func (p pcapngPacketsByArrivedTime) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p pcapngPacketsByArrivedTime) Less(i, j int) bool {
+	return p[i].event.ArrivedTime().Before(p[j].event.ArrivedTime())
+}
+
+// Returns the packet bytes of the PacketEvent.
+// The bytes are []byte when the event came from an inspector, and base64 string when the trace was loaded from JSON.
+func packetEventBytes(event signal.Event) ([]byte, bool) {
+	if signalutil.EventClass(event) != "PacketEvent" {
+		return nil, false
+	}
+	option, ok := event.JSONMap()["option"].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	switch b := option["bytes"].(type) {
+	case []byte:
+		return b, len(b) > 0
+	case string:
+		decoded, err := base64.StdEncoding.DecodeString(b)
+		if err != nil {
+			return nil, false
+		}
+		return decoded, len(decoded) > 0
+	}
+	return nil, false
+}
+
+// Returns the packets in the trace, sorted by the arrival time
+func (this *SingleTrace) pcapngPackets() []pcapngPacket {
+	var packets []pcapngPacket
+	for _, act := range this.ActionSequence {
+		event := act.Event()
+		if event == nil {
+			continue
+		}
+		b, ok := packetEventBytes(event)
+		if !ok {
+			continue
+		}
+		packets = append(packets, pcapngPacket{bytes: b, action: act, event: event})
+	}
+	sort.Stable(pcapngPacketsByArrivedTime(packets))
+	return packets
+}
+
+// Returns the number of the packets which can be written by WritePcapng
+func (this *SingleTrace) NrPackets() int {
+	return len(this.pcapngPackets())
+}
+
+// Returns the comments for the packet, e.g.
+//
+//	nmz: accepted, delayed 12.3ms
+//	nmz: event 1ff0..., action EventAcceptanceAction 5ce1..., entity zksrv1, zksrv1->zksrv2
+func (this pcapngPacket) comments() []string {
+	triggered := this.action.TriggeredTime()
+	arrived := this.event.ArrivedTime()
+	if arrived.IsZero() || arrived.After(triggered) {
+		arrived = triggered
+	}
+	delay := triggered.Sub(arrived)
+
+	verdict := "accepted"
+	if signalutil.IsFaultAction(this.action) {
+		verdict = "dropped"
+	}
+	if delay > 0 {
+		verdict += fmt.Sprintf(", delayed %s", delay)
+	} else {
+		verdict += ", not delayed"
+	}
+
+	detail := fmt.Sprintf("nmz: event %s, action %s %s, entity %s",
+		this.event.ID(), signalutil.ActionClass(this.action), this.action.ID(), this.event.EntityID())
+	if option, ok := this.event.JSONMap()["option"].(map[string]interface{}); ok {
+		detail += fmt.Sprintf(", %v->%v", option["src_entity"], option["dst_entity"])
+	}
+	return []string{"nmz: " + verdict, detail}
+}
+
+func pcapngOption(buf *bytes.Buffer, code uint16, value []byte) {
+	binary.Write(buf, binary.LittleEndian, code)
+	binary.Write(buf, binary.LittleEndian, uint16(len(value)))
+	buf.Write(value)
+	buf.Write(make([]byte, (4-len(value)%4)%4))
+}
+
+func writePcapngBlock(w io.Writer, blockType uint32, body []byte) error {
+	buf := new(bytes.Buffer)
+	total := uint32(12 + len(body))
+	binary.Write(buf, binary.LittleEndian, blockType)
+	binary.Write(buf, binary.LittleEndian, total)
+	buf.Write(body)
+	binary.Write(buf, binary.LittleEndian, total)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Writes the packets in the trace as pcapng, which can be loaded into Wireshark.
+//
+// The timestamp of each packet is the time it arrived at the inspector (in nanoseconds).
+// What nmz did to the packet (accepted or dropped, and the injected delay) is written as the packet comments.
+// Actions without packets (e.g. filesystem events) are not written.
+func (this *SingleTrace) WritePcapng(w io.Writer) error {
+	// Section Header Block
+	shb := new(bytes.Buffer)
+	binary.Write(shb, binary.LittleEndian, uint32(pcapngByteOrderMagic))
+	binary.Write(shb, binary.LittleEndian, uint16(1)) // major version
+	binary.Write(shb, binary.LittleEndian, uint16(0)) // minor version
+	binary.Write(shb, binary.LittleEndian, int64(-1)) // section length (unspecified)
+	pcapngOption(shb, pcapngOptShbUserAppl, []byte("namazu"))
+	pcapngOption(shb, pcapngOptEndOfOpt, nil)
+	if err := writePcapngBlock(w, pcapngBlockTypeSHB, shb.Bytes()); err != nil {
+		return err
+	}
+
+	// Interface Description Block (all the packets are on the interface 0)
+	idb := new(bytes.Buffer)
+	binary.Write(idb, binary.LittleEndian, uint16(pcapngLinkTypeEthernet))
+	binary.Write(idb, binary.LittleEndian, uint16(0)) // reserved
+	binary.Write(idb, binary.LittleEndian, uint32(pcapngSnapLen))
+	pcapngOption(idb, pcapngOptIfTsresol, []byte{9}) // 10^-9 s
+	pcapngOption(idb, pcapngOptEndOfOpt, nil)
+	if err := writePcapngBlock(w, pcapngBlockTypeIDB, idb.Bytes()); err != nil {
+		return err
+	}
+
+	// Enhanced Packet Blocks
+	for _, p := range this.pcapngPackets() {
+		ts := uint64(p.event.ArrivedTime().UnixNano())
+		if p.event.ArrivedTime().IsZero() {
+			ts = uint64(p.action.TriggeredTime().UnixNano())
+		}
+		epb := new(bytes.Buffer)
+		binary.Write(epb, binary.LittleEndian, uint32(0)) // interface ID
+		binary.Write(epb, binary.LittleEndian, uint32(ts>>32))
+		binary.Write(epb, binary.LittleEndian, uint32(ts))
+		binary.Write(epb, binary.LittleEndian, uint32(len(p.bytes))) // captured length
+		binary.Write(epb, binary.LittleEndian, uint32(len(p.bytes))) // original length
+		epb.Write(p.bytes)
+		epb.Write(make([]byte, (4-len(p.bytes)%4)%4))
+		for _, comment := range p.comments() {
+			pcapngOption(epb, pcapngOptComment, []byte(comment))
+		}
+		pcapngOption(epb, pcapngOptEndOfOpt, nil)
+		if err := writePcapngBlock(w, pcapngBlockTypeEPB, epb.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/osrg/namazu/nmz/signal"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPcapngBlock struct {
+	blockType uint32
+	body      []byte
+}
+
+func readTestPcapngBlocks(t *testing.T, b []byte) []testPcapngBlock {
+	var blocks []testPcapngBlock
+	for len(b) > 0 {
+		assert.True(t, len(b) >= 12)
+		blockType := binary.LittleEndian.Uint32(b[0:4])
+		total := binary.LittleEndian.Uint32(b[4:8])
+		assert.Equal(t, uint32(0), total%4)
+		assert.Equal(t, total, binary.LittleEndian.Uint32(b[total-4:total]))
+		blocks = append(blocks, testPcapngBlock{blockType: blockType, body: b[8 : total-4]})
+		b = b[total:]
+	}
+	return blocks
+}
+
+// returns the timestamp, the packet bytes and the comments in the EPB
+func parseTestPcapngEPB(t *testing.T, body []byte) (uint64, []byte, []string) {
+	ts := uint64(binary.LittleEndian.Uint32(body[4:8]))<<32 | uint64(binary.LittleEndian.Uint32(body[8:12]))
+	capLen := int(binary.LittleEndian.Uint32(body[12:16]))
+	data := body[20 : 20+capLen]
+	opts := body[20+(capLen+3)/4*4:]
+	var comments []string
+	for len(opts) >= 4 {
+		code := binary.LittleEndian.Uint16(opts[0:2])
+		length := int(binary.LittleEndian.Uint16(opts[2:4]))
+		if code == pcapngOptEndOfOpt {
+			break
+		}
+		if code == pcapngOptComment {
+			comments = append(comments, string(opts[4:4+length]))
+		}
+		opts = opts[4+(length+3)/4*4:]
+	}
+	return ts, data, comments
+}
+
+func newTestPcapngTrace(t *testing.T, now time.Time) *SingleTrace {
+	newEvent := func(b []byte, arrived time.Time) signal.Event {
+		event, err := signal.NewPacketEvent("zksrv1", "zksrv1", "zksrv2", map[string]interface{}{"bytes": b})
+		assert.NoError(t, err)
+		event.(*signal.PacketEvent).SetArrivedTime(arrived)
+		return event
+	}
+	event1 := newEvent([]byte("first packet"), now)
+	event2 := newEvent([]byte("second"), now.Add(time.Millisecond))
+	// accepted after 42ms
+	action1, err := event1.DefaultAction()
+	assert.NoError(t, err)
+	action1.SetTriggeredTime(now.Add(42 * time.Millisecond))
+	// dropped immediately
+	action2, err := signal.NewPacketFaultAction(event2)
+	assert.NoError(t, err)
+	action2.SetTriggeredTime(now.Add(time.Millisecond))
+	// not a packet
+	nop, err := signal.NewNopAction("zksrv1", nil)
+	assert.NoError(t, err)
+	nop.SetTriggeredTime(now)
+	return &SingleTrace{ActionSequence: []signal.Action{action2, nop, action1}}
+}
+
+func testWritePcapng(t *testing.T, trace *SingleTrace, now time.Time) {
+	assert.Equal(t, 2, trace.NrPackets())
+	var buf bytes.Buffer
+	assert.NoError(t, trace.WritePcapng(&buf))
+	blocks := readTestPcapngBlocks(t, buf.Bytes())
+	assert.Len(t, blocks, 4)
+	assert.Equal(t, uint32(pcapngBlockTypeSHB), blocks[0].blockType)
+	assert.Equal(t, uint32(pcapngByteOrderMagic), binary.LittleEndian.Uint32(blocks[0].body[0:4]))
+	assert.Equal(t, uint32(pcapngBlockTypeIDB), blocks[1].blockType)
+	assert.Equal(t, uint16(pcapngLinkTypeEthernet), binary.LittleEndian.Uint16(blocks[1].body[0:2]))
+
+	// sorted by the arrival time
+	assert.Equal(t, uint32(pcapngBlockTypeEPB), blocks[2].blockType)
+	ts, data, comments := parseTestPcapngEPB(t, blocks[2].body)
+	assert.Equal(t, uint64(now.UnixNano()), ts)
+	assert.Equal(t, "first packet", string(data))
+	assert.Len(t, comments, 2)
+	assert.Equal(t, "nmz: accepted, delayed 42ms", comments[0])
+	assert.True(t, strings.HasSuffix(comments[1], "entity zksrv1, zksrv1->zksrv2"), comments[1])
+	assert.Contains(t, comments[1], "EventAcceptanceAction")
+
+	ts, data, comments = parseTestPcapngEPB(t, blocks[3].body)
+	assert.Equal(t, uint64(now.Add(time.Millisecond).UnixNano()), ts)
+	assert.Equal(t, "second", string(data))
+	assert.Equal(t, "nmz: dropped, not delayed", comments[0])
+	assert.Contains(t, comments[1], "PacketFaultAction")
+}
+
+func TestWritePcapng(t *testing.T) {
+	now := time.Unix(1445000000, 123456789)
+	trace := newTestPcapngTrace(t, now)
+	testWritePcapng(t, trace, now)
+
+	// the bytes are encoded in base64 in the stored trace
+	var buf bytes.Buffer
+	assert.NoError(t, EncodeTrace(&buf, trace, TraceFormatJSONL))
+	loaded, _, err := DecodeTrace(&buf)
+	assert.NoError(t, err)
+	testWritePcapng(t, loaded, now)
+}
+
+func TestWritePcapngNoPackets(t *testing.T) {
+	trace := &SingleTrace{}
+	assert.Equal(t, 0, trace.NrPackets())
+	var buf bytes.Buffer
+	assert.NoError(t, trace.WritePcapng(&buf))
+	assert.Len(t, readTestPcapngBlocks(t, buf.Bytes()), 2)
+}
@@ -0,0 +1,123 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package traceimport
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/osrg/namazu/nmz/inspector/ethernet/tcpwatcher"
+	"github.com/osrg/namazu/nmz/signal"
+	"github.com/osrg/namazu/nmz/util/packet"
+)
+
+// link types other than Ethernet, converted to Ethernet frames
+const (
+	linkTypeRaw      = 101
+	linkTypeLinuxSLL = 113
+	linkTypeIPv4     = 228
+
+	linuxSLLHeaderLen = 16
+	etherTypeIPv4     = 0x0800
+)
+
+type PacketOptions struct {
+	// entity ID of the events (i.e. of the Ethernet inspector)
+	EntityID string
+	// if non-empty, only the packets from/to these TCP ports are imported
+	Ports []int
+}
+
+// the same dummy header as the NFQ inspector's
+func withDummyEthernetHeader(b []byte) []byte {
+	dummyEth := []byte("\xff\xff\xff\xff\xff\xff" +
+		"\x00\x00\x00\x00\x00\x00" +
+		"\x08\x00")
+	return append(dummyEth, b...)
+}
+
+// returns nil for unsupported frames
+func ethernetBytes(p *capturedPacket) []byte {
+	switch p.linkType {
+	case linkTypeEthernet:
+		return p.data
+	case linkTypeRaw, linkTypeIPv4:
+		return withDummyEthernetHeader(p.data)
+	case linkTypeLinuxSLL:
+		if len(p.data) < linuxSLLHeaderLen || binary.BigEndian.Uint16(p.data[14:16]) != etherTypeIPv4 {
+			return nil
+		}
+		return withDummyEthernetHeader(p.data[linuxSLLHeaderLen:])
+	default:
+		return nil
+	}
+}
+
+func portMatches(ports []int, src, dst int) bool {
+	if len(ports) == 0 {
+		return true
+	}
+	for _, port := range ports {
+		if port == src || port == dst {
+			return true
+		}
+	}
+	return false
+}
+
+// reads a pcap (or pcapng) file, and returns PacketEvents for the TCP/IPv4 packets.
+// like the Ethernet inspector, TCP retransmissions are skipped.
+func PacketEvents(r io.Reader, opts PacketOptions) ([]signal.Event, error) {
+	packets, err := readCapture(r)
+	if err != nil {
+		return nil, err
+	}
+	watcher := tcpwatcher.New()
+	events := make([]signal.Event, 0, len(packets))
+	nrUnsupported := 0
+	for i := range packets {
+		b := ethernetBytes(&packets[i])
+		if b == nil {
+			nrUnsupported++
+			continue
+		}
+		eth, ip, tcp := packet.ParseEthernet(b)
+		if ip == nil || tcp == nil {
+			continue
+		}
+		if !portMatches(opts.Ports, int(tcp.SrcPort), int(tcp.DstPort)) {
+			continue
+		}
+		if watcher.IsTCPRetrans(ip, tcp) {
+			continue
+		}
+		srcEntityID, dstEntityID := packet.EntityIDs(eth, ip, tcp)
+		event, err := signal.NewPacketEvent(opts.EntityID, srcEntityID, dstEntityID,
+			map[string]interface{}{
+				"bytes": b,
+			})
+		if err != nil {
+			return nil, err
+		}
+		event.(arrivedTimeSetter).SetArrivedTime(packets[i].timestamp)
+		events = append(events, event)
+	}
+	if len(events) == 0 && nrUnsupported > 0 {
+		return nil, fmt.Errorf("unsupported link type %d (supported: Ethernet, raw IPv4, Linux cooked)", packets[0].linkType)
+	}
+	return events, nil
+}
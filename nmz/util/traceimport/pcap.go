@@ -0,0 +1,245 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package traceimport
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"time"
+)
+
+// link types (http://www.tcpdump.org/linktypes.html)
+const (
+	linkTypeEthernet = 1
+)
+
+const (
+	pcapMagicMicro = 0xa1b2c3d4
+	pcapMagicNano  = 0xa1b23c4d
+
+	pcapngSectionHeader        = 0x0a0d0d0a
+	pcapngInterfaceDescription = 0x00000001
+	pcapngSimplePacket         = 0x00000003
+	pcapngEnhancedPacket       = 0x00000006
+	pcapngByteOrderMagic       = 0x1a2b3c4d
+	pcapngOptionEnd            = 0
+	pcapngOptionTSResol        = 9
+
+	// sanity limit for corrupted files
+	maxBlockSize = 64 * 1024 * 1024
+)
+
+type capturedPacket struct {
+	timestamp time.Time
+	linkType  uint32
+	data      []byte
+}
+
+// reads a pcap or a pcapng file
+func readCapture(r io.Reader) ([]capturedPacket, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the magic: %s", err)
+	}
+	if binary.LittleEndian.Uint32(magic) == pcapngSectionHeader {
+		return readPcapng(br)
+	}
+	return readPcap(br)
+}
+
+func readPcap(r io.Reader) ([]capturedPacket, error) {
+	var hdr [24]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("failed to read the pcap header: %s", err)
+	}
+	var order binary.ByteOrder
+	var nano bool
+	switch {
+	case binary.LittleEndian.Uint32(hdr[0:4]) == pcapMagicMicro:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint32(hdr[0:4]) == pcapMagicMicro:
+		order = binary.BigEndian
+	case binary.LittleEndian.Uint32(hdr[0:4]) == pcapMagicNano:
+		order, nano = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(hdr[0:4]) == pcapMagicNano:
+		order, nano = binary.BigEndian, true
+	default:
+		return nil, fmt.Errorf("not a pcap file (magic: %x)", hdr[0:4])
+	}
+	linkType := order.Uint32(hdr[20:24])
+
+	packets := make([]capturedPacket, 0)
+	for {
+		var rec [16]byte
+		_, err := io.ReadFull(r, rec[:])
+		if err == io.EOF {
+			return packets, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad record %d: %s", len(packets), err)
+		}
+		sec, frac := int64(order.Uint32(rec[0:4])), int64(order.Uint32(rec[4:8]))
+		if !nano {
+			frac *= 1000
+		}
+		capLen := order.Uint32(rec[8:12])
+		if capLen > maxBlockSize {
+			return nil, fmt.Errorf("bad record %d: too large (%d bytes)", len(packets), capLen)
+		}
+		data := make([]byte, capLen)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("bad record %d: %s", len(packets), err)
+		}
+		packets = append(packets, capturedPacket{
+			timestamp: time.Unix(sec, frac),
+			linkType:  linkType,
+			data:      data,
+		})
+	}
+}
+
+type pcapngInterface struct {
+	linkType uint32
+	// ticks per second
+	tsResol uint64
+}
+
+func pcapngTSResol(v byte) uint64 {
+	if v&0x80 == 0 {
+		return uint64(math.Pow10(int(v)))
+	}
+	return 1 << (v & 0x7f)
+}
+
+// only the first section header's byte order is supported
+func readPcapng(r io.Reader) ([]capturedPacket, error) {
+	var order binary.ByteOrder = binary.LittleEndian
+	var ifaces []pcapngInterface
+	packets := make([]capturedPacket, 0)
+	for {
+		var hdr [8]byte
+		_, err := io.ReadFull(r, hdr[:])
+		if err == io.EOF {
+			return packets, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad block header: %s", err)
+		}
+		blockType := binary.LittleEndian.Uint32(hdr[0:4])
+		if blockType == pcapngSectionHeader {
+			// the byte order is determined by the byte-order magic that follows the block length
+			var bom [4]byte
+			if _, err = io.ReadFull(r, bom[:]); err != nil {
+				return nil, fmt.Errorf("bad section header: %s", err)
+			}
+			switch {
+			case binary.LittleEndian.Uint32(bom[:]) == pcapngByteOrderMagic:
+				order = binary.LittleEndian
+			case binary.BigEndian.Uint32(bom[:]) == pcapngByteOrderMagic:
+				order = binary.BigEndian
+			default:
+				return nil, fmt.Errorf("bad byte-order magic %x", bom)
+			}
+			ifaces = nil
+			blockLen := order.Uint32(hdr[4:8])
+			if blockLen < 16 || blockLen > maxBlockSize {
+				return nil, fmt.Errorf("bad section header length %d", blockLen)
+			}
+			if _, err = io.CopyN(ioutil.Discard, r, int64(blockLen-12)); err != nil {
+				return nil, fmt.Errorf("bad section header: %s", err)
+			}
+			continue
+		}
+		blockType = order.Uint32(hdr[0:4])
+		blockLen := order.Uint32(hdr[4:8])
+		if blockLen < 12 || blockLen > maxBlockSize || blockLen%4 != 0 {
+			return nil, fmt.Errorf("bad block length %d", blockLen)
+		}
+		// body and the trailing block length
+		body := make([]byte, blockLen-8)
+		if _, err = io.ReadFull(r, body); err != nil {
+			return nil, fmt.Errorf("bad block: %s", err)
+		}
+		body = body[:len(body)-4]
+		switch blockType {
+		case pcapngInterfaceDescription:
+			if len(body) < 8 {
+				return nil, fmt.Errorf("bad interface description block")
+			}
+			iface := pcapngInterface{
+				linkType: uint32(order.Uint16(body[0:2])),
+				tsResol:  1000000,
+			}
+			forEachPcapngOption(order, body[8:], func(code uint16, value []byte) {
+				if code == pcapngOptionTSResol && len(value) >= 1 {
+					iface.tsResol = pcapngTSResol(value[0])
+				}
+			})
+			ifaces = append(ifaces, iface)
+		case pcapngEnhancedPacket:
+			if len(body) < 20 {
+				return nil, fmt.Errorf("bad enhanced packet block")
+			}
+			ifaceID := order.Uint32(body[0:4])
+			if int(ifaceID) >= len(ifaces) {
+				return nil, fmt.Errorf("unknown interface %d", ifaceID)
+			}
+			iface := ifaces[ifaceID]
+			ticks := uint64(order.Uint32(body[4:8]))<<32 | uint64(order.Uint32(body[8:12]))
+			capLen := order.Uint32(body[12:16])
+			if int(capLen) > len(body)-20 {
+				return nil, fmt.Errorf("bad captured length %d", capLen)
+			}
+			packets = append(packets, capturedPacket{
+				timestamp: time.Unix(int64(ticks/iface.tsResol), int64(ticks%iface.tsResol*1000000000/iface.tsResol)),
+				linkType:  iface.linkType,
+				data:      body[20 : 20+capLen],
+			})
+		case pcapngSimplePacket:
+			// no timestamp
+			if len(ifaces) == 0 || len(body) < 4 {
+				return nil, fmt.Errorf("bad simple packet block")
+			}
+			capLen := order.Uint32(body[0:4])
+			if int(capLen) > len(body)-4 {
+				capLen = uint32(len(body) - 4)
+			}
+			packets = append(packets, capturedPacket{
+				linkType: ifaces[0].linkType,
+				data:     body[4 : 4+capLen],
+			})
+		default:
+			// name resolution, statistics, custom blocks, ..
+		}
+	}
+}
+
+func forEachPcapngOption(order binary.ByteOrder, b []byte, f func(code uint16, value []byte)) {
+	for len(b) >= 4 {
+		code, length := order.Uint16(b[0:2]), int(order.Uint16(b[2:4]))
+		if code == pcapngOptionEnd || 4+length > len(b) {
+			return
+		}
+		f(code, b[4:4+length])
+		// padded to 32 bits
+		b = b[4+(length+3)/4*4:]
+	}
+}
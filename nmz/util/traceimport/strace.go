@@ -0,0 +1,323 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package traceimport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/osrg/namazu/nmz/signal"
+)
+
+type StraceOptions struct {
+	// entity ID of the events (i.e. of the filesystem inspector)
+	EntityID string
+	// if non-empty, only the paths under this dir are imported, and they are made relative to it
+	// (e.g. "/data/zk/log/x" -> "/log/x" for "/data/zk"), as the filesystem inspector sees them.
+	StripPrefix string
+}
+
+// a line of strace (-f, -tt or -ttt, -y) or ltrace (-f, -tt or -ttt, -S).
+// "[pid 42] 12:34:56.789012 SYS_write(3</data/log>, "abc", 3) = 3"
+var straceLineRegexp = regexp.MustCompile(
+	`^(?:\[pid\s+(\d+)\]\s+|(\d+)\s+)?(?:(\d+:\d+:\d+(?:\.\d+)?|\d+\.\d+)\s+)?(?:<\.\.\.\s+)?(?:[\w.+-]+->)?(?:SYS_)?(\w+)(.*)$`)
+
+type syscallRecord struct {
+	pid       string
+	timestamp time.Time
+	name      string
+	args      []string
+	ret       string
+}
+
+// returns the return value, or -1 if unknown (e.g. "?")
+func (this *syscallRecord) retValue() int {
+	i := 0
+	for i < len(this.ret) && (this.ret[i] == '-' || ('0' <= this.ret[i] && this.ret[i] <= '9')) {
+		i++
+	}
+	v, err := strconv.Atoi(this.ret[:i])
+	if err != nil {
+		return -1
+	}
+	return v
+}
+
+func (this *syscallRecord) arg(i int) string {
+	if i < len(this.args) {
+		return this.args[i]
+	}
+	return ""
+}
+
+func parseStraceTime(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	if !strings.Contains(s, ":") {
+		// -ttt
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return time.Time{}
+		}
+		sec := int64(f)
+		return time.Unix(sec, int64((f-float64(sec))*1e9))
+	}
+	// -tt: the date is unknown
+	t, err := time.Parse("15:04:05.999999999", s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// splits the top-level arguments (quoted strings, {...}, [...] and <...> can contain commas)
+func splitStraceArgs(s string) []string {
+	args := make([]string, 0)
+	depth := 0
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '{' || c == '[' || c == '(' || c == '<':
+			depth++
+		case c == '}' || c == ']' || c == ')' || c == '>':
+			depth--
+		case c == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		args = append(args, last)
+	}
+	return args
+}
+
+// splits "arg1, arg2) = ret" (or "arg1, <unfinished ...>") into the arguments and the return value
+func splitStraceCall(s string) (args []string, ret string, unfinished bool) {
+	if i := strings.Index(s, "<unfinished ...>"); i >= 0 {
+		return splitStraceArgs(strings.TrimSuffix(strings.TrimSpace(s[:i]), ",")), "", true
+	}
+	i := strings.LastIndex(s, ") = ")
+	if i < 0 {
+		return splitStraceArgs(strings.TrimSuffix(s, ")")), "?", false
+	}
+	return splitStraceArgs(s[:i]), strings.TrimSpace(s[i+len(") = "):]), false
+}
+
+func unquote(s string) string {
+	s = strings.TrimSuffix(s, "...")
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return strings.Trim(s, `"`)
+}
+
+// converts strace output to FilesystemEvents of the filesystem inspector:
+//
+//   - open(2) etc. with O_DIRECTORY -> post-opendir
+//   - read(2) etc. -> post-read
+//   - write(2) etc. -> pre-write
+//   - mkdir(2) -> pre-mkdir
+//   - rmdir(2), unlinkat(2) with AT_REMOVEDIR -> pre-rmdir
+//   - fsync(2), fdatasync(2) -> pre-fsync
+//
+// "post" events are imported only for the successful calls.
+// The paths of the file descriptors are taken from -y annotations (e.g. "3</data/log>"),
+// or from the preceding open(2) calls.
+func StraceEvents(r io.Reader, opts StraceOptions) ([]signal.Event, error) {
+	p := &straceParser{
+		opts:    opts,
+		fds:     make(map[string]map[string]string),
+		pending: make(map[string]*syscallRecord),
+		events:  make([]signal.Event, 0),
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if err := p.parseLine(scanner.Text()); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return p.events, nil
+}
+
+type straceParser struct {
+	opts StraceOptions
+	// pid -> fd -> path
+	fds map[string]map[string]string
+	// pid -> unfinished call
+	pending map[string]*syscallRecord
+	events  []signal.Event
+}
+
+func (p *straceParser) parseLine(line string) error {
+	m := straceLineRegexp.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		// "+++ exited with 0 +++", "--- SIGCHLD ... ---", ..
+		return nil
+	}
+	pid := m[1] + m[2]
+	ts := parseStraceTime(m[3])
+	name, rest := m[4], m[5]
+	if strings.HasPrefix(rest, " resumed>") {
+		call, ok := p.pending[pid]
+		if !ok || call.name != name {
+			return nil
+		}
+		delete(p.pending, pid)
+		args, ret, _ := splitStraceCall(strings.TrimPrefix(rest, " resumed>"))
+		call.args = append(call.args, args...)
+		call.ret = ret
+		return p.onSyscall(call, ts)
+	}
+	if !strings.HasPrefix(rest, "(") {
+		return nil
+	}
+	args, ret, unfinished := splitStraceCall(rest[1:])
+	call := &syscallRecord{pid: pid, timestamp: ts, name: name, args: args, ret: ret}
+	if unfinished {
+		p.pending[pid] = call
+		return nil
+	}
+	return p.onSyscall(call, ts)
+}
+
+// "3</data/log>" -> "/data/log"
+func (p *straceParser) fdPath(pid, fd string) string {
+	if i := strings.Index(fd, "<"); i >= 0 && strings.HasSuffix(fd, ">") {
+		// not a file (e.g. "socket:[1234]", "pipe:[1234]")
+		if s := fd[i+1 : len(fd)-1]; strings.HasPrefix(s, "/") {
+			return s
+		}
+		return ""
+	}
+	return p.fds[pid][fd]
+}
+
+func fdNumber(fd string) string {
+	if i := strings.Index(fd, "<"); i >= 0 {
+		return fd[:i]
+	}
+	return fd
+}
+
+// resolves the path argument of *at(2) calls
+func (p *straceParser) atPath(pid, dirfd, pathArg string) string {
+	s := unquote(pathArg)
+	if path.IsAbs(s) || dirfd == "AT_FDCWD" {
+		return s
+	}
+	if dir := p.fdPath(pid, dirfd); dir != "" {
+		return path.Join(dir, s)
+	}
+	return s
+}
+
+// ts is the time when the call finished
+func (p *straceParser) onSyscall(call *syscallRecord, ts time.Time) error {
+	succeeded := call.retValue() >= 0
+	switch call.name {
+	case "open", "open64", "creat", "openat", "openat64":
+		var s, flags string
+		if strings.HasPrefix(call.name, "openat") {
+			s, flags = p.atPath(call.pid, fdNumber(call.arg(0)), call.arg(1)), call.arg(2)
+		} else {
+			s, flags = unquote(call.arg(0)), call.arg(1)
+		}
+		if !succeeded {
+			return nil
+		}
+		if p.fds[call.pid] == nil {
+			p.fds[call.pid] = make(map[string]string)
+		}
+		p.fds[call.pid][strconv.Itoa(call.retValue())] = s
+		if strings.Contains(flags, "O_DIRECTORY") {
+			return p.addEvent(signal.PostOpenDir, s, ts)
+		}
+	case "close":
+		delete(p.fds[call.pid], fdNumber(call.arg(0)))
+	case "read", "pread", "pread64", "readv", "preadv", "preadv2":
+		if succeeded {
+			return p.addEvent(signal.PostRead, p.fdPath(call.pid, call.arg(0)), ts)
+		}
+	case "write", "pwrite", "pwrite64", "writev", "pwritev", "pwritev2":
+		return p.addEvent(signal.PreWrite, p.fdPath(call.pid, call.arg(0)), call.timestamp)
+	case "fsync", "fdatasync":
+		return p.addEvent(signal.PreFsync, p.fdPath(call.pid, call.arg(0)), call.timestamp)
+	case "mkdir":
+		return p.addEvent(signal.PreMkdir, unquote(call.arg(0)), call.timestamp)
+	case "mkdirat":
+		return p.addEvent(signal.PreMkdir, p.atPath(call.pid, fdNumber(call.arg(0)), call.arg(1)), call.timestamp)
+	case "rmdir":
+		return p.addEvent(signal.PreRmdir, unquote(call.arg(0)), call.timestamp)
+	case "unlinkat":
+		if strings.Contains(call.arg(2), "AT_REMOVEDIR") {
+			return p.addEvent(signal.PreRmdir, p.atPath(call.pid, fdNumber(call.arg(0)), call.arg(1)), call.timestamp)
+		}
+	}
+	return nil
+}
+
+// returns false if s is not under the prefix
+func stripPathPrefix(s, prefix string) (string, bool) {
+	if prefix == "" {
+		return s, true
+	}
+	prefix = path.Clean(prefix)
+	s = path.Clean(s)
+	if s == prefix {
+		return "/", true
+	}
+	if !strings.HasPrefix(s, strings.TrimSuffix(prefix, "/")+"/") {
+		return "", false
+	}
+	return s[len(strings.TrimSuffix(prefix, "/")):], true
+}
+
+func (p *straceParser) addEvent(op signal.FilesystemOp, s string, ts time.Time) error {
+	if s == "" {
+		// unknown fd (e.g. opened before strace was attached), socket, ..
+		return nil
+	}
+	s, ok := stripPathPrefix(s, p.opts.StripPrefix)
+	if !ok {
+		return nil
+	}
+	event, err := signal.NewFilesystemEvent(p.opts.EntityID, op, s, map[string]interface{}{})
+	if err != nil {
+		return fmt.Errorf("failed to create an event for %s %s: %s", op, s, err)
+	}
+	event.(arrivedTimeSetter).SetArrivedTime(ts)
+	p.events = append(p.events, event)
+	return nil
+}
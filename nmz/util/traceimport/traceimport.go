@@ -0,0 +1,50 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package traceimport converts recordings made without nmz (pcap, strace) into traces,
+// so that the tools can analyze failures captured in production or in a plain CI run.
+//
+// The events are the same as the ones the inspectors would send:
+//
+//   - pcap, pcapng: PacketEvent (like the Ethernet inspector)
+//   - strace, ltrace: FilesystemEvent (like the filesystem inspector)
+package traceimport
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/osrg/namazu/nmz/signal"
+	. "github.com/osrg/namazu/nmz/util/trace"
+)
+
+// wraps each event in its default action, triggered when the event arrived
+func NewTrace(events []signal.Event) (*SingleTrace, error) {
+	trace := &SingleTrace{ActionSequence: make([]signal.Action, 0, len(events))}
+	for _, evt := range events {
+		act, err := evt.DefaultAction()
+		if err != nil {
+			return nil, fmt.Errorf("no default action for %s: %s", evt, err)
+		}
+		act.SetTriggeredTime(evt.ArrivedTime())
+		trace.ActionSequence = append(trace.ActionSequence, act)
+	}
+	return trace, nil
+}
+
+// implemented by signal.BasicSignal
+type arrivedTimeSetter interface {
+	SetArrivedTime(t time.Time)
+}
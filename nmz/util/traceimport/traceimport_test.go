@@ -0,0 +1,202 @@
+// Copyright (C) 2015 Nippon Telegraph and Telephone Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package traceimport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/osrg/namazu/nmz/signal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	signal.RegisterKnownSignals()
+	os.Exit(m.Run())
+}
+
+func newTestFrame(t *testing.T, srcPort, dstPort int, seq uint32, payload string) []byte {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 1},
+		DstMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 2},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolTCP,
+		SrcIP:    net.IP{10, 0, 0, 1},
+		DstIP:    net.IP{10, 0, 0, 2},
+	}
+	tcp := &layers.TCP{
+		SrcPort: layers.TCPPort(srcPort),
+		DstPort: layers.TCPPort(dstPort),
+		Seq:     seq,
+		PSH:     true,
+		ACK:     true,
+	}
+	tcp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	assert.NoError(t, gopacket.SerializeLayers(buf, opts, eth, ip, tcp, gopacket.Payload(payload)))
+	return buf.Bytes()
+}
+
+func newTestPcap(t *testing.T, frames [][]byte, base time.Time) []byte {
+	var buf bytes.Buffer
+	hdr := struct {
+		Magic                 uint32
+		Major, Minor          uint16
+		Zone                  int32
+		SigFigs, SnapLen, Net uint32
+	}{pcapMagicMicro, 2, 4, 0, 0, 65535, linkTypeEthernet}
+	binary.Write(&buf, binary.LittleEndian, &hdr)
+	for i, f := range frames {
+		ts := base.Add(time.Duration(i) * time.Millisecond)
+		binary.Write(&buf, binary.LittleEndian, []uint32{
+			uint32(ts.Unix()), uint32(ts.Nanosecond() / 1000), uint32(len(f)), uint32(len(f))})
+		buf.Write(f)
+	}
+	return buf.Bytes()
+}
+
+func pcapngBlock(blockType uint32, body []byte) []byte {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, blockType)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(body)+12))
+	buf.Write(body)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(body)+12))
+	return buf.Bytes()
+}
+
+func newTestPcapng(frames [][]byte, base time.Time) []byte {
+	var buf bytes.Buffer
+	shb := make([]byte, 16)
+	binary.LittleEndian.PutUint32(shb[0:4], pcapngByteOrderMagic)
+	binary.LittleEndian.PutUint16(shb[4:6], 1)
+	binary.LittleEndian.PutUint64(shb[8:16], 0xffffffffffffffff)
+	buf.Write(pcapngBlock(pcapngSectionHeader, shb))
+	// nanosecond resolution
+	idb := []byte{linkTypeEthernet, 0, 0, 0, 0, 0, 0, 0, pcapngOptionTSResol, 0, 1, 0, 9, 0, 0, 0, 0, 0, 0, 0}
+	buf.Write(pcapngBlock(pcapngInterfaceDescription, idb))
+	for i, f := range frames {
+		ticks := uint64(base.Add(time.Duration(i) * time.Millisecond).UnixNano())
+		epb := make([]byte, 20)
+		binary.LittleEndian.PutUint32(epb[4:8], uint32(ticks>>32))
+		binary.LittleEndian.PutUint32(epb[8:12], uint32(ticks))
+		binary.LittleEndian.PutUint32(epb[12:16], uint32(len(f)))
+		binary.LittleEndian.PutUint32(epb[16:20], uint32(len(f)))
+		buf.Write(pcapngBlock(pcapngEnhancedPacket, append(epb, f...)))
+	}
+	return buf.Bytes()
+}
+
+func TestPacketEvents(t *testing.T) {
+	frames := [][]byte{
+		newTestFrame(t, 40000, 2181, 1, "foo"),
+		// retransmission
+		newTestFrame(t, 40000, 2181, 1, "foo"),
+		newTestFrame(t, 2181, 40000, 1, "bar"),
+		newTestFrame(t, 40001, 8080, 1, "baz"),
+	}
+	base := time.Unix(1500000000, 123456000)
+	for _, b := range [][]byte{newTestPcap(t, frames, base), newTestPcapng(frames, base)} {
+		events, err := PacketEvents(bytes.NewReader(b), PacketOptions{EntityID: "_namazu_ethernet_inspector", Ports: []int{2181}})
+		assert.NoError(t, err)
+		assert.Len(t, events, 2)
+		option := events[0].JSONMap()["option"].(map[string]interface{})
+		assert.Equal(t, "entity-10.0.0.1:40000", option["src_entity"])
+		assert.Equal(t, "entity-10.0.0.2:2181", option["dst_entity"])
+		assert.Equal(t, "_namazu_ethernet_inspector", events[0].EntityID())
+		assert.True(t, base.Equal(events[0].ArrivedTime()))
+		assert.True(t, base.Add(2*time.Millisecond).Equal(events[1].ArrivedTime()))
+
+		trace, err := NewTrace(events)
+		assert.NoError(t, err)
+		assert.Len(t, trace.ActionSequence, 2)
+		assert.IsType(t, &signal.EventAcceptanceAction{}, trace.ActionSequence[0])
+		assert.True(t, base.Equal(trace.ActionSequence[0].TriggeredTime()))
+	}
+
+	_, err := PacketEvents(strings.NewReader("not a pcap file"), PacketOptions{})
+	assert.Error(t, err)
+}
+
+const testStrace = `1234  12:34:56.000001 openat(AT_FDCWD, "/data/zk/version-2", O_RDONLY|O_NONBLOCK|O_CLOEXEC|O_DIRECTORY) = 3
+1234  12:34:56.000002 close(3)                = 0
+1234  12:34:56.000003 openat(AT_FDCWD, "/data/zk/version-2/log.1", O_RDWR|O_CREAT, 0644) = 4
+1234  12:34:56.000004 write(4, "abc", 3 <unfinished ...>
+1235  12:34:56.000005 read(5<socket:[4321]>, "x", 1) = 1
+1234  12:34:56.000006 <... write resumed> ) = 3
+1234  12:34:56.000007 fsync(4</data/zk/version-2/log.1>) = 0
+1234  12:34:56.000008 read(4, "", 4096)     = -1 EIO (Input/output error)
+1234  12:34:56.000009 mkdirat(AT_FDCWD, "/data/zk/snap", 0755) = 0
+1234  12:34:56.000010 mkdir("/tmp/foo", 0755) = 0
+1234  12:34:56.000011 unlinkat(AT_FDCWD, "/data/zk/snap", AT_REMOVEDIR) = 0
+1234  12:34:56.000012 +++ exited with 0 +++
+`
+
+func TestStraceEvents(t *testing.T) {
+	events, err := StraceEvents(strings.NewReader(testStrace), StraceOptions{
+		EntityID:    "_namazu_fs_inspector",
+		StripPrefix: "/data/zk",
+	})
+	assert.NoError(t, err)
+	type opPath struct {
+		op, path string
+	}
+	expected := []opPath{
+		{signal.PostOpenDir, "/version-2"},
+		{signal.PreWrite, "/version-2/log.1"},
+		{signal.PreFsync, "/version-2/log.1"},
+		{signal.PreMkdir, "/snap"},
+		{signal.PreRmdir, "/snap"},
+	}
+	actual := make([]opPath, 0)
+	for _, evt := range events {
+		option := evt.JSONMap()["option"].(map[string]interface{})
+		actual = append(actual, opPath{string(option["op"].(signal.FilesystemOp)), option["path"].(string)})
+		assert.Equal(t, "_namazu_fs_inspector", evt.EntityID())
+	}
+	assert.Equal(t, expected, actual)
+	// the time when write(2) was called
+	assert.Equal(t, 4000, events[1].ArrivedTime().Nanosecond())
+}
+
+func TestLtraceEvents(t *testing.T) {
+	events, err := StraceEvents(strings.NewReader(
+		`[pid 42] 1500000000.000001 SYS_fdatasync(7</var/lib/app/db>) = 0
+[pid 42] 1500000000.000002 libc.so.6->rmdir("/var/lib/app/tmp") = 0
+`), StraceOptions{EntityID: "_namazu_fs_inspector"})
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	option := events[1].JSONMap()["option"].(map[string]interface{})
+	assert.Equal(t, signal.FilesystemOp(signal.PreRmdir), option["op"])
+	assert.Equal(t, "/var/lib/app/tmp", option["path"])
+	assert.Equal(t, int64(1500000000), events[0].ArrivedTime().Unix())
+}